@@ -47,11 +47,33 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+// TypeAnnotation is the optional type written after a binding, a parameter
+// or a parameter list, e.g. the int in `let x: int = 1`. Array types are
+// written as [int] and carry their element type in Element.
+type TypeAnnotation struct {
+	Token   token.Token // the type name token, or '[' for array types
+	Name    string
+	Element *TypeAnnotation
+}
+
+func (ta *TypeAnnotation) TokenLiteral() string { return ta.Token.Literal }
+func (ta *TypeAnnotation) String() string {
+	if ta.Element != nil {
+		return "[" + ta.Element.String() + "]"
+	}
+	return ta.Name
+}
+
 // Statements
 type LetStatement struct {
 	Token token.Token // the token.LET token
 	Name  *Identifier
+	Type  *TypeAnnotation
 	Value Expression
+
+	// Pattern is the *ArrayPattern or *HashPattern a destructuring let
+	// binds in place of Name, which is then nil.
+	Pattern Expression
 }
 
 func (ls *LetStatement) statementNode()       {}
@@ -60,7 +82,14 @@ func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
+	if ls.Type != nil {
+		out.WriteString(": " + ls.Type.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -217,11 +246,85 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// ThrowStatement raises Value, which the nearest enclosing catch receives.
+type ThrowStatement struct {
+	Token token.Token // the 'throw' token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) String() string {
+	return ts.TokenLiteral() + " " + ts.Value.String() + ";"
+}
+
+// YieldExpression hands Value to whatever advances the generator it is in
+// and suspends the generator until it is advanced again. If Delegate is set
+// it hands over every value of Value, an iterator, array or string, instead.
+// The expression itself evaluates to null.
+type YieldExpression struct {
+	Token    token.Token // the 'yield' token
+	Value    Expression
+	Delegate bool
+	// Tail is set on a delegating yield after which the generator has
+	// nothing left to do, so it can hand itself over to Value entirely.
+	Tail bool
+}
+
+func (ye *YieldExpression) expressionNode()      {}
+func (ye *YieldExpression) TokenLiteral() string { return ye.Token.Literal }
+func (ye *YieldExpression) String() string {
+	if ye.Delegate {
+		return ye.TokenLiteral() + " ..." + ye.Value.String()
+	}
+	return ye.TokenLiteral() + " " + ye.Value.String()
+}
+
+// TryExpression evaluates Block. If that throws, Catch runs with Parameter
+// bound to what was thrown. Finally, if any, runs last in every case. The
+// value of the expression is that of Block or Catch; either of Catch and
+// Finally may be nil, but not both.
+type TryExpression struct {
+	Token     token.Token // the 'try' token
+	Block     *BlockStatement
+	Parameter *Identifier
+	Catch     *BlockStatement
+	Finally   *BlockStatement
+}
+
+func (te *TryExpression) expressionNode()      {}
+func (te *TryExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+
+	if te.Catch != nil {
+		out.WriteString(" catch(" + te.Parameter.String() + ") ")
+		out.WriteString(te.Catch.String())
+	}
+
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
+
 type FunctionLiteral struct {
-	Token      token.Token // The 'fn' token
-	Parameters []*Identifier
-	Body       *BlockStatement
-	Name       string
+	Token          token.Token // The 'fn' token
+	Parameters     []*Identifier
+	ParameterTypes []*TypeAnnotation // nil entries for unannotated parameters
+	Defaults       []Expression      // nil entries for parameters without a default
+	Rest           *Identifier       // the ...rest parameter, if any
+	ReturnType     *TypeAnnotation
+	Body           *BlockStatement
+	Name           string
+	// Generator is set if Body yields, in which case calling the function
+	// returns an iterator that runs Body as it is advanced.
+	Generator bool
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -230,8 +333,18 @@ func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+	for i, p := range fl.Parameters {
+		param := p.String()
+		if i < len(fl.ParameterTypes) && fl.ParameterTypes[i] != nil {
+			param += ": " + fl.ParameterTypes[i].String()
+		}
+		if i < len(fl.Defaults) && fl.Defaults[i] != nil {
+			param += " = " + fl.Defaults[i].String()
+		}
+		params = append(params, param)
+	}
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
 	}
 
 	out.WriteString(fl.TokenLiteral())
@@ -241,7 +354,11 @@ func (fl *FunctionLiteral) String() string {
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(") ")
+	out.WriteString(")")
+	if fl.ReturnType != nil {
+		out.WriteString(": " + fl.ReturnType.String())
+	}
+	out.WriteString(" ")
 	out.WriteString(fl.Body.String())
 
 	return out.String()
@@ -251,6 +368,11 @@ type CallExpression struct {
 	Token     token.Token // The '(' token
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
+
+	// Keywords names the keyword arguments, whose values are in
+	// KeywordValues, passed after Arguments.
+	Keywords      []*Identifier
+	KeywordValues []Expression
 }
 
 func (ce *CallExpression) expressionNode()      {}
@@ -262,6 +384,9 @@ func (ce *CallExpression) String() string {
 	for _, a := range ce.Arguments {
 		args = append(args, a.String())
 	}
+	for i, k := range ce.Keywords {
+		args = append(args, k.String()+" = "+ce.KeywordValues[i].String())
+	}
 
 	out.WriteString(ce.Function.String())
 	out.WriteString("(")
@@ -271,6 +396,30 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// InterpolatedString is a string literal with ${} interpolations. Its parts
+// are the *StringLiterals between the interpolations and the expressions
+// in them, in order.
+type InterpolatedString struct {
+	Token token.Token // the token.STRING_START token
+	Parts []Expression
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+
+	for _, part := range is.Parts {
+		if literal, ok := part.(*StringLiteral); ok {
+			out.WriteString(literal.Value)
+		} else {
+			out.WriteString("${" + part.String() + "}")
+		}
+	}
+
+	return out.String()
+}
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -302,6 +451,33 @@ func (al *ArrayLiteral) String() string {
 	return out.String()
 }
 
+// ImportStatement binds Name to the exports of the module at Path:
+//
+//	import "lib/math.tt" as math;
+type ImportStatement struct {
+	Token token.Token // the token.IMPORT token
+	Path  string
+	Name  *Identifier
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	return fmt.Sprintf("import %q as %s;", is.Path, is.Name.String())
+}
+
+// ExportStatement is a let statement whose binding the module exports.
+type ExportStatement struct {
+	Token     token.Token // the token.EXPORT token
+	Statement *LetStatement
+}
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Statement.String()
+}
+
 type IndexExpression struct {
 	Token token.Token // The [ token
 	Left  Expression
@@ -322,9 +498,54 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// SliceExpression is left[low:high], where a nil Low or High leaves that
+// end open.
+type SliceExpression struct {
+	Token token.Token // The [ token
+	Left  Expression
+	Low   Expression
+	High  Expression
+}
+
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Low != nil {
+		out.WriteString(se.Low.String())
+	}
+	out.WriteString(":")
+	if se.High != nil {
+		out.WriteString(se.High.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// RangeExpression is start..end, the integers from start up to end, or
+// start..=end, which includes end.
+type RangeExpression struct {
+	Token     token.Token // the .. or ..= token
+	Start     Expression
+	End       Expression
+	Inclusive bool
+}
+
+func (re *RangeExpression) expressionNode()      {}
+func (re *RangeExpression) TokenLiteral() string { return re.Token.Literal }
+func (re *RangeExpression) String() string {
+	return "(" + re.Start.String() + re.Token.Literal + re.End.String() + ")"
+}
+
 type HashLiteral struct {
 	Token token.Token // the '{' token
 	Pairs map[Expression]Expression
+	Keys  []Expression // the keys of Pairs in source order
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -333,8 +554,8 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
@@ -343,3 +564,89 @@ func (hl *HashLiteral) String() string {
 
 	return out.String()
 }
+
+// MatchExpression evaluates to the body of the first arm whose pattern
+// matches Value and whose guard, if any, holds, or null if none does.
+type MatchExpression struct {
+	Token token.Token // the 'match' token
+	Value Expression
+	Arms  []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString("match ")
+	out.WriteString(me.Value.String())
+	out.WriteString(" { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// MatchArm is a case of a match expression. Its Pattern is an integer,
+// string or boolean literal, which matches an equal value, an identifier,
+// which matches anything and binds it unless it is `_`, or an ArrayPattern
+// or HashPattern, which match collections whose parts match.
+type MatchArm struct {
+	Pattern Expression
+	Guard   Expression // nil for arms without an if
+	Body    Expression
+}
+
+func (ma *MatchArm) String() string {
+	if ma.Guard == nil {
+		return ma.Pattern.String() + " => " + ma.Body.String()
+	}
+	return ma.Pattern.String() + " if " + ma.Guard.String() + " => " + ma.Body.String()
+}
+
+// ArrayPattern matches an array with as many elements as Elements, or at
+// least as many if Rest binds the remaining ones.
+type ArrayPattern struct {
+	Token    token.Token // the '[' token
+	Elements []Expression
+	Rest     *Identifier
+}
+
+func (ap *ArrayPattern) expressionNode()      {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashPattern matches a hash that has every key of Keys, with values that
+// match the pattern at the same position in Values. Other keys don't
+// matter.
+type HashPattern struct {
+	Token  token.Token // the '{' token
+	Keys   []Expression
+	Values []Expression
+}
+
+func (hp *HashPattern) expressionNode()      {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for i, key := range hp.Keys {
+		pairs = append(pairs, key.String()+":"+hp.Values[i].String())
+	}
+
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
@@ -4,15 +4,19 @@ import (
 	"flag"
 	"fmt"
 	"time"
+	"turtle/ast"
 	"turtle/compiler"
 	"turtle/evaluator"
 	"turtle/lexer"
 	"turtle/object"
 	"turtle/parser"
+	"turtle/regvm"
 	"turtle/vm"
 )
 
-var engine = flag.String("engine", "vm", "use 'vm' or 'eval'")
+var engine = flag.String("engine", "vm", "use 'vm', 'regvm', 'eval', 'compare' (vm against regvm) or 'specialize' (vm with and without superinstructions)")
+var optimize = flag.Bool("O", false, "run the peephole optimizer over compiled bytecode")
+var specialize = flag.Bool("S", false, "compile hot instruction sequences to superinstructions")
 
 var input = `
 let fibonacci = fn(x) {
@@ -32,43 +36,98 @@ fibonacci(35);
 func main() {
 	flag.Parse()
 
-	var duration time.Duration
-	var result object.Object
-
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
 
-	if *engine == "vm" {
-		comp := compiler.New()
-		err := comp.Compile(program)
-		if err != nil {
-			fmt.Printf("compiler error: %s", err)
-			return
-		}
-
-		machine := vm.New(comp.Bytecode())
-
+	switch *engine {
+	case "vm":
+		report("vm", runVM(program, *specialize))
+	case "regvm":
+		report("regvm", runRegisterVM(program))
+	case "compare":
+		stack := runVM(program, *specialize)
+		report("vm", stack)
+		register := runRegisterVM(program)
+		report("regvm", register)
+		reportSpeedup(stack, register)
+	case "specialize":
+		plain := runVM(program, false)
+		report("vm", plain)
+		special := runVM(program, true)
+		report("vm -S", special)
+		reportSpeedup(plain, special)
+	default:
+		env := object.NewEnvironment()
 		start := time.Now()
+		result := evaluator.Eval(program, env)
+		report("eval", run{result: result, duration: time.Since(start)})
+	}
+}
 
-		err = machine.Run()
-		if err != nil {
-			fmt.Printf("vm error: %s", err)
-			return
-		}
+type run struct {
+	result   object.Object
+	duration time.Duration
+	err      error
+}
 
-		duration = time.Since(start)
-		result = machine.LastPoppedStackElem()
-	} else {
-		env := object.NewEnvironment()
-		start := time.Now()
-		result = evaluator.Eval(program, env)
-		duration = time.Since(start)
+func report(engine string, r run) {
+	if r.err != nil {
+		fmt.Printf("engine=%s, error: %s\n", engine, r.err)
+		return
 	}
 
 	fmt.Printf(
 		"engine=%s, result=%s, duration=%s\n",
-		*engine,
-		result.Inspect(),
-		duration)
+		engine,
+		r.result.Inspect(),
+		r.duration)
+}
+
+// reportSpeedup prints how much faster after ran than before.
+func reportSpeedup(before, after run) {
+	if before.err != nil || after.err != nil {
+		return
+	}
+	fmt.Printf("speedup=%.2fx\n", before.duration.Seconds()/after.duration.Seconds())
+}
+
+func runVM(program *ast.Program, specialize bool) run {
+	comp := compiler.New()
+	comp.SetOptimize(*optimize)
+	comp.SetSpecialize(specialize)
+	err := comp.Compile(program)
+	if err != nil {
+		return run{err: fmt.Errorf("compiler error: %s", err)}
+	}
+
+	machine := vm.New(comp.Bytecode())
+
+	start := time.Now()
+
+	err = machine.Run()
+	if err != nil {
+		return run{err: fmt.Errorf("vm error: %s", err)}
+	}
+
+	return run{result: machine.LastPoppedStackElem(), duration: time.Since(start)}
+}
+
+func runRegisterVM(program *ast.Program) run {
+	comp := regvm.NewCompiler()
+	err := comp.Compile(program)
+	if err != nil {
+		return run{err: fmt.Errorf("compiler error: %s", err)}
+	}
+
+	machine := regvm.New(comp.Bytecode())
+
+	start := time.Now()
+
+	err = machine.Run()
+	if err != nil {
+		return run{err: fmt.Errorf("vm error: %s", err)}
+	}
+
+	return run{result: machine.LastValue(), duration: time.Since(start)}
 }
@@ -0,0 +1,659 @@
+package checker
+
+import (
+	"fmt"
+	"turtle/ast"
+)
+
+type scope struct {
+	outer *scope
+	store map[string]Type
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{outer: outer, store: make(map[string]Type)}
+}
+
+func (s *scope) lookup(name string) (Type, bool) {
+	t, ok := s.store[name]
+	if !ok && s.outer != nil {
+		return s.outer.lookup(name)
+	}
+	return t, ok
+}
+
+// Checker infers the types of a program before it is compiled and reports
+// operations that are bound to fail at runtime. Annotations are optional:
+// anything the checker cannot infer has type Any and is accepted everywhere.
+// A Checker keeps its global scope between calls to Check so the REPL can
+// check one line at a time.
+type Checker struct {
+	globals *scope
+	scope   *scope
+	errors  []string
+
+	// return types seen in the function bodies being checked, innermost last
+	returns [][]Type
+}
+
+func New() *Checker {
+	globals := newScope(nil)
+	return &Checker{globals: globals, scope: globals}
+}
+
+// Check type checks program and returns the errors it found.
+func (c *Checker) Check(program *ast.Program) []string {
+	c.errors = []string{}
+	c.scope = c.globals
+
+	for _, statement := range program.Statements {
+		c.checkStatement(statement)
+	}
+
+	return c.errors
+}
+
+func (c *Checker) errorf(format string, a ...interface{}) {
+	c.errors = append(c.errors, fmt.Sprintf(format, a...))
+}
+
+func (c *Checker) checkStatement(node ast.Statement) Type {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		if node.Expression == nil {
+			return Null
+		}
+		return c.checkExpression(node.Expression)
+
+	case *ast.LetStatement:
+		if node.Pattern != nil {
+			c.checkDestructuring(node)
+			return Null
+		}
+
+		declared := c.resolveAnnotation(node.Type)
+
+		// bind the name up front so recursive functions can refer to it
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok && node.Type == nil {
+			c.scope.store[node.Name.Value] = c.signature(fn)
+		} else {
+			c.scope.store[node.Name.Value] = declared
+		}
+
+		actual := c.checkExpression(node.Value)
+		if !assignable(actual, declared) {
+			c.errorf("cannot use %s as %s in let %s", actual, declared, node.Name.Value)
+		}
+
+		if node.Type != nil {
+			c.scope.store[node.Name.Value] = declared
+		} else {
+			c.scope.store[node.Name.Value] = actual
+		}
+		return Null
+
+	case *ast.ImportStatement:
+		// modules are checked on their own, their exports are a hash of
+		// anything
+		c.scope.store[node.Name.Value] = &Hash{Key: String, Value: Any}
+		return Null
+
+	case *ast.ExportStatement:
+		return c.checkStatement(node.Statement)
+
+	case *ast.ReturnStatement:
+		t := c.checkExpression(node.ReturnValue)
+		if len(c.returns) > 0 {
+			c.returns[len(c.returns)-1] = append(c.returns[len(c.returns)-1], t)
+		}
+		return Any
+
+	case *ast.ThrowStatement:
+		c.checkExpression(node.Value)
+		return Any
+
+	case *ast.BlockStatement:
+		var result Type = Null
+		for _, statement := range node.Statements {
+			result = c.checkStatement(statement)
+		}
+		return result
+	}
+
+	return Any
+}
+
+func (c *Checker) checkExpression(node ast.Expression) Type {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+
+	case *ast.StringLiteral:
+		return String
+
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			c.checkExpression(part)
+		}
+		return String
+
+	case *ast.Boolean:
+		return Bool
+
+	case *ast.Identifier:
+		if t, ok := c.scope.lookup(node.Value); ok {
+			return t
+		}
+		if t, ok := builtins[node.Value]; ok {
+			return t
+		}
+		if t, ok := constants[node.Value]; ok {
+			return t
+		}
+		return Any
+
+	case *ast.PrefixExpression:
+		right := c.checkExpression(node.Right)
+		switch node.Operator {
+		case "!":
+			return Bool
+		case "-":
+			if right == Float {
+				return Float
+			}
+			if right != Any && right != Int {
+				c.errorf("unknown operator: -%s", right)
+				return Any
+			}
+			return Int
+		}
+		return Any
+
+	case *ast.InfixExpression:
+		left := c.checkExpression(node.Left)
+		right := c.checkExpression(node.Right)
+		return c.checkInfix(node.Operator, left, right)
+
+	case *ast.IfExpression:
+		c.checkExpression(node.Condition)
+		consequence := c.checkStatement(node.Consequence)
+		if node.Alternative == nil {
+			return join(consequence, Null)
+		}
+		return join(consequence, c.checkStatement(node.Alternative))
+
+	case *ast.MatchExpression:
+		return c.checkMatch(node)
+
+	case *ast.TryExpression:
+		result := c.checkStatement(node.Block)
+		if node.Catch != nil {
+			// anything can be thrown
+			c.scope = newScope(c.scope)
+			c.scope.store[node.Parameter.Value] = Any
+			result = join(result, c.checkStatement(node.Catch))
+			c.scope = c.scope.outer
+		}
+		if node.Finally != nil {
+			c.checkStatement(node.Finally)
+		}
+		return result
+
+	case *ast.FunctionLiteral:
+		return c.checkFunction(node)
+
+	case *ast.CallExpression:
+		return c.checkCall(node)
+
+	case *ast.ArrayLiteral:
+		var element Type
+		for _, e := range node.Elements {
+			t := c.checkExpression(e)
+			if element == nil {
+				element = t
+			} else {
+				element = join(element, t)
+			}
+		}
+		if element == nil {
+			element = Any
+		}
+		return &Array{Element: element}
+
+	case *ast.HashLiteral:
+		var key, value Type
+		for _, k := range node.Keys {
+			kt := c.checkExpression(k)
+			if !hashable(kt) {
+				c.errorf("unusable as hash key: %s", kt)
+			}
+			vt := c.checkExpression(node.Pairs[k])
+			if key == nil {
+				key, value = kt, vt
+			} else {
+				key, value = join(key, kt), join(value, vt)
+			}
+		}
+		if key == nil {
+			key, value = Any, Any
+		}
+		return &Hash{Key: key, Value: value}
+
+	case *ast.IndexExpression:
+		left := c.checkExpression(node.Left)
+		index := c.checkExpression(node.Index)
+		return c.checkIndex(left, index)
+
+	case *ast.YieldExpression:
+		t := c.checkExpression(node.Value)
+		if node.Delegate && t != Any && t != Iterator && t != String {
+			if _, ok := t.(*Array); !ok {
+				c.errorf("cannot yield from %s", t)
+			}
+		}
+		return Null
+
+	case *ast.SliceExpression:
+		return c.checkSlice(node)
+
+	case *ast.RangeExpression:
+		for _, bound := range []ast.Expression{node.Start, node.End} {
+			if t := c.checkExpression(bound); t != Any && t != Int {
+				c.errorf("range bounds must be int, got %s", t)
+			}
+		}
+		return &Array{Element: Int}
+	}
+
+	return Any
+}
+
+// checkSlice returns the type of left[low:high], that of left.
+func (c *Checker) checkSlice(node *ast.SliceExpression) Type {
+	left := c.checkExpression(node.Left)
+	for _, bound := range []ast.Expression{node.Low, node.High} {
+		if bound == nil {
+			continue
+		}
+		if t := c.checkExpression(bound); t != Any && t != Int {
+			c.errorf("slice bounds must be int, got %s", t)
+		}
+	}
+
+	if _, ok := left.(*Array); !ok && left != String && left != Any {
+		c.errorf("slice operator not supported: %s", left)
+		return Any
+	}
+	return left
+}
+
+// checkMatch returns the join of the types of the arms of node, and null
+// unless the last arm matches everything.
+func (c *Checker) checkMatch(node *ast.MatchExpression) Type {
+	value := c.checkExpression(node.Value)
+
+	var result Type
+	exhaustive := false
+	for _, arm := range node.Arms {
+		c.scope = newScope(c.scope)
+		c.bindPattern(arm.Pattern, value)
+		if arm.Guard != nil {
+			c.checkExpression(arm.Guard)
+		}
+
+		body := c.checkExpression(arm.Body)
+		c.scope = c.scope.outer
+		if result == nil {
+			result = body
+		} else {
+			result = join(result, body)
+		}
+
+		_, catchAll := arm.Pattern.(*ast.Identifier)
+		exhaustive = catchAll && arm.Guard == nil
+	}
+
+	if result == nil {
+		return Null
+	}
+	if !exhaustive {
+		return join(result, Null)
+	}
+	return result
+}
+
+// checkDestructuring checks the value of a destructuring let can have the
+// shape of its pattern and binds the identifiers in it.
+func (c *Checker) checkDestructuring(node *ast.LetStatement) {
+	value := c.checkExpression(node.Value)
+
+	shaped := value == Any
+	switch node.Pattern.(type) {
+	case *ast.ArrayPattern:
+		_, ok := value.(*Array)
+		shaped = shaped || ok
+	case *ast.HashPattern:
+		_, ok := value.(*Hash)
+		shaped = shaped || ok
+	}
+	if !shaped {
+		c.errorf("cannot destructure %s into %s", value, node.Pattern)
+	}
+
+	c.bindPattern(node.Pattern, value)
+}
+
+// bindPattern gives the identifiers of pattern the types of the parts of a
+// value of type t they match.
+func (c *Checker) bindPattern(pattern ast.Expression, t Type) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			c.scope.store[pattern.Value] = t
+		}
+
+	case *ast.ArrayPattern:
+		var element Type = Any
+		if array, ok := t.(*Array); ok {
+			element = array.Element
+		}
+
+		for _, e := range pattern.Elements {
+			c.bindPattern(e, element)
+		}
+		if pattern.Rest != nil {
+			c.bindPattern(pattern.Rest, &Array{Element: element})
+		}
+
+	case *ast.HashPattern:
+		var value Type = Any
+		if hash, ok := t.(*Hash); ok {
+			value = hash.Value
+		}
+
+		for _, v := range pattern.Values {
+			c.bindPattern(v, value)
+		}
+	}
+}
+
+func (c *Checker) checkInfix(operator string, left, right Type) Type {
+	switch operator {
+	case "==", "!=":
+		return Bool
+	}
+
+	if left == Any || right == Any {
+		switch operator {
+		case "<", ">":
+			return Bool
+		case "-", "*", "/":
+			if left == Float || right == Float {
+				return Float
+			}
+			return Int
+		}
+		return Any
+	}
+
+	switch {
+	case left == Int && right == Int:
+		switch operator {
+		case "+", "-", "*", "/":
+			return Int
+		case "<", ">":
+			return Bool
+		}
+	case numeric(left) && numeric(right):
+		switch operator {
+		case "+", "-", "*", "/":
+			return Float
+		case "<", ">":
+			return Bool
+		}
+	case left == String && right == String && operator == "+":
+		return String
+	}
+
+	if !identical(left, right) {
+		c.errorf("type mismatch: %s %s %s", left, operator, right)
+	} else {
+		c.errorf("unknown operator: %s %s %s", left, operator, right)
+	}
+	return Any
+}
+
+func (c *Checker) checkIndex(left, index Type) Type {
+	switch left := left.(type) {
+	case *Array:
+		if index != Any && index != Int {
+			c.errorf("array index must be int, got %s", index)
+		}
+		return left.Element
+	case *Hash:
+		if !hashable(index) {
+			c.errorf("unusable as hash key: %s", index)
+		}
+		return left.Value
+	}
+
+	if left == String {
+		if index != Any && index != Int {
+			c.errorf("string index must be int, got %s", index)
+		}
+		return String
+	}
+
+	if left != Any {
+		c.errorf("index operator not supported: %s", left)
+	}
+	return Any
+}
+
+// signature builds the function type declared by fn's annotations. A
+// function with default or rest parameters takes a varying number of
+// arguments, which its type leaves unchecked.
+func (c *Checker) signature(fn *ast.FunctionLiteral) *Function {
+	params := c.parameterTypes(fn)
+	if fn.Rest != nil {
+		params = nil
+	}
+	for _, value := range fn.Defaults {
+		if value != nil {
+			params = nil
+		}
+	}
+
+	ret := c.resolveAnnotation(fn.ReturnType)
+	if fn.Generator && fn.ReturnType == nil {
+		ret = Iterator
+	}
+
+	return &Function{Parameters: params, Return: ret}
+}
+
+func (c *Checker) parameterTypes(fn *ast.FunctionLiteral) []Type {
+	params := []Type{}
+	for i := range fn.Parameters {
+		if i < len(fn.ParameterTypes) && fn.ParameterTypes[i] != nil {
+			params = append(params, c.resolveAnnotation(fn.ParameterTypes[i]))
+		} else {
+			params = append(params, Any)
+		}
+	}
+	return params
+}
+
+func (c *Checker) checkFunction(fn *ast.FunctionLiteral) Type {
+	signature := c.signature(fn)
+
+	outer := c.scope
+	c.scope = newScope(outer)
+	for i, t := range c.parameterTypes(fn) {
+		p := fn.Parameters[i]
+		if i < len(fn.Defaults) && fn.Defaults[i] != nil {
+			actual := c.checkExpression(fn.Defaults[i])
+			if !assignable(actual, t) {
+				c.errorf("cannot use %s as %s in default of %s", actual, t, p.Value)
+			}
+		}
+		c.scope.store[p.Value] = t
+	}
+	if fn.Rest != nil {
+		c.scope.store[fn.Rest.Value] = &Array{Element: Any}
+	}
+
+	c.returns = append(c.returns, []Type{})
+	last := c.checkStatement(fn.Body)
+	returns := c.returns[len(c.returns)-1]
+	c.returns = c.returns[:len(c.returns)-1]
+	c.scope = outer
+
+	// what a generator returns ends it rather than being returned
+	if fn.Generator {
+		if !assignable(Iterator, signature.Return) {
+			c.errorf("cannot use %s as %s in return from %s", Iterator, signature.Return, functionName(fn))
+		}
+		return signature
+	}
+
+	if n := len(fn.Body.Statements); n > 0 {
+		if _, ok := fn.Body.Statements[n-1].(*ast.ReturnStatement); !ok {
+			returns = append(returns, last)
+		}
+	} else {
+		returns = append(returns, Null)
+	}
+
+	inferred := returns[0]
+	for _, r := range returns[1:] {
+		inferred = join(inferred, r)
+	}
+
+	if fn.ReturnType == nil {
+		signature.Return = inferred
+		return signature
+	}
+
+	for _, r := range returns {
+		if !assignable(r, signature.Return) {
+			c.errorf("cannot use %s as %s in return from %s", r, signature.Return, functionName(fn))
+		}
+	}
+	return signature
+}
+
+func (c *Checker) checkCall(call *ast.CallExpression) Type {
+	callee := c.checkExpression(call.Function)
+
+	args := []Type{}
+	for _, a := range call.Arguments {
+		args = append(args, c.checkExpression(a))
+	}
+	for _, v := range call.KeywordValues {
+		c.checkExpression(v)
+	}
+
+	fn, ok := callee.(*Function)
+	if !ok {
+		if callee != Any {
+			c.errorf("calling non-function: %s", callee)
+		}
+		return Any
+	}
+
+	name := "function"
+	if ident, ok := call.Function.(*ast.Identifier); ok {
+		name = ident.Value
+	} else if lit, ok := call.Function.(*ast.FunctionLiteral); ok {
+		name = functionName(lit)
+	}
+
+	// keyword arguments go by name, which function types don't record
+	if fn.Parameters != nil && len(call.Keywords) == 0 {
+		if len(args) != len(fn.Parameters) {
+			c.errorf("wrong number of arguments to %s: want=%d, got=%d",
+				name, len(fn.Parameters), len(args))
+			return fn.Return
+		}
+
+		for i, arg := range args {
+			if !assignable(arg, fn.Parameters[i]) {
+				c.errorf("cannot use %s as %s in argument %d to %s",
+					arg, fn.Parameters[i], i+1, name)
+			}
+		}
+	}
+
+	if builtins[name] == callee {
+		if len(call.Keywords) > 0 {
+			c.errorf("builtin functions don't take keyword arguments")
+			return fn.Return
+		}
+		return c.checkBuiltinCall(name, args)
+	}
+	return fn.Return
+}
+
+// checkBuiltinCall refines the result of builtins whose type depends on
+// their arguments.
+func (c *Checker) checkBuiltinCall(name string, args []Type) Type {
+	switch name {
+	case "len":
+		switch args[0].(type) {
+		case *Array:
+			return Int
+		}
+		if args[0] != Any && args[0] != String {
+			c.errorf("argument to `len` not supported, got %s", args[0])
+		}
+		return Int
+	case "abs":
+		if numeric(args[0]) {
+			return args[0]
+		}
+	case "first", "last":
+		if array, ok := args[0].(*Array); ok {
+			return array.Element
+		}
+	case "rest":
+		if array, ok := args[0].(*Array); ok {
+			return array
+		}
+	case "push":
+		if array, ok := args[0].(*Array); ok {
+			return &Array{Element: join(array.Element, args[1])}
+		}
+	case "map":
+		if fn, ok := args[1].(*Function); ok {
+			return &Array{Element: fn.Return}
+		}
+	case "keys":
+		if hash, ok := args[0].(*Hash); ok {
+			return &Array{Element: hash.Key}
+		}
+	case "values":
+		if hash, ok := args[0].(*Hash); ok {
+			return &Array{Element: hash.Value}
+		}
+	case "delete":
+		if hash, ok := args[0].(*Hash); ok {
+			return hash
+		}
+	case "filter", "sort", "sort_by", "reverse", "slice":
+		if len(args) > 0 {
+			if array, ok := args[0].(*Array); ok {
+				return array
+			}
+		}
+	}
+
+	return builtins[name].(*Function).Return
+}
+
+func functionName(fn *ast.FunctionLiteral) string {
+	if fn.Name != "" {
+		return fn.Name
+	}
+	return "function"
+}
@@ -0,0 +1,159 @@
+package checker
+
+import (
+	"testing"
+	"turtle/ast"
+	"turtle/lexer"
+	"turtle/parser"
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`1 + 2`, []string{}},
+		{`"a" + "b"`, []string{}},
+		{`1 + "a"`, []string{"type mismatch: int + string"}},
+		{`"a" - "b"`, []string{"unknown operator: string - string"}},
+		{`-"a"`, []string{"unknown operator: -string"}},
+		{`true > false`, []string{"unknown operator: bool > bool"}},
+		{`1 == "a"`, []string{}},
+		{`let x = 1; let y = x + "a";`, []string{"type mismatch: int + string"}},
+		{`let x: int = 1;`, []string{}},
+		{`let x: int = "a";`, []string{"cannot use string as int in let x"}},
+		{`let x: string = 1; x + 1`, []string{
+			"cannot use int as string in let x",
+			"type mismatch: string + int",
+		}},
+		{`let x: [int] = [1, 2]; x[0] + 1`, []string{}},
+		{`let x: [string] = [1, 2];`, []string{"cannot use [int] as [string] in let x"}},
+		{`let x: number = 1;`, []string{"unknown type number"}},
+		{`let x: any = 1; x + "a"`, []string{}},
+		{`fn(a, b) { a + b }(1, "a")`, []string{}},
+		{`let f = fn(a: string): int { len(a) }; f("a")`, []string{}},
+		{`let f = fn(a: string): int { a }`, []string{"cannot use string as int in return from f"}},
+		{`let f = fn(a: int): int { if (a > 0) { return "a"; } 1 }`, []string{
+			"cannot use string as int in return from f",
+		}},
+		{`let f = fn(a: string) { a }; f(1)`, []string{"cannot use int as string in argument 1 to f"}},
+		{`let f = fn(a) { a }; f(1, 2)`, []string{"wrong number of arguments to f: want=1, got=2"}},
+		{`fn() { 1 }(1)`, []string{"wrong number of arguments to function: want=0, got=1"}},
+		{`let f = fn() { 1 }; f() + "a"`, []string{"type mismatch: int + string"}},
+		{`let f = fn(x) { if (x == 0) { 0 } else { f(x - 1) } }; f(1) + "a"`, []string{}},
+		{`let f = fn(x: int): int { if (x == 0) { 0 } else { f(x - 1) } }; f(1) + "a"`, []string{
+			"type mismatch: int + string",
+		}},
+		{`len(1)`, []string{"argument to `len` not supported, got int"}},
+		{`len("a", "b")`, []string{"wrong number of arguments to len: want=1, got=2"}},
+		{`first([1, 2]) + "a"`, []string{"type mismatch: int + string"}},
+		{`first(1)`, []string{"cannot use int as [any] in argument 1 to first"}},
+		{`puts(1, "a", true)`, []string{}},
+		{`map([1, 2], fn(x: int): string { "a" })[0] + 1`, []string{"type mismatch: string + int"}},
+		{`filter(["a"], fn(x) { true })[0] - 1`, []string{"type mismatch: string - int"}},
+		{`map(1, fn(x) { x })`, []string{"cannot use int as [any] in argument 1 to map"}},
+		{`keys({"a": 1})[0] + 1`, []string{"type mismatch: string + int"}},
+		{`values({"a": 1})[0] + 1`, []string{}},
+		{`has([1], 1)`, []string{"cannot use [int] as hash in argument 1 to has"}},
+		{`range(1, 5)[0] + "a"`, []string{"type mismatch: int + string"}},
+		{`1[0]`, []string{"index operator not supported: int"}},
+		{`"abc"[0] + 1`, []string{"type mismatch: string + int"}},
+		{`"abc"["a"]`, []string{"string index must be int, got string"}},
+		{`split("a,b", ",")[0] + 1`, []string{"type mismatch: string + int"}},
+		{`int("1") + "a"`, []string{"type mismatch: int + string"}},
+		{`float(1) * 2 + "a"`, []string{"type mismatch: float + string"}},
+		{`float(1) < 2`, []string{}},
+		{`-float(1) + 1`, []string{}},
+		{`let f = fn(x: float): float { x }; f(int("1"))`, []string{"cannot use int as float in argument 1 to f"}},
+		{`PI + "a"`, []string{"type mismatch: float + string"}},
+		{`floor(PI) + abs(1) + "a"`, []string{"type mismatch: int + string"}},
+		{`gcd(1, "a")`, []string{"cannot use string as int in argument 2 to gcd"}},
+		{`upper(1)`, []string{"cannot use int as string in argument 1 to upper"}},
+		{`repeat("a", "b")`, []string{"cannot use string as int in argument 2 to repeat"}},
+		{`[1, 2]["a"]`, []string{"array index must be int, got string"}},
+		{`{"a": 1}["a"] + 1`, []string{}},
+		{`{"a": 1}[[1]]`, []string{"unusable as hash key: [int]"}},
+		{`{[1]: 1}`, []string{"unusable as hash key: [int]"}},
+		{`let x = 1; x(1)`, []string{"calling non-function: int"}},
+		{`if (true) { 1 } else { "a" } + 1`, []string{}},
+		{`try { 1 } catch (e) { 2 } + "a"`, []string{"type mismatch: int + string"}},
+		{`try { 1 } catch (e) { e } + "a"`, []string{}},
+		{`try { 1 } finally { 1 + "a" }`, []string{"type mismatch: int + string"}},
+		{`throw 1 + "a"`, []string{"type mismatch: int + string"}},
+		{`match 1 { 1 => 2, n => n } + "a"`, []string{"type mismatch: int + string"}},
+		{`match [1, 2] { [a, ...r] => a + "b" }`, []string{"type mismatch: int + string"}},
+		{`match [1, 2] { [a, ...r] => r + 1 }`, []string{"type mismatch: [int] + int"}},
+		{`match {"a": "s"} { {"a": a} => a + 1, _ => 1 }`, []string{"type mismatch: string + int"}},
+		{`match 1 { n if n + "a" => 1 }`, []string{"type mismatch: int + string"}},
+		{`match 1 { 1 => 2 } + 1`, []string{}},
+		{`let x = "s"; match 1 { x => x }; len(x)`, []string{}},
+		{`let x = "s"; try { 1 } catch (x) { x }; x + 1`, []string{"type mismatch: string + int"}},
+		{`let [a, b] = [1, 2]; a + "s"`, []string{"type mismatch: int + string"}},
+		{`let [a, ...r] = ["s"]; r + 1`, []string{"type mismatch: [string] + int"}},
+		{`let {"k": v} = {"k": 1}; v + "s"`, []string{"type mismatch: int + string"}},
+		{`let [a] = 1;`, []string{"cannot destructure int into [a]"}},
+		{`let {"k": v} = [1];`, []string{"cannot destructure [int] into {k:v}"}},
+		{`let f = fn(x) { let [a] = x; a + "s" }`, []string{}},
+		{`let f = fn(a: int = "s") { a }`, []string{"cannot use string as int in default of a"}},
+		{`let f = fn(a: int, b = a + "s") { b }`, []string{"type mismatch: int + string"}},
+		{`let f = fn(a, b = 1) { a }; f(1); f(1, 2)`, []string{}},
+		{`let f = fn(...xs) { xs + 1 }`, []string{"type mismatch: [any] + int"}},
+		{`let f = fn(a: int, b: int) { a }; f(b = 1, a = 2)`, []string{}},
+		{`len(x = "s")`, []string{"builtin functions don't take keyword arguments"}},
+		{`"${1}" + 1`, []string{"type mismatch: string + int"}},
+		{`"${1 + "a"}"`, []string{"type mismatch: int + string"}},
+		{`(1..3)[0] + "a"`, []string{"type mismatch: int + string"}},
+		{`1.."a"`, []string{"range bounds must be int, got string"}},
+		{`[1, 2][1:] + 1`, []string{"type mismatch: [int] + int"}},
+		{`"abc"[1:] + 1`, []string{"type mismatch: string + int"}},
+		{`[1][:"a"]`, []string{"slice bounds must be int, got string"}},
+		{`{"a": 1}[1:]`, []string{"slice operator not supported: {string: int}"}},
+		{`let g = fn() { yield 1 }; g() + 1`, []string{"type mismatch: iterator + int"}},
+		{`let g = fn(): iterator { yield ...[1]; 2 }; collect(take(g(), 1))`, []string{}},
+		{`let g = fn(): int { yield 1 }`, []string{"cannot use iterator as int in return from g"}},
+		{`let g = fn() { yield ...5 }`, []string{"cannot yield from int"}},
+		{`next([1])`, []string{"cannot use [int] as iterator in argument 1 to next"}},
+		{`take(iter([1]), "a")`, []string{"cannot use string as int in argument 2 to take"}},
+	}
+
+	for _, tt := range tests {
+		errors := New().Check(parse(t, tt.input))
+
+		if len(errors) != len(tt.expected) {
+			t.Errorf("wrong number of errors for %q. want=%q, got=%q",
+				tt.input, tt.expected, errors)
+			continue
+		}
+
+		for i, want := range tt.expected {
+			if errors[i] != want {
+				t.Errorf("wrong error for %q. want=%q, got=%q",
+					tt.input, want, errors[i])
+			}
+		}
+	}
+}
+
+func TestCheckKeepsGlobals(t *testing.T) {
+	c := New()
+
+	errors := c.Check(parse(t, `let name: string = "turtle";`))
+	if len(errors) != 0 {
+		t.Fatalf("unexpected errors: %q", errors)
+	}
+
+	errors = c.Check(parse(t, `name - 1`))
+	if len(errors) != 1 || errors[0] != "type mismatch: string - int" {
+		t.Errorf("wrong errors. got=%q", errors)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %q", input, p.Errors())
+	}
+	return program
+}
@@ -0,0 +1,256 @@
+package checker
+
+import (
+	"strings"
+	"turtle/ast"
+)
+
+type Type interface {
+	String() string
+}
+
+type Basic struct {
+	Name string
+}
+
+func (b *Basic) String() string { return b.Name }
+
+var (
+	Int    = &Basic{Name: "int"}
+	Float  = &Basic{Name: "float"}
+	String = &Basic{Name: "string"}
+	Bool   = &Basic{Name: "bool"}
+	Null   = &Basic{Name: "null"}
+
+	// Any is the type of everything the checker cannot say anything about.
+	// It is compatible with every other type.
+	Any = &Basic{Name: "any"}
+
+	// Iterator is the type of iterators, whatever values they produce.
+	Iterator = &Basic{Name: "iterator"}
+)
+
+type Array struct {
+	Element Type
+}
+
+func (a *Array) String() string { return "[" + a.Element.String() + "]" }
+
+type Hash struct {
+	Key   Type
+	Value Type
+}
+
+func (h *Hash) String() string {
+	if h.Key == Any && h.Value == Any {
+		return "hash"
+	}
+	return "{" + h.Key.String() + ": " + h.Value.String() + "}"
+}
+
+// Function describes a callable value. Parameters is nil when the arity is
+// not known, as for the `fn` annotation or variadic builtins like puts.
+type Function struct {
+	Parameters []Type
+	Return     Type
+}
+
+func (f *Function) String() string {
+	if f.Parameters == nil {
+		return "fn"
+	}
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+	return "fn(" + strings.Join(params, ", ") + "): " + f.Return.String()
+}
+
+func identical(a, b Type) bool {
+	return a.String() == b.String()
+}
+
+// assignable reports whether a value of type from can be used where a value
+// of type to is expected.
+func assignable(from, to Type) bool {
+	if from == Any || to == Any || identical(from, to) {
+		return true
+	}
+
+	switch to := to.(type) {
+	case *Array:
+		from, ok := from.(*Array)
+		return ok && assignable(from.Element, to.Element)
+	case *Hash:
+		from, ok := from.(*Hash)
+		return ok && assignable(from.Key, to.Key) && assignable(from.Value, to.Value)
+	case *Function:
+		from, ok := from.(*Function)
+		if !ok {
+			return false
+		}
+		if to.Parameters == nil || from.Parameters == nil {
+			return true
+		}
+		if len(to.Parameters) != len(from.Parameters) {
+			return false
+		}
+		for i := range to.Parameters {
+			if !assignable(to.Parameters[i], from.Parameters[i]) {
+				return false
+			}
+		}
+		return assignable(from.Return, to.Return)
+	}
+
+	return false
+}
+
+// join returns the type of a value that is either a or b.
+func join(a, b Type) Type {
+	if identical(a, b) {
+		return a
+	}
+	return Any
+}
+
+func numeric(t Type) bool {
+	return t == Int || t == Float
+}
+
+func hashable(t Type) bool {
+	return t == Any || t == Int || t == String || t == Bool
+}
+
+var annotations = map[string]Type{
+	"int":      Int,
+	"float":    Float,
+	"string":   String,
+	"bool":     Bool,
+	"null":     Null,
+	"any":      Any,
+	"iterator": Iterator,
+	"array":    &Array{Element: Any},
+	"hash":     &Hash{Key: Any, Value: Any},
+	"fn":       &Function{Return: Any},
+}
+
+var builtins = map[string]Type{
+	"len":   &Function{Parameters: []Type{Any}, Return: Int},
+	"puts":  &Function{Return: Null},
+	"first": &Function{Parameters: []Type{&Array{Element: Any}}, Return: Any},
+	"last":  &Function{Parameters: []Type{&Array{Element: Any}}, Return: Any},
+	"rest":  &Function{Parameters: []Type{&Array{Element: Any}}, Return: Any},
+	"push":  &Function{Parameters: []Type{&Array{Element: Any}, Any}, Return: &Array{Element: Any}},
+	"gets":  &Function{Parameters: []Type{}, Return: Any},
+	"warn":  &Function{Return: Null},
+
+	"map":       &Function{Parameters: []Type{&Array{Element: Any}, anyFunction}, Return: &Array{Element: Any}},
+	"filter":    &Function{Parameters: []Type{&Array{Element: Any}, anyFunction}, Return: &Array{Element: Any}},
+	"reduce":    &Function{Return: Any},
+	"sort":      &Function{Return: &Array{Element: Any}},
+	"sort_by":   &Function{Parameters: []Type{&Array{Element: Any}, anyFunction}, Return: &Array{Element: Any}},
+	"zip":       &Function{Return: &Array{Element: &Array{Element: Any}}},
+	"enumerate": &Function{Parameters: []Type{&Array{Element: Any}}, Return: &Array{Element: &Array{Element: Any}}},
+	"any":       &Function{Return: Bool},
+	"all":       &Function{Return: Bool},
+	"range":     &Function{Return: &Array{Element: Int}},
+	"reverse":   &Function{Parameters: []Type{&Array{Element: Any}}, Return: &Array{Element: Any}},
+	"concat":    &Function{Return: &Array{Element: Any}},
+	"slice":     &Function{Return: &Array{Element: Any}},
+
+	"keys":    &Function{Parameters: []Type{&Hash{Key: Any, Value: Any}}, Return: &Array{Element: Any}},
+	"values":  &Function{Parameters: []Type{&Hash{Key: Any, Value: Any}}, Return: &Array{Element: Any}},
+	"entries": &Function{Parameters: []Type{&Hash{Key: Any, Value: Any}}, Return: &Array{Element: &Array{Element: Any}}},
+	"has":     &Function{Parameters: []Type{&Hash{Key: Any, Value: Any}, Any}, Return: Bool},
+	"delete":  &Function{Parameters: []Type{&Hash{Key: Any, Value: Any}, Any}, Return: &Hash{Key: Any, Value: Any}},
+	"merge":   &Function{Return: &Hash{Key: Any, Value: Any}},
+
+	"split":       &Function{Parameters: []Type{String, String}, Return: &Array{Element: String}},
+	"join":        &Function{Parameters: []Type{&Array{Element: Any}, String}, Return: String},
+	"trim":        &Function{Parameters: []Type{String}, Return: String},
+	"upper":       &Function{Parameters: []Type{String}, Return: String},
+	"lower":       &Function{Parameters: []Type{String}, Return: String},
+	"contains":    &Function{Parameters: []Type{String, String}, Return: Bool},
+	"starts_with": &Function{Parameters: []Type{String, String}, Return: Bool},
+	"ends_with":   &Function{Parameters: []Type{String, String}, Return: Bool},
+	"replace":     &Function{Parameters: []Type{String, String, String}, Return: String},
+	"index_of":    &Function{Parameters: []Type{String, String}, Return: Int},
+	"substr":      &Function{Return: String},
+	"repeat":      &Function{Parameters: []Type{String, Int}, Return: String},
+	"chars":       &Function{Parameters: []Type{String}, Return: &Array{Element: String}},
+	"format":      &Function{Return: String},
+	"sprintf":     &Function{Return: String},
+
+	"type":        &Function{Parameters: []Type{Any}, Return: String},
+	"int":         &Function{Parameters: []Type{Any}, Return: Int},
+	"float":       &Function{Parameters: []Type{Any}, Return: Float},
+	"str":         &Function{Parameters: []Type{Any}, Return: String},
+	"bool":        &Function{Parameters: []Type{Any}, Return: Bool},
+	"is_int":      &Function{Parameters: []Type{Any}, Return: Bool},
+	"is_float":    &Function{Parameters: []Type{Any}, Return: Bool},
+	"is_string":   &Function{Parameters: []Type{Any}, Return: Bool},
+	"is_bool":     &Function{Parameters: []Type{Any}, Return: Bool},
+	"is_null":     &Function{Parameters: []Type{Any}, Return: Bool},
+	"is_array":    &Function{Parameters: []Type{Any}, Return: Bool},
+	"is_hash":     &Function{Parameters: []Type{Any}, Return: Bool},
+	"is_function": &Function{Parameters: []Type{Any}, Return: Bool},
+
+	"abs":        &Function{Parameters: []Type{Any}, Return: Any},
+	"min":        &Function{Return: Any},
+	"max":        &Function{Return: Any},
+	"pow":        &Function{Parameters: []Type{Any, Any}, Return: Any},
+	"sqrt":       &Function{Parameters: []Type{Any}, Return: Float},
+	"floor":      &Function{Parameters: []Type{Any}, Return: Int},
+	"ceil":       &Function{Parameters: []Type{Any}, Return: Int},
+	"round":      &Function{Parameters: []Type{Any}, Return: Int},
+	"clamp":      &Function{Parameters: []Type{Any, Any, Any}, Return: Any},
+	"gcd":        &Function{Parameters: []Type{Int, Int}, Return: Int},
+	"random":     &Function{Parameters: []Type{}, Return: Float},
+	"random_int": &Function{Return: Int},
+	"seed":       &Function{Parameters: []Type{Int}, Return: Null},
+
+	"json_parse":     &Function{Parameters: []Type{String}, Return: Any},
+	"json_stringify": &Function{Return: String},
+
+	"read_file":  &Function{Parameters: []Type{String}, Return: String},
+	"write_file": &Function{Parameters: []Type{String, String}, Return: Null},
+	"list_dir":   &Function{Parameters: []Type{String}, Return: &Array{Element: String}},
+	"getenv":     &Function{Parameters: []Type{String}, Return: Any},
+	"args":       &Function{Parameters: []Type{}, Return: &Array{Element: String}},
+	"exit":       &Function{Return: Null},
+
+	"iter":        &Function{Parameters: []Type{Any}, Return: Iterator},
+	"next":        &Function{Parameters: []Type{Iterator}, Return: &Hash{Key: String, Value: Any}},
+	"collect":     &Function{Parameters: []Type{Any}, Return: &Array{Element: Any}},
+	"take":        &Function{Parameters: []Type{Any, Int}, Return: Iterator},
+	"map_iter":    &Function{Parameters: []Type{Any, anyFunction}, Return: Iterator},
+	"filter_iter": &Function{Parameters: []Type{Any, anyFunction}, Return: Iterator},
+}
+
+// constants are the types of object.Constants.
+var constants = map[string]Type{
+	"PI": Float,
+	"E":  Float,
+}
+
+// anyFunction is the type of a function argument of a builtin.
+var anyFunction = &Function{Return: Any}
+
+func (c *Checker) resolveAnnotation(a *ast.TypeAnnotation) Type {
+	if a == nil {
+		return Any
+	}
+
+	if a.Element != nil {
+		return &Array{Element: c.resolveAnnotation(a.Element)}
+	}
+
+	t, ok := annotations[a.Name]
+	if !ok {
+		c.errorf("unknown type %s", a.Name)
+		return Any
+	}
+	return t
+}
@@ -41,6 +41,39 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
+	OpDup
+	OpTry    // run the handler at the operand if what follows throws
+	OpEndTry // leave the innermost try
+	OpThrow
+	OpCatch      // turn the exception a handler got into what its catch binds
+	OpMatchValue // test a value against a literal pattern
+	OpMatchArray // test the length of an array against an array pattern
+	OpMatchHash  // test a hash for the keys of a hash pattern
+	OpSlice
+	OpMismatch     // fail destructuring a value with the pattern at the operand
+	OpJumpPassed   // jump if the argument for a local was passed, skipping its default
+	OpCallKeywords // call with keyword arguments, named by the constant at the operand
+	OpConcat       // join the operand values on top of the stack into a string
+	OpRange        // build the array of a range, including its end if the operand is 1
+	OpYield        // suspend the generator with a value, see the Yield operands
+	// Superinstructions, only emitted when specialization is turned on.
+	OpLessThan
+	OpGetLocal0
+	OpAddConst
+	OpSubConst
+	OpEqualJump       // jump unless the two operands are equal
+	OpNotEqualJump    // jump unless the two operands differ
+	OpGreaterThanJump // jump unless left > right
+	OpLessThanJump    // jump unless left < right
+	OpCallGlobal
+)
+
+// The operands of OpYield: whether it yields the value on top of the stack
+// or each value of it, and if the latter, whether the generator ends there.
+const (
+	YieldValue = iota
+	YieldEach
+	YieldTail
 )
 
 type Definition struct {
@@ -79,6 +112,31 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpDup:            {"OpDup", []int{}},
+	OpTry:            {"OpTry", []int{2}},
+	OpEndTry:         {"OpEndTry", []int{}},
+	OpThrow:          {"OpThrow", []int{}},
+	OpCatch:          {"OpCatch", []int{}},
+	OpMatchValue:     {"OpMatchValue", []int{}},
+	OpMatchArray:     {"OpMatchArray", []int{2, 1}},
+	OpMatchHash:      {"OpMatchHash", []int{2}},
+	OpSlice:          {"OpSlice", []int{}},
+	OpMismatch:       {"OpMismatch", []int{2}},
+	OpJumpPassed:     {"OpJumpPassed", []int{2, 1}},
+	OpCallKeywords:   {"OpCallKeywords", []int{1, 2}},
+	OpConcat:         {"OpConcat", []int{2}},
+	OpRange:          {"OpRange", []int{1}},
+	OpYield:          {"OpYield", []int{1}},
+
+	OpLessThan:        {"OpLessThan", []int{}},
+	OpGetLocal0:       {"OpGetLocal0", []int{}},
+	OpAddConst:        {"OpAddConst", []int{2}},
+	OpSubConst:        {"OpSubConst", []int{2}},
+	OpEqualJump:       {"OpEqualJump", []int{2}},
+	OpNotEqualJump:    {"OpNotEqualJump", []int{2}},
+	OpGreaterThanJump: {"OpGreaterThanJump", []int{2}},
+	OpLessThanJump:    {"OpLessThanJump", []int{2}},
+	OpCallGlobal:      {"OpCallGlobal", []int{2, 1}},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -0,0 +1,234 @@
+package code
+
+// decodedInstruction is a single instruction pulled out of an Instructions
+// slice, remembering the offset it was read from so jumps can be re-patched.
+type decodedInstruction struct {
+	op       Opcode
+	operands []int
+	pos      int
+	removed  bool
+}
+
+func (d *decodedInstruction) width() int {
+	def := definitions[d.op]
+	width := 1
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	return width
+}
+
+// Optimize runs a peephole pass over ins until nothing else can be removed.
+// It threads jump-to-jump chains, folds constant conditions in front of
+// OpJumpNotTruthy, turns OpSet/OpGet pairs on the same slot into OpDup,
+// drops unreachable code after returns, jumps and throws, and removes
+// values that are pushed only to be popped again. Jump targets, including
+// those of OpTry, are re-patched to the new offsets. The trailing OpPop of
+// a stream is kept so that the VM's last popped element stays the same.
+func Optimize(ins Instructions) Instructions {
+	for {
+		decoded := decode(ins)
+		if !optimizePass(decoded) {
+			return ins
+		}
+		ins = encode(decoded)
+	}
+}
+
+// IsJump reports whether the first operand of op is an instruction offset.
+func IsJump(op Opcode) bool {
+	switch op {
+	case OpJump, OpJumpNotTruthy, OpTry, OpJumpPassed,
+		OpEqualJump, OpNotEqualJump, OpGreaterThanJump, OpLessThanJump:
+		return true
+	}
+	return false
+}
+
+func decode(ins Instructions) []*decodedInstruction {
+	decoded := []*decodedInstruction{}
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			return decoded
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+		decoded = append(decoded, &decodedInstruction{
+			op:       Opcode(ins[i]),
+			operands: operands,
+			pos:      i,
+		})
+
+		i += 1 + read
+	}
+
+	return decoded
+}
+
+func encode(decoded []*decodedInstruction) Instructions {
+	newPositions := make(map[int]int, len(decoded)+1)
+
+	offset := 0
+	for _, d := range decoded {
+		newPositions[d.pos] = offset
+		if !d.removed {
+			offset += d.width()
+		}
+	}
+	if len(decoded) > 0 {
+		last := decoded[len(decoded)-1]
+		newPositions[last.pos+last.width()] = offset
+	}
+
+	out := Instructions{}
+	for _, d := range decoded {
+		if d.removed {
+			continue
+		}
+
+		operands := d.operands
+		if IsJump(d.op) {
+			operands = append([]int{newPositions[operands[0]]}, operands[1:]...)
+		}
+		out = append(out, Make(d.op, operands...)...)
+	}
+
+	return out
+}
+
+func optimizePass(decoded []*decodedInstruction) bool {
+	changed := false
+
+	byPos := make(map[int]*decodedInstruction, len(decoded))
+	targets := make(map[int]bool)
+	for _, d := range decoded {
+		byPos[d.pos] = d
+		if IsJump(d.op) {
+			targets[d.operands[0]] = true
+		}
+	}
+
+	isTarget := func(d *decodedInstruction) bool { return targets[d.pos] }
+
+	// jump-to-jump chains
+	for _, d := range decoded {
+		if !IsJump(d.op) {
+			continue
+		}
+
+		target := d.operands[0]
+		seen := map[int]bool{d.pos: true}
+		for {
+			next, ok := byPos[target]
+			if !ok || next.op != OpJump || seen[next.pos] {
+				break
+			}
+			seen[next.pos] = true
+			target = next.operands[0]
+		}
+
+		if target != d.operands[0] {
+			d.operands = []int{target}
+			changed = true
+		}
+	}
+
+	// unreachable code after an unconditional transfer of control
+	for i := 0; i < len(decoded); i++ {
+		switch decoded[i].op {
+		case OpReturnValue, OpReturn, OpJump, OpThrow, OpMismatch:
+		default:
+			continue
+		}
+
+		for j := i + 1; j < len(decoded) && !isTarget(decoded[j]); j++ {
+			decoded[j].removed = true
+			changed = true
+			i = j
+		}
+	}
+
+	live := []*decodedInstruction{}
+	for _, d := range decoded {
+		if !d.removed {
+			live = append(live, d)
+		}
+	}
+
+	for i := 0; i < len(live); i++ {
+		cur := live[i]
+
+		// a jump to the very next instruction does nothing
+		if cur.op == OpJump && cur.operands[0] == cur.pos+cur.width() {
+			cur.removed = true
+			changed = true
+			continue
+		}
+
+		if i+1 >= len(live) {
+			continue
+		}
+		next := live[i+1]
+		if isTarget(next) {
+			continue
+		}
+
+		switch {
+		case cur.op == OpTrue && next.op == OpJumpNotTruthy:
+			cur.removed = true
+			next.removed = true
+			changed = true
+			i++
+
+		case (cur.op == OpFalse || cur.op == OpNull) && next.op == OpJumpNotTruthy:
+			cur.removed = true
+			next.op = OpJump
+			changed = true
+			i++
+
+		case isStore(cur.op) && next.op == loadFor(cur.op) && next.operands[0] == cur.operands[0]:
+			if i+2 < len(live) && i+2 != len(live)-1 && live[i+2].op == OpPop && !isTarget(live[i+2]) {
+				next.removed = true
+				live[i+2].removed = true
+				i += 2
+			} else {
+				next.op = cur.op
+				cur.op = OpDup
+				cur.operands = []int{}
+				i++
+			}
+			changed = true
+
+		case isPurePush(cur.op) && next.op == OpPop && i+1 != len(live)-1:
+			cur.removed = true
+			next.removed = true
+			changed = true
+			i++
+		}
+	}
+
+	return changed
+}
+
+func isStore(op Opcode) bool {
+	return op == OpSetGlobal || op == OpSetLocal
+}
+
+func loadFor(store Opcode) Opcode {
+	if store == OpSetGlobal {
+		return OpGetGlobal
+	}
+	return OpGetLocal
+}
+
+func isPurePush(op Opcode) bool {
+	switch op {
+	case OpConstant, OpTrue, OpFalse, OpNull, OpDup,
+		OpGetGlobal, OpGetLocal, OpGetBuiltin, OpGetFree, OpCurrentClosure:
+		return true
+	}
+	return false
+}
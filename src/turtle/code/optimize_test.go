@@ -0,0 +1,184 @@
+package code
+
+import "testing"
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Instructions
+		expected []Instructions
+	}{
+		{
+			name: "jump to jump",
+			input: []Instructions{
+				Make(OpTrue),             // 0000
+				Make(OpJumpNotTruthy, 7), // 0001
+				Make(OpConstant, 0),      // 0004
+				Make(OpJump, 10),         // 0007
+				Make(OpJump, 13),         // 0010
+				Make(OpGetGlobal, 0),     // 0013
+				Make(OpSetGlobal, 1),     // 0016
+				Make(OpGetLocal, 0),      // 0019
+				Make(OpReturnValue),      // 0021
+			},
+			expected: []Instructions{
+				Make(OpConstant, 0),  // 0000
+				Make(OpGetGlobal, 0), // 0003
+				Make(OpSetGlobal, 1), // 0006
+				Make(OpGetLocal, 0),  // 0009
+				Make(OpReturnValue),  // 0011
+			},
+		},
+		{
+			name: "true then jump not truthy",
+			input: []Instructions{
+				Make(OpTrue),             // 0000
+				Make(OpJumpNotTruthy, 7), // 0001
+				Make(OpConstant, 0),      // 0004
+				Make(OpPop),              // 0007
+			},
+			expected: []Instructions{
+				Make(OpConstant, 0),
+				Make(OpPop),
+			},
+		},
+		{
+			name: "false then jump not truthy",
+			input: []Instructions{
+				Make(OpGetGlobal, 0),      // 0000
+				Make(OpFalse),             // 0003
+				Make(OpJumpNotTruthy, 10), // 0004
+				Make(OpConstant, 0),       // 0007
+				Make(OpConstant, 1),       // 0010
+				Make(OpPop),               // 0013
+			},
+			expected: []Instructions{
+				Make(OpGetGlobal, 0), // 0000
+				Make(OpConstant, 1),  // 0003
+				Make(OpPop),          // 0006
+			},
+		},
+		{
+			name: "set then get global",
+			input: []Instructions{
+				Make(OpConstant, 0),
+				Make(OpSetGlobal, 0),
+				Make(OpGetGlobal, 0),
+				Make(OpConstant, 1),
+				Make(OpAdd),
+				Make(OpPop),
+			},
+			expected: []Instructions{
+				Make(OpConstant, 0),
+				Make(OpDup),
+				Make(OpSetGlobal, 0),
+				Make(OpConstant, 1),
+				Make(OpAdd),
+				Make(OpPop),
+			},
+		},
+		{
+			name: "set then get local then pop",
+			input: []Instructions{
+				Make(OpConstant, 0),
+				Make(OpSetLocal, 0),
+				Make(OpGetLocal, 0),
+				Make(OpPop),
+				Make(OpGetLocal, 0),
+				Make(OpReturnValue),
+			},
+			expected: []Instructions{
+				Make(OpConstant, 0),
+				Make(OpDup),
+				Make(OpSetLocal, 0),
+				Make(OpReturnValue),
+			},
+		},
+		{
+			name: "different slots are left alone",
+			input: []Instructions{
+				Make(OpConstant, 0),
+				Make(OpSetGlobal, 0),
+				Make(OpGetGlobal, 1),
+				Make(OpPop),
+			},
+			expected: []Instructions{
+				Make(OpConstant, 0),
+				Make(OpSetGlobal, 0),
+				Make(OpGetGlobal, 1),
+				Make(OpPop),
+			},
+		},
+		{
+			name: "dead code after return",
+			input: []Instructions{
+				Make(OpGetLocal, 0),       // 0000
+				Make(OpJumpNotTruthy, 15), // 0002
+				Make(OpConstant, 0),       // 0005
+				Make(OpReturnValue),       // 0008
+				Make(OpJump, 18),          // 0009
+				Make(OpConstant, 1),       // 0012 (unreachable)
+				Make(OpConstant, 2),       // 0015
+				Make(OpReturnValue),       // 0018
+			},
+			expected: []Instructions{
+				Make(OpGetLocal, 0),      // 0000
+				Make(OpJumpNotTruthy, 9), // 0002
+				Make(OpConstant, 0),      // 0005
+				Make(OpReturnValue),      // 0008
+				Make(OpConstant, 2),      // 0009
+				Make(OpReturnValue),      // 0012
+			},
+		},
+		{
+			name: "redundant pops",
+			input: []Instructions{
+				Make(OpConstant, 0),
+				Make(OpPop),
+				Make(OpGetGlobal, 0),
+				Make(OpPop),
+				Make(OpConstant, 1),
+				Make(OpPop),
+			},
+			expected: []Instructions{
+				Make(OpConstant, 1),
+				Make(OpPop),
+			},
+		},
+		{
+			name: "side effects are kept",
+			input: []Instructions{
+				Make(OpGetBuiltin, 1),
+				Make(OpCall, 0),
+				Make(OpPop),
+				Make(OpConstant, 0),
+				Make(OpPop),
+			},
+			expected: []Instructions{
+				Make(OpGetBuiltin, 1),
+				Make(OpCall, 0),
+				Make(OpPop),
+				Make(OpConstant, 0),
+				Make(OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		expected := concat(tt.expected)
+		actual := Optimize(concat(tt.input))
+
+		if actual.String() != expected.String() {
+			t.Errorf("%s: wrong instructions.\nwant=\n%s\ngot=\n%s",
+				tt.name, expected, actual)
+		}
+	}
+}
+
+func concat(instructions []Instructions) Instructions {
+	out := Instructions{}
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+	return out
+}
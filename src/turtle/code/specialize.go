@@ -0,0 +1,66 @@
+package code
+
+// compareJumps maps a comparison followed by OpJumpNotTruthy to the single
+// instruction that does both without pushing the boolean.
+var compareJumps = map[Opcode]Opcode{
+	OpEqual:       OpEqualJump,
+	OpNotEqual:    OpNotEqualJump,
+	OpGreaterThan: OpGreaterThanJump,
+	OpLessThan:    OpLessThanJump,
+}
+
+// Specialize rewrites common instruction sequences into superinstructions:
+// OpGetLocal 0 becomes OpGetLocal0, a constant followed by OpAdd or OpSub
+// becomes OpAddConst or OpSubConst, and a comparison followed by
+// OpJumpNotTruthy becomes one of the compare-and-jump opcodes. A sequence is
+// left alone when a jump lands in the middle of it. Jump targets are
+// re-patched to the new offsets.
+func Specialize(ins Instructions) Instructions {
+	decoded := decode(ins)
+
+	targets := make(map[int]bool)
+	for _, d := range decoded {
+		if IsJump(d.op) {
+			targets[d.operands[0]] = true
+		}
+	}
+
+	for i := 0; i < len(decoded); i++ {
+		cur := decoded[i]
+
+		if cur.op == OpGetLocal && cur.operands[0] == 0 {
+			cur.op = OpGetLocal0
+			cur.operands = []int{}
+			continue
+		}
+
+		if i+1 >= len(decoded) {
+			continue
+		}
+		next := decoded[i+1]
+		if targets[next.pos] {
+			continue
+		}
+
+		switch {
+		case cur.op == OpConstant && next.op == OpAdd:
+			cur.op = OpAddConst
+			next.removed = true
+			i++
+
+		case cur.op == OpConstant && next.op == OpSub:
+			cur.op = OpSubConst
+			next.removed = true
+			i++
+
+		case next.op == OpJumpNotTruthy:
+			if jump, ok := compareJumps[cur.op]; ok {
+				next.op = jump
+				cur.removed = true
+				i++
+			}
+		}
+	}
+
+	return encode(decoded)
+}
@@ -0,0 +1,105 @@
+package code
+
+import "testing"
+
+func TestSpecialize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []Instructions
+		expected []Instructions
+	}{
+		{
+			name: "first local",
+			input: []Instructions{
+				Make(OpGetLocal, 0),
+				Make(OpGetLocal, 1),
+				Make(OpAdd),
+			},
+			expected: []Instructions{
+				Make(OpGetLocal0),
+				Make(OpGetLocal, 1),
+				Make(OpAdd),
+			},
+		},
+		{
+			name: "constant operand",
+			input: []Instructions{
+				Make(OpGetLocal, 1),
+				Make(OpConstant, 2),
+				Make(OpSub),
+				Make(OpConstant, 3),
+				Make(OpAdd),
+				Make(OpConstant, 4),
+				Make(OpMul),
+			},
+			expected: []Instructions{
+				Make(OpGetLocal, 1),
+				Make(OpSubConst, 2),
+				Make(OpAddConst, 3),
+				Make(OpConstant, 4),
+				Make(OpMul),
+			},
+		},
+		{
+			name: "compare and jump",
+			input: []Instructions{
+				Make(OpGetLocal, 0),       // 0000
+				Make(OpConstant, 0),       // 0002
+				Make(OpEqual),             // 0005
+				Make(OpJumpNotTruthy, 15), // 0006
+				Make(OpConstant, 1),       // 0009
+				Make(OpJump, 16),          // 0012
+				Make(OpNull),              // 0015
+				Make(OpPop),               // 0016
+			},
+			expected: []Instructions{
+				Make(OpGetLocal0),     // 0000
+				Make(OpConstant, 0),   // 0001
+				Make(OpEqualJump, 13), // 0004
+				Make(OpConstant, 1),   // 0007
+				Make(OpJump, 14),      // 0010
+				Make(OpNull),          // 0013
+				Make(OpPop),           // 0014
+			},
+		},
+		{
+			name: "less than jump",
+			input: []Instructions{
+				Make(OpTrue),             // 0000
+				Make(OpFalse),            // 0001
+				Make(OpLessThan),         // 0002
+				Make(OpJumpNotTruthy, 6), // 0003
+				Make(OpNull),             // 0006
+			},
+			expected: []Instructions{
+				Make(OpTrue),            // 0000
+				Make(OpFalse),           // 0001
+				Make(OpLessThanJump, 5), // 0002
+				Make(OpNull),            // 0005
+			},
+		},
+		{
+			name: "jump into the middle of a pair",
+			input: []Instructions{
+				Make(OpJump, 6),     // 0000
+				Make(OpConstant, 0), // 0003
+				Make(OpAdd),         // 0006
+			},
+			expected: []Instructions{
+				Make(OpJump, 6),     // 0000
+				Make(OpConstant, 0), // 0003
+				Make(OpAdd),         // 0006
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		expected := concat(tt.expected)
+		actual := Specialize(concat(tt.input))
+
+		if actual.String() != expected.String() {
+			t.Errorf("%s: wrong instructions.\nwant=\n%s\ngot=\n%s",
+				tt.name, expected, actual)
+		}
+	}
+}
@@ -2,9 +2,10 @@ package compiler
 
 import (
 	"fmt"
-	"sort"
+	"strings"
 	"turtle/ast"
 	"turtle/code"
+	"turtle/module"
 	"turtle/object"
 )
 
@@ -17,9 +18,34 @@ type Compiler struct {
 	constants []object.Object
 
 	symbolTable *SymbolTable
+	// rootTable is the global symbol table of the main program, where the
+	// value of each imported module is kept in a global of its own.
+	rootTable *SymbolTable
+
+	// loader reads imported modules, through host unless SetLoader was
+	// called. path is the file of the main program and loading holds the
+	// modules being compiled, outermost first.
+	loader  module.Loader
+	host    *object.Host
+	path    string
+	loading []string
 
 	scopes     []CompilationScope
 	scopeIndex int
+
+	optimize   bool
+	specialize bool
+
+	// subjects counts the match expressions and destructuring lets
+	// compiled, to give each the hidden variable of its own that holds the
+	// value it takes apart.
+	subjects int
+
+	// namedConstants maps the index of each of object.Constants used so far
+	// to where its value is in constants.
+	namedConstants map[int]int
+
+	warnings []string
 }
 
 func (c *Compiler) enterScope() {
@@ -48,6 +74,10 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+
+	// tries holds the finally block of each handler the code being
+	// compiled runs under, innermost last, or nil for a catch.
+	tries []*ast.BlockStatement
 }
 
 func New() *Compiler {
@@ -61,24 +91,140 @@ func New() *Compiler {
 	for i, b := range object.Builtins {
 		symbolTable.DefineBuiltin(i, b.Name)
 	}
+	for i, constant := range object.Constants {
+		symbolTable.DefineConstant(i, constant.Name)
+	}
 
 	return &Compiler{
 		constants:   []object.Object{},
 		symbolTable: symbolTable,
+		rootTable:   symbolTable,
+		host:        object.DefaultHost(),
 		scopes: []CompilationScope{
 			mainScope,
 		},
-		scopeIndex: 0,
+		scopeIndex:     0,
+		namedConstants: map[int]int{},
 	}
 }
 
 func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	compiler := New()
 	compiler.symbolTable = s
+	compiler.rootTable = s
 	compiler.constants = constants
+	for i, constant := range object.Constants {
+		for j, obj := range constants {
+			if obj == constant.Value {
+				compiler.namedConstants[i] = j
+				break
+			}
+		}
+	}
 	return compiler
 }
 
+// SetLoader sets what reads the source of imported modules. By default they
+// are read through the host.
+func (c *Compiler) SetLoader(loader module.Loader) {
+	c.loader = loader
+}
+
+// SetHost sets the host imported modules are read through, which must
+// grant object.CapReadFiles. It defaults to object.DefaultHost, which
+// doesn't.
+func (c *Compiler) SetHost(host *object.Host) {
+	c.host = host
+}
+
+// SetPath sets the file the program was read from, which relative imports
+// in it are resolved against.
+func (c *Compiler) SetPath(path string) {
+	c.path = path
+}
+
+// SetOptimize turns the peephole optimizer on or off. When on, every
+// function body and the main program are passed through code.Optimize.
+func (c *Compiler) SetOptimize(optimize bool) {
+	c.optimize = optimize
+}
+
+// SetSpecialize turns superinstructions on or off. When on, `<` is compiled
+// to OpLessThan, calls to global functions to OpCallGlobal, and every
+// function body and the main program are passed through code.Specialize
+// after any optimization.
+func (c *Compiler) SetSpecialize(specialize bool) {
+	c.specialize = specialize
+}
+
+// Warnings returns the diagnostics collected while compiling. They never stop
+// compilation: unused locals and parameters, code that follows a return and
+// bindings that shadow a builtin function.
+func (c *Compiler) Warnings() []string {
+	return c.warnings
+}
+
+func (c *Compiler) warn(format string, a ...interface{}) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, a...))
+}
+
+func (c *Compiler) define(name string) Symbol {
+	if c.symbolTable.IsBuiltin(name) {
+		c.warn("%s shadows builtin function", name)
+	}
+	return c.symbolTable.Define(name)
+}
+
+// enterBlock starts a block whose bindings shadow those around it and go
+// out of scope at leaveBlock, as in the environment the evaluator encloses
+// such a block in.
+func (c *Compiler) enterBlock() {
+	c.symbolTable = NewBlockSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveBlock() {
+	c.symbolTable = c.symbolTable.Outer
+}
+
+// bind returns the variable of the current scope called name, defining it
+// if there isn't one yet, so that binding a name twice in one scope reuses
+// its slot the way the evaluator reuses its environment entry.
+func (c *Compiler) bind(name string) Symbol {
+	symbol, ok := c.symbolTable.store[name]
+	if ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+	return c.define(name)
+}
+
+func (c *Compiler) checkUnreachable(statements []ast.Statement) {
+	for i, statement := range statements[:max(len(statements)-1, 0)] {
+		if _, ok := statement.(*ast.ReturnStatement); ok {
+			c.warn("unreachable code after return: %s", statements[i+1].String())
+			return
+		}
+	}
+}
+
+func (c *Compiler) checkUnused(fn *ast.FunctionLiteral) {
+	for _, symbol := range c.symbolTable.Unresolved() {
+		if strings.HasPrefix(symbol.Name, "_") {
+			continue
+		}
+
+		kind := "variable"
+		if symbol.Index < len(fn.Parameters) || fn.Rest != nil && symbol.Index == len(fn.Parameters) {
+			kind = "parameter"
+		}
+
+		if fn.Name != "" {
+			c.warn("unused %s %s in %s", kind, symbol.Name, fn.Name)
+		} else {
+			c.warn("unused %s %s", kind, symbol.Name)
+		}
+	}
+}
+
 func (c *Compiler) loadSymbol(s Symbol) {
 	switch s.Scope {
 	case GlobalScope:
@@ -87,6 +233,13 @@ func (c *Compiler) loadSymbol(s Symbol) {
 		c.emit(code.OpGetLocal, s.Index)
 	case BuiltinScope:
 		c.emit(code.OpGetBuiltin, s.Index)
+	case ConstantScope:
+		index, ok := c.namedConstants[s.Index]
+		if !ok {
+			index = c.addConstant(object.Constants[s.Index].Value)
+			c.namedConstants[s.Index] = index
+		}
+		c.emit(code.OpConstant, index)
 	case FreeScope:
 		c.emit(code.OpGetFree, s.Index)
 	case FunctionScope:
@@ -97,13 +250,18 @@ func (c *Compiler) loadSymbol(s Symbol) {
 func (c *Compiler) Compile(node ast.Node) error {
 	switch node := node.(type) {
 	case *ast.Program:
-		for _, statement := range node.Statements {
-			err := c.Compile(statement)
-			if err != nil {
-				return err
-			}
+		c.checkUnreachable(node.Statements)
+		err := c.compileTopLevel(node.Statements)
+		if err != nil {
+			return err
 		}
 
+	case *ast.ImportStatement:
+		return fmt.Errorf("import must be at the top level of a file")
+
+	case *ast.ExportStatement:
+		return fmt.Errorf("export must be at the top level of a file")
+
 	case *ast.ExpressionStatement:
 		err := c.Compile(node.Expression)
 		if err != nil {
@@ -119,7 +277,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 	case *ast.InfixExpression:
-		if node.Operator == "<" {
+		if node.Operator == "<" && !c.specialize {
 			err := c.Compile(node.Right)
 			if err != nil {
 				return err
@@ -144,6 +302,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		switch node.Operator {
+		case "<":
+			c.emit(code.OpLessThan)
 		case "+":
 			c.emit(code.OpAdd)
 		case "-":
@@ -207,6 +367,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.changeOperand(jumpPos, afterAlternativePos)
 
 	case *ast.BlockStatement:
+		c.checkUnreachable(node.Statements)
 		for _, statement := range node.Statements {
 			err := c.Compile(statement)
 			if err != nil {
@@ -238,10 +399,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 	case *ast.LetStatement:
-		symbol := c.symbolTable.Define(node.Name.Value)
+		if node.Pattern != nil {
+			return c.compileDestructuring(node)
+		}
+
+		symbol := c.define(node.Name.Value)
 		err := c.Compile(node.Value)
 		if err != nil {
-			return nil
+			return err
 		}
 
 		if symbol.Scope == GlobalScope {
@@ -259,6 +424,15 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.loadSymbol(symbol)
 
+	case *ast.InterpolatedString:
+		for _, part := range node.Parts {
+			err := c.Compile(part)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpConcat, len(node.Parts))
+
 	case *ast.ArrayLiteral:
 		for _, s := range node.Elements {
 			err := c.Compile(s)
@@ -269,16 +443,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpArray, len(node.Elements))
 
 	case *ast.HashLiteral:
-		keys := []ast.Expression{}
-		for k := range node.Pairs {
-			keys = append(keys, k)
-		}
-
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
-
-		for _, key := range keys {
+		for _, key := range node.Keys {
 			err := c.Compile(key)
 			if err != nil {
 				return err
@@ -290,7 +455,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 
-		c.emit(code.OpHash, len(keys)*2)
+		c.emit(code.OpHash, len(node.Keys)*2)
 	case *ast.IndexExpression:
 		err := c.Compile(node.Left)
 		if err != nil {
@@ -304,6 +469,42 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		c.emit(code.OpIndex)
 
+	case *ast.SliceExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		for _, bound := range []ast.Expression{node.Low, node.High} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			err := c.Compile(bound)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpSlice)
+
+	case *ast.RangeExpression:
+		err := c.Compile(node.Start)
+		if err != nil {
+			return err
+		}
+
+		err = c.Compile(node.End)
+		if err != nil {
+			return err
+		}
+
+		inclusive := 0
+		if node.Inclusive {
+			inclusive = 1
+		}
+		c.emit(code.OpRange, inclusive)
+
 	case *ast.FunctionLiteral:
 		c.enterScope()
 
@@ -312,13 +513,27 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		for _, parameter := range node.Parameters {
-			c.symbolTable.Define(parameter.Value)
+			c.define(parameter.Value)
+		}
+		if node.Rest != nil {
+			c.define(node.Rest.Value)
+		}
+
+		for i, value := range node.Defaults {
+			if value == nil {
+				continue
+			}
+			err := c.compileDefault(node, i)
+			if err != nil {
+				return err
+			}
 		}
 
 		err := c.Compile(node.Body)
 		if err != nil {
 			return err
 		}
+		c.checkUnused(node)
 		if c.lastInstructionIs(code.OpPop) {
 			c.replaceLastPopWithReturn()
 		}
@@ -328,15 +543,30 @@ func (c *Compiler) Compile(node ast.Node) error {
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
 		instructions := c.leaveScope()
+		if c.optimize {
+			instructions = code.Optimize(instructions)
+		}
+		if c.specialize {
+			instructions = code.Specialize(instructions)
+		}
 
 		for _, s := range freeSymbols {
 			c.loadSymbol(s)
 		}
 
 		comfiledFunction := &object.CompiledFunction{
-			Instructions:  instructions,
-			NumLocals:     numLocals,
-			NumParameters: len(node.Parameters),
+			Instructions:   instructions,
+			NumLocals:      numLocals,
+			NumParameters:  len(node.Parameters),
+			ParameterNames: []string{},
+			Rest:           node.Rest != nil,
+			Generator:      node.Generator,
+		}
+		for i, parameter := range node.Parameters {
+			comfiledFunction.ParameterNames = append(comfiledFunction.ParameterNames, parameter.Value)
+			if i < len(node.Defaults) && node.Defaults[i] != nil {
+				comfiledFunction.NumDefaults++
+			}
 		}
 		functionIndex := c.addConstant(comfiledFunction)
 		c.emit(code.OpClosure, functionIndex, len(freeSymbols))
@@ -347,9 +577,68 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
+		err = c.unwindTries()
+		if err != nil {
+			return err
+		}
+
 		c.emit(code.OpReturnValue)
 
+	case *ast.YieldExpression:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case node.Tail:
+			c.emit(code.OpYield, code.YieldTail)
+		case node.Delegate:
+			c.emit(code.OpYield, code.YieldEach)
+		default:
+			c.emit(code.OpYield, code.YieldValue)
+		}
+
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpThrow)
+
+	case *ast.MatchExpression:
+		return c.compileMatch(node)
+
+	case *ast.TryExpression:
+		if node.Finally == nil {
+			return c.compileCatch(node)
+		}
+
+		return c.compileFinally(node.Finally, func() error {
+			if node.Catch == nil {
+				return c.compileBlockValue(node.Block)
+			}
+			return c.compileCatch(node)
+		})
+
 	case *ast.CallExpression:
+		if len(node.Keywords) > 0 {
+			return c.compileKeywordCall(node)
+		}
+
+		if symbol, ok := c.globalCallee(node); ok {
+			for _, argument := range node.Arguments {
+				err := c.Compile(argument)
+				if err != nil {
+					return err
+				}
+			}
+
+			c.emit(code.OpCallGlobal, symbol.Index, len(node.Arguments))
+			return nil
+		}
+
 		err := c.Compile(node.Function)
 		if err != nil {
 			return err
@@ -366,6 +655,422 @@ func (c *Compiler) Compile(node ast.Node) error {
 	return nil
 }
 
+// compileDefault emits the code that gives parameter i of fn its default
+// value when the call left it out. Like in the evaluator, the default only
+// sees the parameters before it.
+func (c *Compiler) compileDefault(fn *ast.FunctionLiteral, i int) error {
+	later := map[string]Symbol{}
+	hidden := fn.Parameters[i:]
+	if fn.Rest != nil {
+		hidden = append(hidden[:len(hidden):len(hidden)], fn.Rest)
+	}
+	for _, parameter := range hidden {
+		if symbol, ok := c.symbolTable.store[parameter.Value]; ok {
+			later[parameter.Value] = symbol
+			delete(c.symbolTable.store, parameter.Value)
+		}
+	}
+
+	pos := c.emit(code.OpJumpPassed, 9999, i)
+	err := c.Compile(fn.Defaults[i])
+	for name, symbol := range later {
+		c.symbolTable.store[name] = symbol
+	}
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpSetLocal, i)
+
+	c.replaceInstruction(pos, code.Make(code.OpJumpPassed, len(c.currentInstructions()), i))
+	return nil
+}
+
+// compileKeywordCall compiles a call with keyword arguments, whose values
+// follow the positional arguments on the stack.
+func (c *Compiler) compileKeywordCall(node *ast.CallExpression) error {
+	err := c.Compile(node.Function)
+	if err != nil {
+		return err
+	}
+
+	names := &object.Array{Elements: []object.Object{}}
+	for _, keyword := range node.Keywords {
+		names.Elements = append(names.Elements, &object.String{Value: keyword.Value})
+	}
+
+	for _, argument := range append(node.Arguments[:len(node.Arguments):len(node.Arguments)], node.KeywordValues...) {
+		err := c.Compile(argument)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.emit(code.OpCallKeywords, len(node.Arguments)+len(node.Keywords), c.addConstant(names))
+	return nil
+}
+
+// compileMatch stores the value of node in a hidden variable and tries each
+// arm in turn: the tests of its pattern and its guard jump to the next arm
+// as soon as one fails, and the bindings are only made once the pattern
+// matched, in a block of the arm's own that shadows the variables around
+// the match. Tests load the parts of the value they look at from the
+// variable, so the stack is the same on every path. If no arm matches the
+// value of the expression is null.
+func (c *Compiler) compileMatch(node *ast.MatchExpression) error {
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+
+	subject := c.storeSubject("_match")
+
+	endJumps := []int{}
+	for _, arm := range node.Arms {
+		failJumps := []int{}
+
+		err := c.compilePatternTest(arm.Pattern, subject, nil, &failJumps)
+		if err != nil {
+			return err
+		}
+
+		c.enterBlock()
+		err = c.compileArm(arm, subject, &failJumps)
+		c.leaveBlock()
+		if err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+
+		for _, pos := range failJumps {
+			c.changeOperand(pos, len(c.currentInstructions()))
+		}
+	}
+
+	c.emit(code.OpNull)
+
+	for _, pos := range endJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	return nil
+}
+
+// compileArm compiles the bindings, guard and body of a match arm whose
+// pattern matched subject, adding a jump to failJumps for the guard.
+func (c *Compiler) compileArm(arm *ast.MatchArm, subject Symbol, failJumps *[]int) error {
+	c.compilePatternBindings(arm.Pattern, subject, nil)
+
+	if arm.Guard != nil {
+		err := c.Compile(arm.Guard)
+		if err != nil {
+			return err
+		}
+		*failJumps = append(*failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+	}
+
+	return c.Compile(arm.Body)
+}
+
+// compileDestructuring compiles a let that binds the identifiers of a
+// pattern, stopping with an error if the value doesn't have its shape.
+func (c *Compiler) compileDestructuring(node *ast.LetStatement) error {
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+	subject := c.storeSubject("_let")
+
+	failJumps := []int{}
+	err = c.compilePatternTest(node.Pattern, subject, nil, &failJumps)
+	if err != nil {
+		return err
+	}
+	c.compilePatternBindings(node.Pattern, subject, nil)
+
+	if len(failJumps) == 0 {
+		return nil
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+	for _, pos := range failJumps {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+	c.loadSymbol(subject)
+	c.emit(code.OpMismatch, c.addConstant(&object.String{Value: node.Pattern.String()}))
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// storeSubject pops the value on top of the stack into a new hidden
+// variable and returns it. The underscore keeps the variable out of the
+// unused variable warnings and the space out of reach of any identifier.
+func (c *Compiler) storeSubject(kind string) Symbol {
+	subject := c.symbolTable.Define(fmt.Sprintf("%s %d", kind, c.subjects))
+	c.subjects++
+	c.setSymbol(subject)
+	return subject
+}
+
+// compilePatternTest emits the tests of pattern against the part of
+// subject at path, adding a jump to failJumps after each.
+func (c *Compiler) compilePatternTest(pattern ast.Expression, subject Symbol, path []object.Object, failJumps *[]int) error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		return nil
+
+	case *ast.ArrayPattern:
+		c.loadPath(subject, path)
+		rest := 0
+		if pattern.Rest != nil {
+			rest = 1
+		}
+		c.emit(code.OpMatchArray, len(pattern.Elements), rest)
+		*failJumps = append(*failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+
+		for i, element := range pattern.Elements {
+			err := c.compilePatternTest(element, subject, extendPath(path, &object.Integer{Value: int64(i)}), failJumps)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *ast.HashPattern:
+		c.loadPath(subject, path)
+		keys := make([]object.Object, len(pattern.Keys))
+		for i, key := range pattern.Keys {
+			keys[i] = literalObject(key)
+			c.emit(code.OpConstant, c.addConstant(keys[i]))
+		}
+		c.emit(code.OpMatchHash, len(keys))
+		*failJumps = append(*failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+
+		for i, value := range pattern.Values {
+			err := c.compilePatternTest(value, subject, extendPath(path, keys[i]), failJumps)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	literal := literalObject(pattern)
+	if literal == nil {
+		return fmt.Errorf("invalid pattern %s", pattern.String())
+	}
+	c.loadPath(subject, path)
+	c.emit(code.OpConstant, c.addConstant(literal))
+	c.emit(code.OpMatchValue)
+	*failJumps = append(*failJumps, c.emit(code.OpJumpNotTruthy, 9999))
+	return nil
+}
+
+// compilePatternBindings binds the identifiers of pattern to the parts of
+// subject they matched.
+func (c *Compiler) compilePatternBindings(pattern ast.Expression, subject Symbol, path []object.Object) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value == "_" {
+			return
+		}
+		c.loadPath(subject, path)
+		c.setSymbol(c.bind(pattern.Value))
+
+	case *ast.ArrayPattern:
+		for i, element := range pattern.Elements {
+			c.compilePatternBindings(element, subject, extendPath(path, &object.Integer{Value: int64(i)}))
+		}
+
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			c.loadPath(subject, path)
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: int64(len(pattern.Elements))}))
+			c.emit(code.OpNull)
+			c.emit(code.OpSlice)
+			c.setSymbol(c.bind(pattern.Rest.Value))
+		}
+
+	case *ast.HashPattern:
+		for i, value := range pattern.Values {
+			c.compilePatternBindings(value, subject, extendPath(path, literalObject(pattern.Keys[i])))
+		}
+	}
+}
+
+// loadPath pushes the part of subject found by indexing it with each key
+// of path in turn.
+func (c *Compiler) loadPath(subject Symbol, path []object.Object) {
+	c.loadSymbol(subject)
+	for _, key := range path {
+		c.emit(code.OpConstant, c.addConstant(key))
+		c.emit(code.OpIndex)
+	}
+}
+
+func extendPath(path []object.Object, key object.Object) []object.Object {
+	return append(path[:len(path):len(path)], key)
+}
+
+// literalObject returns the value of a literal pattern, or nil if pattern
+// is no literal.
+func literalObject(pattern ast.Expression) object.Object {
+	switch pattern := pattern.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: pattern.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: pattern.Value}
+	case *ast.Boolean:
+		return object.NativeBool(pattern.Value)
+	}
+	return nil
+}
+
+// setSymbol pops the top of the stack into the variable symbol.
+func (c *Compiler) setSymbol(symbol Symbol) {
+	if symbol.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, symbol.Index)
+	} else {
+		c.emit(code.OpSetLocal, symbol.Index)
+	}
+}
+
+// compileCatch compiles the try block of node under a handler that jumps
+// to its catch block, which starts by storing what was thrown in the catch
+// parameter, a variable of the block alone. Either block leaves the value
+// of the expression on the stack.
+func (c *Compiler) compileCatch(node *ast.TryExpression) error {
+	tryPos := c.emit(code.OpTry, 9999)
+
+	c.enterTry(nil)
+	err := c.compileBlockValue(node.Block)
+	c.leaveTry()
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpEndTry)
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+	c.emit(code.OpCatch)
+
+	c.enterBlock()
+	c.setSymbol(c.define(node.Parameter.Value))
+	err = c.compileBlockValue(node.Catch)
+	c.leaveBlock()
+	if err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileFinally compiles body under a handler whose code runs finally and
+// throws what was caught again. When body completes, finally runs after the
+// handler is left. Its value is discarded either way.
+func (c *Compiler) compileFinally(finally *ast.BlockStatement, body func() error) error {
+	tryPos := c.emit(code.OpTry, 9999)
+
+	c.enterTry(finally)
+	err := body()
+	c.leaveTry()
+	if err != nil {
+		return err
+	}
+
+	c.emit(code.OpEndTry)
+	err = c.Compile(finally)
+	if err != nil {
+		return err
+	}
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(tryPos, len(c.currentInstructions()))
+	err = c.compileCopy(finally)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpThrow)
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// unwindTries leaves the handlers a return jumps out of, innermost first,
+// running the finally blocks they guard on the way. The value being
+// returned stays on the stack below whatever they do.
+func (c *Compiler) unwindTries() error {
+	tries := c.scopes[c.scopeIndex].tries
+	defer func() { c.scopes[c.scopeIndex].tries = tries }()
+
+	for i := len(tries) - 1; i >= 0; i-- {
+		c.emit(code.OpEndTry)
+		if tries[i] == nil {
+			continue
+		}
+
+		// a return inside the finally block only leaves the handlers
+		// around the try
+		c.scopes[c.scopeIndex].tries = tries[:i]
+		err := c.compileCopy(tries[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) enterTry(finally *ast.BlockStatement) {
+	c.scopes[c.scopeIndex].tries = append(c.scopes[c.scopeIndex].tries, finally)
+}
+
+func (c *Compiler) leaveTry() {
+	tries := c.scopes[c.scopeIndex].tries
+	c.scopes[c.scopeIndex].tries = tries[:len(tries)-1]
+}
+
+// compileBlockValue compiles block so that it leaves its value on the
+// stack, null if it doesn't end with an expression.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastOpPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+// compileCopy compiles block once more, for another path out of a try,
+// without repeating the warnings compiling it the first time gave.
+func (c *Compiler) compileCopy(block *ast.BlockStatement) error {
+	warnings := len(c.warnings)
+	err := c.Compile(block)
+	c.warnings = c.warnings[:warnings]
+	return err
+}
+
+// globalCallee reports whether call can be compiled to OpCallGlobal, i.e.
+// specialization is on and the callee is a plain global name.
+func (c *Compiler) globalCallee(call *ast.CallExpression) (Symbol, bool) {
+	if !c.specialize {
+		return Symbol{}, false
+	}
+
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return Symbol{}, false
+	}
+
+	symbol, ok := c.symbolTable.Resolve(ident.Value)
+	if !ok || symbol.Scope != GlobalScope {
+		return Symbol{}, false
+	}
+	return symbol, true
+}
+
 func (c *Compiler) replaceLastPopWithReturn() {
 	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
 	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
@@ -403,12 +1108,136 @@ func (c *Compiler) changeOperand(opPos int, operand int) {
 }
 
 func (c *Compiler) Bytecode() *Bytecode {
+	instructions := c.currentInstructions()
+	if c.optimize {
+		instructions = code.Optimize(instructions)
+	}
+	if c.specialize {
+		instructions = code.Specialize(instructions)
+	}
+
 	return &Bytecode{
-		Instructions: c.currentInstructions(),
+		Instructions: instructions,
 		Constants:    c.constants,
 	}
 }
 
+// compileTopLevel compiles the statements of a program or module, the only
+// place imports and exports may appear.
+func (c *Compiler) compileTopLevel(statements []ast.Statement) error {
+	for _, statement := range statements {
+		var err error
+		switch statement := statement.(type) {
+		case *ast.ImportStatement:
+			err = c.compileImport(statement)
+		case *ast.ExportStatement:
+			err = c.Compile(statement.Statement)
+		default:
+			err = c.Compile(statement)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileImport binds the name of an import to the exports of the module.
+// The first import of a module compiles it to a function, calls it and
+// keeps the hash of exports it returns in a global named after the module's
+// path, which no identifier can refer to. Later imports read that global.
+func (c *Compiler) compileImport(node *ast.ImportStatement) error {
+	importer := c.path
+	if len(c.loading) > 0 {
+		importer = c.loading[len(c.loading)-1]
+	}
+	path := module.Resolve(importer, node.Path)
+
+	hidden := "import " + path
+	symbol, ok := c.rootTable.store[hidden]
+	if ok {
+		c.emit(code.OpGetGlobal, symbol.Index)
+	} else {
+		loader := c.loader
+		if loader == nil {
+			loader = module.HostLoader(c.host)
+		}
+
+		program, err := module.Load(loader, c.loading, path)
+		if err != nil {
+			return err
+		}
+
+		err = c.compileModule(path, program)
+		if err != nil {
+			return err
+		}
+
+		symbol = c.rootTable.Define(hidden)
+		c.emit(code.OpSetGlobal, symbol.Index)
+		c.emit(code.OpGetGlobal, symbol.Index)
+	}
+
+	name := c.define(node.Name.Value)
+	if name.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, name.Index)
+	} else {
+		c.emit(code.OpSetLocal, name.Index)
+	}
+	return nil
+}
+
+// compileModule emits a call to a function that runs the top level of
+// program and returns its exports. The module's bindings are locals of that
+// function, so they don't clash with those of other modules, and it sees
+// only the builtins of the importer.
+func (c *Compiler) compileModule(path string, program *ast.Program) error {
+	c.loading = append(c.loading, path)
+	defer func() { c.loading = c.loading[:len(c.loading)-1] }()
+
+	outer := c.symbolTable
+	c.enterScope()
+	c.symbolTable = NewEnclosedSymbolTable(c.rootTable.builtinsOnly())
+
+	c.checkUnreachable(program.Statements)
+	err := c.compileTopLevel(program.Statements)
+	if err != nil {
+		c.leaveScope()
+		c.symbolTable = outer
+		return err
+	}
+
+	exports := module.Exports(program)
+	for _, name := range exports {
+		symbol, _ := c.symbolTable.Resolve(name)
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: name}))
+		c.loadSymbol(symbol)
+	}
+	c.emit(code.OpHash, len(exports)*2)
+	c.emit(code.OpReturnValue)
+
+	for _, symbol := range c.symbolTable.Unresolved() {
+		if !strings.HasPrefix(symbol.Name, "_") {
+			c.warn("unused variable %s in %s", symbol.Name, path)
+		}
+	}
+
+	numLocals := c.symbolTable.numDefinitions
+	instructions := c.leaveScope()
+	c.symbolTable = outer
+	if c.optimize {
+		instructions = code.Optimize(instructions)
+	}
+	if c.specialize {
+		instructions = code.Specialize(instructions)
+	}
+
+	fn := &object.CompiledFunction{Instructions: instructions, NumLocals: numLocals}
+	c.emit(code.OpClosure, c.addConstant(fn), 0)
+	c.emit(code.OpCall, 0)
+	return nil
+}
+
 func (c *Compiler) addConstant(obj object.Object) int {
 	c.constants = append(c.constants, obj)
 	return len(c.constants) - 1
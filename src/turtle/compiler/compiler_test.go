@@ -275,6 +275,292 @@ func TestConditionals(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestDestructuring(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `let [a] = [1];`,
+			expectedConstants: []interface{}{1, 0, "[a]"},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpSetGlobal, 0),
+				// 0009
+				code.Make(code.OpGetGlobal, 0),
+				// 0012
+				code.Make(code.OpMatchArray, 1, 0),
+				// 0016
+				code.Make(code.OpJumpNotTruthy, 32),
+				// 0019
+				code.Make(code.OpGetGlobal, 0),
+				// 0022
+				code.Make(code.OpConstant, 1),
+				// 0025
+				code.Make(code.OpIndex),
+				// 0026
+				code.Make(code.OpSetGlobal, 1),
+				// 0029
+				code.Make(code.OpJump, 38),
+				// 0032
+				code.Make(code.OpGetGlobal, 0),
+				// 0035
+				code.Make(code.OpMismatch, 2),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestParameters(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn(a = 1) { a }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpJumpPassed, 9, 0),
+					// 0004
+					code.Make(code.OpConstant, 0),
+					// 0007
+					code.Make(code.OpSetLocal, 0),
+					// 0009
+					code.Make(code.OpGetLocal, 0),
+					// 0011
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `let f = fn(a, b) { a }; f(1, b = 2);`,
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				1,
+				2,
+				[]string{"b"},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpCallKeywords, 2, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestStringInterpolation(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `"a${1}b"`,
+			expectedConstants: []interface{}{"a", 1, "b"},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConcat, 3),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestSlicesAndRanges(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `[1][:2]`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpNull),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `1..=2`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpRange, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: `fn() { yield 1; yield ...[2] }`,
+			expectedConstants: []interface{}{
+				1,
+				2,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpYield, code.YieldValue),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpArray, 1),
+					code.Make(code.OpYield, code.YieldTail),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn(xs) { yield ...xs; 1 }`,
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpYield, code.YieldEach),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestExceptions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             `throw 1;`,
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpThrow),
+			},
+		},
+		{
+			input:             `try { 1 } catch (e) { e }; 2;`,
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTry, 10),
+				// 0003
+				code.Make(code.OpConstant, 0),
+				// 0006
+				code.Make(code.OpEndTry),
+				// 0007
+				code.Make(code.OpJump, 17),
+				// 0010
+				code.Make(code.OpCatch),
+				// 0011
+				code.Make(code.OpSetGlobal, 0),
+				// 0014
+				code.Make(code.OpGetGlobal, 0),
+				// 0017
+				code.Make(code.OpPop),
+				// 0018
+				code.Make(code.OpConstant, 1),
+				// 0021
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `try { 1 } finally { 2 }`,
+			expectedConstants: []interface{}{1, 2, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTry, 14),
+				// 0003
+				code.Make(code.OpConstant, 0),
+				// 0006
+				code.Make(code.OpEndTry),
+				// 0007
+				code.Make(code.OpConstant, 1),
+				// 0010
+				code.Make(code.OpPop),
+				// 0011
+				code.Make(code.OpJump, 19),
+				// 0014
+				code.Make(code.OpConstant, 2),
+				// 0017
+				code.Make(code.OpPop),
+				// 0018
+				code.Make(code.OpThrow),
+				// 0019
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: `fn() { try { return 1; } finally { 2 } }`,
+			expectedConstants: []interface{}{1, 2, 2, 2, []code.Instructions{
+				// 0000
+				code.Make(code.OpTry, 21),
+				// 0003
+				code.Make(code.OpConstant, 0),
+				// 0006
+				code.Make(code.OpEndTry),
+				// 0007
+				code.Make(code.OpConstant, 1),
+				// 0010
+				code.Make(code.OpPop),
+				// 0011
+				code.Make(code.OpReturnValue),
+				// 0012
+				code.Make(code.OpNull),
+				// 0013
+				code.Make(code.OpEndTry),
+				// 0014
+				code.Make(code.OpConstant, 2),
+				// 0017
+				code.Make(code.OpPop),
+				// 0018
+				code.Make(code.OpJump, 26),
+				// 0021
+				code.Make(code.OpConstant, 3),
+				// 0024
+				code.Make(code.OpPop),
+				// 0025
+				code.Make(code.OpThrow),
+				// 0026
+				code.Make(code.OpReturnValue),
+			}},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 4, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
 func TestStringExpression(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -965,6 +1251,184 @@ func TestRecursiveFunctions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestOptimize(t *testing.T) {
+	program := parse(`let f = fn(x) { return x; x + 1 }; f(1); 2`)
+
+	compiler := New()
+	compiler.SetOptimize(true)
+	err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+	err = testConstants(t, []interface{}{
+		1,
+		[]code.Instructions{
+			code.Make(code.OpGetLocal, 0),
+			code.Make(code.OpReturnValue),
+		},
+		1,
+		2,
+	}, bytecode.Constants)
+	if err != nil {
+		t.Fatalf("testConstants failed: %s", err)
+	}
+
+	err = testInstructions([]code.Instructions{
+		code.Make(code.OpClosure, 1, 0),
+		code.Make(code.OpDup),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpConstant, 2),
+		code.Make(code.OpCall, 1),
+		code.Make(code.OpPop),
+		code.Make(code.OpConstant, 3),
+		code.Make(code.OpPop),
+	}, bytecode.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+}
+
+func TestNamedConstants(t *testing.T) {
+	compiler := New()
+	err := compiler.Compile(parse(`PI + PI; fn() { PI * E }; E`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+	if len(bytecode.Constants) != 3 {
+		t.Fatalf("wrong number of constants. want=3, got=%d", len(bytecode.Constants))
+	}
+
+	err = testInstructions([]code.Instructions{
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpAdd),
+		code.Make(code.OpPop),
+		code.Make(code.OpClosure, 2, 0),
+		code.Make(code.OpPop),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpPop),
+	}, bytecode.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+
+	// a compiler carrying on from the state of another reuses its constants
+	compiler = NewWithState(compiler.symbolTable, bytecode.Constants)
+	err = compiler.Compile(parse(`E`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	if n := len(compiler.Bytecode().Constants); n != 3 {
+		t.Fatalf("wrong number of constants after reuse. want=3, got=%d", n)
+	}
+}
+
+func TestSpecialize(t *testing.T) {
+	program := parse(`let f = fn(x) { if (x < 1) { 0 } else { f(x - 1) } }; f(2)`)
+
+	compiler := New()
+	compiler.SetSpecialize(true)
+	err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+	err = testConstants(t, []interface{}{
+		1,
+		0,
+		1,
+		[]code.Instructions{
+			code.Make(code.OpGetLocal0),        // 0000
+			code.Make(code.OpConstant, 0),      // 0001
+			code.Make(code.OpLessThanJump, 13), // 0004
+			code.Make(code.OpConstant, 1),      // 0007
+			code.Make(code.OpJump, 20),         // 0010
+			code.Make(code.OpCurrentClosure),   // 0013
+			code.Make(code.OpGetLocal0),        // 0014
+			code.Make(code.OpSubConst, 2),      // 0015
+			code.Make(code.OpCall, 1),          // 0018
+			code.Make(code.OpReturnValue),      // 0020
+		},
+		2,
+	}, bytecode.Constants)
+	if err != nil {
+		t.Fatalf("testConstants failed: %s", err)
+	}
+
+	err = testInstructions([]code.Instructions{
+		code.Make(code.OpClosure, 3, 0),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpConstant, 4),
+		code.Make(code.OpCallGlobal, 0, 1),
+		code.Make(code.OpPop),
+	}, bytecode.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let a = 1; a;`, []string{}},
+		{`fn(a) { a }`, []string{}},
+		{`fn(a, b) { a }`, []string{"unused parameter b"}},
+		{`let f = fn(a) { let b = 1; a }`, []string{"unused variable b in f"}},
+		{`fn(_a) { let _b = 1; 2 }`, []string{}},
+		{
+			`fn(a) { fn() { a } }`,
+			[]string{},
+		},
+		{
+			`fn() { return 1; 2; }`,
+			[]string{"unreachable code after return: 2"},
+		},
+		{
+			`return 1; puts(2);`,
+			[]string{"unreachable code after return: puts(2)"},
+		},
+		{
+			`let len = fn(x) { x }; len(1)`,
+			[]string{"len shadows builtin function"},
+		},
+		{
+			`fn(puts) { puts }`,
+			[]string{"puts shadows builtin function"},
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		warnings := compiler.Warnings()
+		if len(warnings) != len(tt.expected) {
+			t.Errorf("wrong number of warnings for %q. want=%q, got=%q",
+				tt.input, tt.expected, warnings)
+			continue
+		}
+
+		for i, want := range tt.expected {
+			if warnings[i] != want {
+				t.Errorf("wrong warning for %q. want=%q, got=%q",
+					tt.input, want, warnings[i])
+			}
+		}
+	}
+}
+
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
 
@@ -1040,6 +1504,18 @@ func testConstants(t *testing.T, expected []interface{}, actual []object.Object)
 			if err != nil {
 				return fmt.Errorf("constant %d - testStringObject failed: %s", i, err)
 			}
+		case []string:
+			array, ok := actual[i].(*object.Array)
+			if !ok || len(array.Elements) != len(constant) {
+				return fmt.Errorf("constant %d - not an array of %d: %s", i, len(constant), actual[i].Inspect())
+			}
+
+			for j, element := range constant {
+				err := testStringObject(element, array.Elements[j])
+				if err != nil {
+					return fmt.Errorf("constant %d - element %d - testStringObject failed: %s", i, j, err)
+				}
+			}
 		case []code.Instructions:
 			fn, ok := actual[i].(*object.CompiledFunction)
 			if !ok {
@@ -6,6 +6,7 @@ const (
 	GlobalScope   SymbolScope = "GLOBAL"
 	LocalScope    SymbolScope = "LOCAL"
 	BuiltinScope  SymbolScope = "BUILTIN"
+	ConstantScope SymbolScope = "CONSTANT"
 	FreeScope     SymbolScope = "FREE"
 	FunctionScope SymbolScope = "FUNCTION"
 )
@@ -22,12 +23,20 @@ type SymbolTable struct {
 	numDefinitions int
 
 	FreeSymbols []Symbol
+
+	definitions []Symbol
+	resolved    map[Symbol]bool
+
+	// block is set for the table of a block, which defines its symbols in
+	// the frame of its outer table but keeps their names to itself.
+	block bool
 }
 
 func NewSymbolTable() *SymbolTable {
 	s := make(map[string]Symbol)
 	free := []Symbol{}
-	return &SymbolTable{store: s, FreeSymbols: free}
+	resolved := make(map[Symbol]bool)
+	return &SymbolTable{store: s, FreeSymbols: free, resolved: resolved}
 }
 
 func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
@@ -36,6 +45,24 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	return s
 }
 
+// NewBlockSymbolTable returns a table for a block of the code outer is the
+// table of. What the block defines shadows the symbols of outer and goes out
+// of scope with the table, though each keeps a slot of its own in the frame.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewEnclosedSymbolTable(outer)
+	s.block = true
+	s.resolved = outer.resolved
+	return s
+}
+
+// frame returns the table whose frame holds the symbols s defines.
+func (s *SymbolTable) frame() *SymbolTable {
+	for s.block {
+		s = s.Outer
+	}
+	return s
+}
+
 func (s *SymbolTable) defineFree(original Symbol) Symbol {
 	s.FreeSymbols = append(s.FreeSymbols, original)
 
@@ -47,20 +74,25 @@ func (s *SymbolTable) defineFree(original Symbol) Symbol {
 }
 
 func (s *SymbolTable) Define(name string) Symbol {
-	symbol := Symbol{Name: name, Index: s.numDefinitions}
-	if s.Outer == nil {
+	frame := s.frame()
+	symbol := Symbol{Name: name, Index: frame.numDefinitions}
+	if frame.Outer == nil {
 		symbol.Scope = GlobalScope
 	} else {
 		symbol.Scope = LocalScope
 	}
 
 	s.store[name] = symbol
-	s.numDefinitions++
+	frame.numDefinitions++
+	frame.definitions = append(frame.definitions, symbol)
 	return symbol
 }
 
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
+	if ok {
+		s.resolved[obj] = true
+	}
 
 	if !ok && s.Outer != nil {
 		obj, ok = s.Outer.Resolve(name)
@@ -68,7 +100,7 @@ func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 			return obj, ok
 		}
 
-		if obj.Scope == GlobalScope || obj.Scope == BuiltinScope {
+		if s.block || obj.Scope == GlobalScope || obj.Scope == BuiltinScope || obj.Scope == ConstantScope {
 			return obj, ok
 		}
 
@@ -84,8 +116,50 @@ func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	return symbol
 }
 
+// DefineConstant defines name as object.Constants[index].
+func (s *SymbolTable) DefineConstant(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: ConstantScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// builtinsOnly returns a new table with the builtins and constants of s,
+// but none of its other symbols.
+func (s *SymbolTable) builtinsOnly() *SymbolTable {
+	table := NewSymbolTable()
+	for name, symbol := range s.store {
+		if symbol.Scope == BuiltinScope || symbol.Scope == ConstantScope {
+			table.store[name] = symbol
+		}
+	}
+	return table
+}
+
 func (s *SymbolTable) DefineFunctionName(name string) Symbol {
 	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
 	s.store[name] = symbol
 	return symbol
 }
+
+// Unresolved returns the symbols created with Define in this table that were
+// never looked up with Resolve, in the order they were defined.
+func (s *SymbolTable) Unresolved() []Symbol {
+	unresolved := []Symbol{}
+	for _, symbol := range s.definitions {
+		if !s.resolved[symbol] {
+			unresolved = append(unresolved, symbol)
+		}
+	}
+	return unresolved
+}
+
+// IsBuiltin reports whether name refers to a builtin function in this table
+// or any of the tables enclosing it.
+func (s *SymbolTable) IsBuiltin(name string) bool {
+	for table := s; table != nil; table = table.Outer {
+		if symbol, ok := table.store[name]; ok {
+			return symbol.Scope == BuiltinScope
+		}
+	}
+	return false
+}
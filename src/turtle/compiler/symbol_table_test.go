@@ -102,6 +102,51 @@ func TestResolveLocal(t *testing.T) {
 
 }
 
+func TestResolveBlock(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("b")
+
+	block := NewBlockSymbolTable(local)
+	block.Define("b")
+	block.Define("c")
+
+	expected := []Symbol{
+		Symbol{Name: "a", Scope: GlobalScope, Index: 0},
+		Symbol{Name: "b", Scope: LocalScope, Index: 1},
+		Symbol{Name: "c", Scope: LocalScope, Index: 2},
+	}
+
+	for _, sym := range expected {
+		result, ok := block.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	if len(block.FreeSymbols) != 0 {
+		t.Errorf("block has free symbols: %+v", block.FreeSymbols)
+	}
+	if local.numDefinitions != 3 {
+		t.Errorf("wrong number of locals. want=3, got=%d", local.numDefinitions)
+	}
+
+	// outside of the block, its symbols are out of scope
+	if result, _ := local.Resolve("b"); result.Index != 0 {
+		t.Errorf("expected b to resolve to the local of the function, got=%+v", result)
+	}
+	if _, ok := local.Resolve("c"); ok {
+		t.Errorf("c resolvable outside of its block")
+	}
+}
+
 func TestDefineAndResolveFunctionName(t *testing.T) {
 	global := NewSymbolTable()
 	global.DefineFunctionName("a")
@@ -334,3 +379,54 @@ func TestDefineResolveBuiltins(t *testing.T) {
 		}
 	}
 }
+
+func TestDefineResolveConstants(t *testing.T) {
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(NewEnclosedSymbolTable(global))
+
+	expected := Symbol{Name: "PI", Scope: ConstantScope, Index: 0}
+	global.DefineConstant(0, "PI")
+
+	result, ok := local.Resolve("PI")
+	if !ok {
+		t.Fatalf("name PI not resolvable")
+	}
+	if result != expected {
+		t.Errorf("expected PI to resolve to %+v, got=%+v", expected, result)
+	}
+	if len(local.FreeSymbols) != 0 {
+		t.Errorf("constant became a free variable: %+v", local.FreeSymbols)
+	}
+}
+
+func TestUnresolved(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+
+	local := NewEnclosedSymbolTable(global)
+	a := local.Define("a")
+	local.Define("b")
+	c := local.Define("c")
+	local.Resolve("b")
+	local.Resolve("len")
+
+	nested := NewEnclosedSymbolTable(local)
+	nested.Resolve("c")
+
+	unresolved := local.Unresolved()
+	expected := []Symbol{a}
+	if len(unresolved) != len(expected) {
+		t.Fatalf("wrong number of unresolved symbols. want=%+v, got=%+v",
+			expected, unresolved)
+	}
+	if unresolved[0] != expected[0] {
+		t.Errorf("expected %+v to be unresolved, got=%+v", expected[0], unresolved[0])
+	}
+
+	if !local.IsBuiltin("len") {
+		t.Errorf("expected len to be a builtin")
+	}
+	if local.IsBuiltin(c.Name) {
+		t.Errorf("expected %s not to be a builtin", c.Name)
+	}
+}
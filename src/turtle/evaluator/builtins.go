@@ -4,11 +4,18 @@ import (
 	"turtle/object"
 )
 
-var builtins = map[string]*object.Builtin{
-	"len":   object.GetBuiltinByName("len"),
-	"puts":  object.GetBuiltinByName("puts"),
-	"first": object.GetBuiltinByName("first"),
-	"last":  object.GetBuiltinByName("last"),
-	"rest":  object.GetBuiltinByName("rest"),
-	"push":  object.GetBuiltinByName("push"),
-}
+var builtins = func() map[string]*object.Builtin {
+	builtins := make(map[string]*object.Builtin, len(object.Builtins))
+	for _, def := range object.Builtins {
+		builtins[def.Name] = def.Builtin
+	}
+	return builtins
+}()
+
+var constants = func() map[string]object.Object {
+	constants := make(map[string]object.Object, len(object.Constants))
+	for _, def := range object.Constants {
+		constants[def.Name] = def.Value
+	}
+	return constants
+}()
@@ -1,18 +1,42 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"turtle/ast"
 	"turtle/object"
 )
 
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL  = object.NULL
+	TRUE  = object.True
+	FALSE = object.False
 )
 
+// EvalContext evaluates node like Eval, but gives up with an *object.Error
+// once ctx is done or limits are exceeded. The error's Err field then wraps
+// ctx.Err(), object.ErrInstructionLimit or object.ErrAllocationLimit.
+func EvalContext(ctx context.Context, node ast.Node, env *object.Environment, limits object.Limits) object.Object {
+	budget := env.Budget()
+	budget.Reset(ctx, limits)
+	defer budget.Reset(context.Background(), object.Limits{})
+
+	return Eval(node, env)
+}
+
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	if err := env.Budget().Step(); err != nil {
+		return newBudgetError(err)
+	}
+
+	if allocates(node) {
+		if err := env.Budget().Allocate(); err != nil {
+			return newBudgetError(err)
+		}
+	}
+
 	switch node := node.(type) {
 
 	// Statements
@@ -32,11 +56,28 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		err := object.Throw(val)
+		return &object.Error{Message: err.Error(), Err: err}
+
+	case *ast.ImportStatement:
+		return newError("import must be at the top level of a file")
+
+	case *ast.ExportStatement:
+		return newError("export must be at the top level of a file")
+
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
 		if isError(val) {
 			return val
 		}
+		if node.Pattern != nil {
+			return evalDestructuring(node.Pattern, val, env)
+		}
 		env.Set(node.Name.Value, val)
 
 	// Expressions
@@ -46,6 +87,18 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
+	case *ast.InterpolatedString:
+		parts := evalExpressions(node.Parts, env)
+		if len(parts) == 1 && isError(parts[0]) {
+			return parts[0]
+		}
+
+		var out strings.Builder
+		for _, part := range parts {
+			out.WriteString(part.Inspect())
+		}
+		return &object.String{Value: out.String()}
+
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
@@ -72,13 +125,22 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Parameters: params, Defaults: node.Defaults, Rest: node.Rest, Env: env, Body: body, Generator: node.Generator}
+
+	case *ast.YieldExpression:
+		return evalYieldExpression(node, env)
 
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
@@ -86,12 +148,17 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return function
 		}
 
-		args := evalExpressions(node.Arguments, env)
+		args := evalExpressions(append(node.Arguments[:len(node.Arguments):len(node.Arguments)], node.KeywordValues...), env)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		keywords := []string{}
+		for _, keyword := range node.Keywords {
+			keywords = append(keywords, keyword.Value)
+		}
+
+		return applyFunction(function, args, keywords, env)
 
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
@@ -111,6 +178,27 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return evalIndexExpression(left, index)
 
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
+
+	case *ast.RangeExpression:
+		start := Eval(node.Start, env)
+		if isError(start) {
+			return start
+		}
+		end := Eval(node.End, env)
+		if isError(end) {
+			return end
+		}
+		array, err := object.RangeOf(start, end, node.Inclusive, env.Budget())
+		if !object.Catchable(err) {
+			return newBudgetError(err)
+		}
+		if err != nil {
+			return newError("%s", err)
+		}
+		return array
+
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
 
@@ -119,11 +207,28 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	return nil
 }
 
+// allocates reports whether evaluating node may create an object, which is
+// what the allocation limit counts.
+func allocates(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.InterpolatedString, *ast.PrefixExpression,
+		*ast.SliceExpression, *ast.RangeExpression,
+		*ast.InfixExpression, *ast.FunctionLiteral, *ast.CallExpression,
+		*ast.ArrayLiteral, *ast.HashLiteral:
+		return true
+	}
+	return false
+}
+
+func newBudgetError(err error) *object.Error {
+	return &object.Error{Message: err.Error(), Err: err}
+}
+
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = evalTopLevelStatement(statement, env)
 
 		switch result := result.(type) {
 		case *object.ReturnValue:
@@ -183,6 +288,8 @@ func evalInfixExpression(
 		return evalIntegerInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
@@ -210,6 +317,9 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	if float, ok := right.(*object.Float); ok {
+		return &object.Float{Value: -float.Value}
+	}
 	if right.Type() != object.INTEGER_OBJ {
 		return newError("unknown operator: -%s", right.Type())
 	}
@@ -233,6 +343,9 @@ func evalIntegerInfixExpression(
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("can't divide by 0")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
@@ -248,6 +361,46 @@ func evalIntegerInfixExpression(
 	}
 }
 
+func isNumber(obj object.Object) bool {
+	_, ok := object.FloatValue(obj)
+	return ok
+}
+
+// evalFloatInfixExpression handles floats, and integers mixed with floats,
+// which are converted to floats first.
+func evalFloatInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftVal, _ := object.FloatValue(left)
+	rightVal, _ := object.FloatValue(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		if rightVal == 0 {
+			return newError("can't divide by 0")
+		}
+		return &object.Float{Value: leftVal / rightVal}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
 func evalStringInfixExpression(
 	operator string,
 	left, right object.Object,
@@ -280,6 +433,162 @@ func evalIfExpression(
 	}
 }
 
+// evalMatchExpression evaluates the body of the first arm of node whose
+// pattern matches and whose guard holds, with the identifiers of the
+// pattern bound. It returns null if no arm matches.
+func evalMatchExpression(
+	node *ast.MatchExpression,
+	env *object.Environment,
+) object.Object {
+	value := Eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+
+	for _, arm := range node.Arms {
+		bindings := map[string]object.Object{}
+		if !matchPattern(arm.Pattern, value, bindings) {
+			continue
+		}
+
+		// the bindings of an arm shadow the variables around the match
+		armEnv := object.NewBlockEnvironment(env)
+		for name, bound := range bindings {
+			armEnv.Set(name, bound)
+		}
+
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+
+		return Eval(arm.Body, armEnv)
+	}
+
+	return NULL
+}
+
+// matchPattern reports whether value matches pattern, collecting what the
+// identifiers of pattern bind in bindings.
+// evalDestructuring binds the identifiers of pattern to the parts of value
+// they match, or returns an error if value doesn't have its shape.
+func evalDestructuring(pattern ast.Expression, value object.Object, env *object.Environment) object.Object {
+	bindings := map[string]object.Object{}
+	if !matchPattern(pattern, value, bindings) {
+		return newError("can't destructure %s into %s", value.Inspect(), pattern.String())
+	}
+
+	for name, bound := range bindings {
+		env.Set(name, bound)
+	}
+	return nil
+}
+
+func matchPattern(pattern ast.Expression, value object.Object, bindings map[string]object.Object) bool {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			bindings[pattern.Value] = value
+		}
+		return true
+
+	case *ast.ArrayPattern:
+		if !object.MatchesArray(value, len(pattern.Elements), pattern.Rest != nil) {
+			return false
+		}
+
+		array := value.(*object.Array)
+		for i, element := range pattern.Elements {
+			if !matchPattern(element, array.Elements[i], bindings) {
+				return false
+			}
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			bindings[pattern.Rest.Value] = array.Slice(int64(len(pattern.Elements)), int64(len(array.Elements)))
+		}
+		return true
+
+	case *ast.HashPattern:
+		keys := make([]object.Object, len(pattern.Keys))
+		for i, key := range pattern.Keys {
+			keys[i] = literalValue(key)
+		}
+		if !object.MatchesHash(value, keys) {
+			return false
+		}
+
+		hash := value.(*object.Hash)
+		for i, key := range keys {
+			pair := hash.Pairs[key.(object.Hashable).HashKey()]
+			if !matchPattern(pattern.Values[i], pair.Value, bindings) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return object.MatchesLiteral(value, literalValue(pattern))
+}
+
+// literalValue returns the value of a literal pattern, or nil if pattern is
+// no literal.
+func literalValue(pattern ast.Expression) object.Object {
+	switch pattern := pattern.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: pattern.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: pattern.Value}
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(pattern.Value)
+	}
+	return nil
+}
+
+// evalTryExpression runs the catch block of node if its try block fails
+// with an error that can be caught, and the finally block in every case. A
+// finally block that fails or returns overrides the outcome of the others.
+func evalTryExpression(
+	node *ast.TryExpression,
+	env *object.Environment,
+) object.Object {
+	result := Eval(node.Block, env)
+
+	if errObj, ok := result.(*object.Error); ok && node.Catch != nil && object.Catchable(errObj.Err) {
+		catchEnv := object.NewBlockEnvironment(env)
+		catchEnv.Set(node.Parameter.Value, caught(errObj))
+		result = Eval(node.Catch, catchEnv)
+	}
+
+	if node.Finally != nil {
+		finally := Eval(node.Finally, env)
+		if finally != nil {
+			ft := finally.Type()
+			if ft == object.RETURN_VALUE_OBJ || ft == object.ERROR_OBJ {
+				return finally
+			}
+		}
+	}
+
+	if result == nil {
+		return NULL
+	}
+	return result
+}
+
+// caught returns what a catch clause binds for errObj, as object.Caught
+// does for the VM.
+func caught(errObj *object.Error) object.Object {
+	if errObj.Err != nil {
+		return object.Caught(errObj.Err)
+	}
+	return &object.String{Value: errObj.Message}
+}
+
 func evalIdentifier(
 	node *ast.Identifier,
 	env *object.Environment,
@@ -292,6 +601,10 @@ func evalIdentifier(
 		return builtin
 	}
 
+	if constant, ok := constants[node.Value]; ok {
+		return constant
+	}
+
 	return newError("identifier not found: %s", node.Value)
 }
 
@@ -336,16 +649,40 @@ func evalExpressions(
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// applyFunction calls fn with args, the last len(keywords) of which are
+// keyword arguments with those names.
+func applyFunction(fn object.Object, args []object.Object, keywords []string, env *object.Environment) object.Object {
 	switch fn := fn.(type) {
 
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
+		extendedEnv, err := extendFunctionEnv(fn, args, keywords)
+		if err != nil {
+			return err
+		}
+		if fn.Generator {
+			return newGenerator(fn.Body, extendedEnv)
+		}
+
+		budget := env.Budget()
+		if err := budget.Enter(); err != nil {
+			return newError("%s", err)
+		}
+		defer budget.Leave()
+
 		evaluated := Eval(fn.Body, extendedEnv)
 		return unwrapReturnValue(evaluated)
 
 	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
+		if len(keywords) > 0 {
+			return newError("builtin functions don't take keyword arguments")
+		}
+
+		e := &engine{env: env}
+		result := fn.Fn(e, args...)
+		if e.err != nil {
+			return e.err
+		}
+		if result != nil {
 			return result
 		}
 		return NULL
@@ -355,17 +692,78 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 	}
 }
 
+// engine is what a builtin called from env sees of the evaluator.
+type engine struct {
+	env *object.Environment
+	// err is the first error a callback of the builtin ran into. It wins
+	// over whatever the builtin returns.
+	err *object.Error
+}
+
+func (e *engine) Host() *object.Host {
+	return e.env.Host()
+}
+
+func (e *engine) Budget() *object.Budget {
+	return e.env.Budget()
+}
+
+func (e *engine) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	result := applyFunction(fn, args, nil, e.env)
+
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		return result, nil
+	}
+
+	if e.err == nil {
+		e.err = errObj
+	}
+	if errObj.Err != nil {
+		return nil, errObj.Err
+	}
+	return nil, errors.New(errObj.Message)
+}
+
+// extendFunctionEnv binds the parameters of fn to args in a new
+// environment. A parameter left to its default sees the parameters before
+// it, but none after.
 func extendFunctionEnv(
 	fn *object.Function,
 	args []object.Object,
-) *object.Environment {
+	keywords []string,
+) (*object.Environment, *object.Error) {
+	names := []string{}
+	numDefaults := 0
+	for i, param := range fn.Parameters {
+		names = append(names, param.Value)
+		if i < len(fn.Defaults) && fn.Defaults[i] != nil {
+			numDefaults++
+		}
+	}
+
+	bound, err := object.BindArguments(names, numDefaults, fn.Rest != nil, args, keywords)
+	if err != nil {
+		return nil, newError("%s", err)
+	}
+
 	env := object.NewEnclosedEnvironment(fn.Env)
 
 	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		value := bound[paramIdx]
+		if value == nil {
+			value = Eval(fn.Defaults[paramIdx], env)
+			if errObj, ok := value.(*object.Error); ok {
+				return nil, errObj
+			}
+		}
+		env.Set(param.Value, value)
+	}
+	if fn.Rest != nil {
+		env.Set(fn.Rest.Value, bound[len(names)])
 	}
 
-	return env
+	return env, nil
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
@@ -380,6 +778,8 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -388,24 +788,56 @@ func evalIndexExpression(left, index object.Object) object.Object {
 }
 
 func evalArrayIndexExpression(array, index object.Object) object.Object {
-	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
+	element, ok := array.(*object.Array).At(index.(*object.Integer).Value)
+	if !ok {
+		return NULL
+	}
+
+	return element
+}
 
-	if idx < 0 || idx > max {
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	char, ok := str.(*object.String).CharAt(index.(*object.Integer).Value)
+	if !ok {
 		return NULL
 	}
 
-	return arrayObject.Elements[idx]
+	return char
+}
+
+// evalSliceExpression evaluates left[low:high], leaving the ends without a
+// bound open.
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	bounds := []object.Object{NULL, NULL}
+	for i, bound := range []ast.Expression{node.Low, node.High} {
+		if bound == nil {
+			continue
+		}
+		bounds[i] = Eval(bound, env)
+		if isError(bounds[i]) {
+			return bounds[i]
+		}
+	}
+
+	slice, err := object.SliceOf(left, bounds[0], bounds[1])
+	if err != nil {
+		return newError("%s", err)
+	}
+	return slice
 }
 
 func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash()
 
-	for keyNode, valueNode := range node.Pairs {
+	for _, keyNode := range node.Keys {
 		key := Eval(keyNode, env)
 		if isError(key) {
 			return key
@@ -416,16 +848,15 @@ func evalHashLiteral(
 			return newError("unusable as hash key: %s", key.Type())
 		}
 
-		value := Eval(valueNode, env)
+		value := Eval(node.Pairs[keyNode], env)
 		if isError(value) {
 			return value
 		}
 
-		hashed := hashKey.HashKey()
-		pairs[hashed] = object.HashPair{Key: key, Value: value}
+		hash.Set(hashKey, value)
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return hash
 }
 
 func evalHashIndexExpression(hash, index object.Object) object.Object {
@@ -1,6 +1,8 @@
 package evaluator
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"turtle/lexer"
 	"turtle/object"
@@ -221,6 +223,10 @@ if (10 > 1) {
 			`999[1]`,
 			"index operator not supported: INTEGER",
 		},
+		{
+			`let f = fn() { f() }; f()`,
+			"stack overflow",
+		},
 	}
 
 	for _, tt := range tests {
@@ -439,6 +445,39 @@ func TestArrayLiterals(t *testing.T) {
 	testIntegerObject(t, result.Elements[2], 6)
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"abc"[0]`, "a"},
+		{`let s = "abc"; s[1 + 1]`, "c"},
+		{`"häh"[1]`, "ä"},
+		{`"abc"[3]`, nil},
+		{`"abc"[-1]`, "c"},
+		{`"häh"[-2]`, "ä"},
+		{`"abc"[-4]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		expected, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != expected {
+			t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+		}
+	}
+}
+
 func TestArrayIndexExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -482,6 +521,14 @@ func TestArrayIndexExpressions(t *testing.T) {
 		},
 		{
 			"[1, 2, 3][-1]",
+			3,
+		},
+		{
+			"[1, 2, 3][-3]",
+			1,
+		},
+		{
+			"[1, 2, 3][-4]",
 			nil,
 		},
 	}
@@ -582,6 +629,117 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+func TestEvalLimits(t *testing.T) {
+	tests := []struct {
+		input    string
+		limits   object.Limits
+		expected error
+	}{
+		{"let f = fn(x) { x }; f(1) + f(2)", object.Limits{MaxInstructions: 100, MaxAllocations: 100}, nil},
+		{"1 + 2 + 3", object.Limits{MaxInstructions: 3}, object.ErrInstructionLimit},
+		{"1 + 2 + 3", object.Limits{MaxAllocations: 2}, object.ErrAllocationLimit},
+		{"let loop = fn(n) { loop(n + 1) }; loop(0)", object.Limits{MaxInstructions: 1000}, object.ErrInstructionLimit},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		env := object.NewEnvironment()
+
+		result := EvalContext(context.Background(), program, env, tt.limits)
+
+		var err error
+		if errObj, ok := result.(*object.Error); ok {
+			err = errObj.Err
+		}
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%q: wrong error. want=%v, got=%v (%s)", tt.input, tt.expected, err, result.Inspect())
+		}
+	}
+}
+
+func TestEvalContextCanceled(t *testing.T) {
+	program := parser.New(lexer.New(`let spin = fn() { spin() }; spin()`)).ParseProgram()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result := EvalContext(ctx, program, object.NewEnvironment(), object.Limits{})
+	errObj, ok := result.(*object.Error)
+	if !ok || !errors.Is(errObj.Err, context.Canceled) {
+		t.Fatalf("expected canceled error, got %s", result.Inspect())
+	}
+}
+
+func TestBuiltinCallback(t *testing.T) {
+	builtins["apply"] = &object.Builtin{Fn: func(engine object.Engine, args ...object.Object) object.Object {
+		result, _ := engine.Call(args[0], args[1:]...)
+		return result
+	}}
+	defer delete(builtins, "apply")
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`apply(fn(x) { x * 2 }, 21)`, 42},
+		{`apply(fn(x) { apply(fn(y) { y + 1 }, x) + 1 }, 1)`, 3},
+		{`apply(len, [1, 2, 3])`, 3},
+		{`apply(fn(x) { x + true }, 1)`, "type mismatch: INTEGER + BOOLEAN"},
+		{`apply(fn(x, y) { x }, 1)`, "wrong number of arguments: want=2, got=1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let g = fn() { yield 1; yield 2 }; collect(g())`, "[1, 2]"},
+		{`let g = fn(n) { yield n; yield ...[n + 1, n + 2] }; collect(g(1))`, "[1, 2, 3]"},
+		{`let g = fn() { yield 1 }; let it = g(); next(it); next(it)`, "{value: null, done: true}"},
+		{`let g = fn() { yield 1; 1 + true }; let it = g(); next(it); next(it)`, "ERROR: type mismatch: INTEGER + BOOLEAN"},
+		{`let count = fn(n) { yield n; yield ...count(n + 1) }; len(collect(take(count(0), 3000)))`, "3000"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q: wrong result. want=%q, got=%q", tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestEndlessGeneratorLimits(t *testing.T) {
+	input := `let count = fn(n) { yield n; yield ...count(n + 1) }; collect(count(0))`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	limits := object.Limits{MaxInstructions: 10000}
+	result := EvalContext(context.Background(), program, object.NewEnvironment(), limits)
+
+	errObj, ok := result.(*object.Error)
+	if !ok || !errors.Is(errObj.Err, object.ErrInstructionLimit) {
+		t.Fatalf("expected instruction limit error, got %s", result.Inspect())
+	}
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
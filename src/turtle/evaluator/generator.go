@@ -0,0 +1,222 @@
+package evaluator
+
+import (
+	"errors"
+	"runtime"
+	"turtle/ast"
+	"turtle/object"
+)
+
+// generator is what calling a generator function returns. Its body runs in
+// a coroutine, a goroutine that takes turns with whoever advances the
+// generator, so only one of the two runs at a time.
+type generator struct {
+	co *coroutine
+
+	// delegate is the iterator a yield ...x is taking values from. If co
+	// is nil, the generator ended by handing itself over to it.
+	delegate object.Iterator
+
+	running bool
+	done    bool
+}
+
+func newGenerator(body *ast.BlockStatement, env *object.Environment) *generator {
+	co := &coroutine{
+		body:   body,
+		env:    env,
+		resume: make(chan struct{}),
+		steps:  make(chan step),
+	}
+	env.SetYielder(co.yield)
+
+	g := &generator{co: co}
+	// a generator dropped halfway would leave its coroutine waiting forever
+	runtime.SetFinalizer(g, func(g *generator) {
+		if g.co != nil {
+			g.co.stop()
+		}
+	})
+	return g
+}
+
+func (g *generator) Type() object.ObjectType { return object.ITERATOR_OBJ }
+func (g *generator) Inspect() string         { return "generator" }
+
+// Next lets the coroutine run until it yields a value. Values of delegates
+// are passed on without resuming it.
+func (g *generator) Next(engine object.Engine) (object.Object, bool, error) {
+	for {
+		if g.done {
+			return nil, true, nil
+		}
+		if g.running {
+			return nil, true, errors.New("generator is already running")
+		}
+
+		if g.delegate != nil {
+			g.running = true
+			value, done, err := g.delegate.Next(engine)
+			g.running = false
+			if err != nil {
+				g.finish()
+				return nil, true, err
+			}
+			if !done {
+				return value, false, nil
+			}
+
+			g.delegate = nil
+			if g.co == nil {
+				g.finish()
+			}
+			continue
+		}
+
+		g.running = true
+		s := g.co.next()
+		g.running = false
+
+		switch {
+		case s.err != nil:
+			g.finish()
+			if s.err.Err != nil {
+				return nil, true, s.err.Err
+			}
+			return nil, true, errors.New(s.err.Message)
+		case s.done:
+			g.finish()
+		case s.tail:
+			g.handOver(s.delegate)
+		case s.delegate != nil:
+			g.delegate = s.delegate
+		default:
+			return s.value, false, nil
+		}
+	}
+}
+
+// handOver makes g produce what it produces from now on, as a generator
+// does once it reaches a yield ...it with nothing left to do after. If it
+// is another generator, g takes over its coroutine instead of asking it for
+// each value, so generators that recurse that way run in constant space.
+func (g *generator) handOver(it object.Iterator) {
+	g.co = nil
+	g.delegate = it
+
+	other, ok := it.(*generator)
+	if !ok {
+		return
+	}
+
+	g.co, g.delegate, g.done = other.co, other.delegate, other.done
+
+	// whoever else holds other now gets its values from g
+	other.co = nil
+	other.delegate = g
+}
+
+func (g *generator) finish() {
+	g.co, g.delegate = nil, nil
+	g.done = true
+}
+
+// coroutine runs the body of a call to a generator function.
+type coroutine struct {
+	body *ast.BlockStatement
+	env  *object.Environment
+
+	started bool
+	// resume lets the body carry on after a yield. It is closed to stop
+	// the body instead.
+	resume chan struct{}
+	// steps is how the body tells the generator it yielded or ended.
+	steps chan step
+
+	// tail is what a yield ...x the body ended with handed over to.
+	tail object.Iterator
+}
+
+// step is what the body of a generator did when it stopped running: yield
+// a value, yield each of the values of delegate, hand over to delegate for
+// good if tail is set, or finish, perhaps with an error.
+type step struct {
+	value    object.Object
+	delegate object.Iterator
+	tail     bool
+	done     bool
+	err      *object.Error
+}
+
+// next runs the body until it yields or ends.
+func (co *coroutine) next() step {
+	if co.started {
+		co.resume <- struct{}{}
+	} else {
+		co.started = true
+		go co.run()
+	}
+	return <-co.steps
+}
+
+func (co *coroutine) stop() {
+	if co.started {
+		close(co.resume)
+	}
+}
+
+func (co *coroutine) run() {
+	result := Eval(co.body, co.env)
+
+	switch {
+	case co.tail != nil:
+		co.steps <- step{delegate: co.tail, tail: true}
+	case isError(result):
+		co.steps <- step{done: true, err: result.(*object.Error)}
+	default:
+		co.steps <- step{done: true}
+	}
+}
+
+// yield is the object.Yielder of the body. It runs on the goroutine of the
+// coroutine and waits there until the generator is advanced again.
+func (co *coroutine) yield(node *ast.YieldExpression, value object.Object) object.Object {
+	s := step{value: value}
+
+	if node.Delegate {
+		it, err := object.Iter(value)
+		if err != nil {
+			return newError("can't yield from %s", value.Type())
+		}
+		if other, ok := it.(*generator); ok && other.running {
+			return newError("generator is already running")
+		}
+
+		// there is nothing left to run after a tail yield, so the body
+		// returns right away and run hands over once it has
+		if node.Tail {
+			co.tail = it
+			return &object.ReturnValue{Value: NULL}
+		}
+		s = step{delegate: it}
+	}
+
+	co.steps <- s
+	if _, ok := <-co.resume; !ok {
+		runtime.Goexit()
+	}
+	return NULL
+}
+
+func evalYieldExpression(node *ast.YieldExpression, env *object.Environment) object.Object {
+	yield := env.Yielder()
+	if yield == nil {
+		return newError("yield outside of a generator")
+	}
+
+	value := Eval(node.Value, env)
+	if isError(value) {
+		return value
+	}
+	return yield(node, value)
+}
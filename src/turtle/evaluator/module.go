@@ -0,0 +1,81 @@
+package evaluator
+
+import (
+	"turtle/ast"
+	"turtle/module"
+	"turtle/object"
+)
+
+// evalTopLevelStatement evaluates a statement of a program or module, the
+// only place imports and exports may appear.
+func evalTopLevelStatement(statement ast.Statement, env *object.Environment) object.Object {
+	switch statement := statement.(type) {
+	case *ast.ImportStatement:
+		return evalImport(statement, env)
+	case *ast.ExportStatement:
+		return Eval(statement.Statement, env)
+	}
+	return Eval(statement, env)
+}
+
+// evalImport binds the name of an import to the exports of the module,
+// evaluating the module the first time it is imported.
+func evalImport(node *ast.ImportStatement, env *object.Environment) object.Object {
+	modules := env.Modules()
+
+	importer := modules.Path
+	if len(modules.Loading) > 0 {
+		importer = modules.Loading[len(modules.Loading)-1]
+	}
+	path := module.Resolve(importer, node.Path)
+
+	exports, ok := modules.Loaded[path]
+	if !ok {
+		exports = evalModule(path, env)
+		if isError(exports) {
+			return exports
+		}
+		modules.Loaded[path] = exports
+	}
+
+	env.Set(node.Name.Value, exports)
+	return nil
+}
+
+// evalModule evaluates the module at path in an environment of its own and
+// returns a hash of its exports.
+func evalModule(path string, env *object.Environment) object.Object {
+	modules := env.Modules()
+
+	loader := modules.Loader
+	if loader == nil {
+		loader = module.HostLoader(env.Host())
+	}
+
+	program, err := module.Load(loader, modules.Loading, path)
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	modules.Loading = append(modules.Loading, path)
+	defer func() { modules.Loading = modules.Loading[:len(modules.Loading)-1] }()
+
+	moduleEnv := object.NewModuleEnvironment(env)
+	for _, statement := range program.Statements {
+		result := evalTopLevelStatement(statement, moduleEnv)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+
+	exports := object.NewHash()
+	for _, name := range module.Exports(program) {
+		value, _ := moduleEnv.Get(name)
+		exports.Set(&object.String{Value: name}, value)
+	}
+	return exports
+}
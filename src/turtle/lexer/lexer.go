@@ -1,12 +1,19 @@
 package lexer
 
-import "turtle/token"
+import (
+	"strings"
+	"turtle/token"
+)
 
 type Lexer struct {
 	input        string
 	position     int  // current position in input (points to current char)
 	readPosition int  // current reading position in input (after current char)
 	ch           byte // current char under examination
+
+	// interpolations holds the number of braces open inside each ${ of a
+	// string being read, innermost last
+	interpolations []int
 }
 
 func New(input string) *Lexer {
@@ -27,6 +34,11 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.EQ, Literal: literal}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.ARROW, Literal: literal}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
@@ -55,19 +67,46 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if strings.HasPrefix(l.input[l.position:], "...") {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else if strings.HasPrefix(l.input[l.position:], "..=") {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.RANGE_INC, Literal: "..="}
+		} else if l.peekChar() == '.' {
+			l.readChar()
+			tok = token.Token{Type: token.RANGE, Literal: ".."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
 	case '{':
+		if n := len(l.interpolations); n > 0 {
+			l.interpolations[n-1]++
+		}
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
+		n := len(l.interpolations)
+		if n > 0 && l.interpolations[n-1] == 0 {
+			// the end of an interpolation, the string goes on
+			l.interpolations = l.interpolations[:n-1]
+			tok = l.readStringToken(token.STRING_PART, token.STRING_END)
+			break
+		}
+		if n > 0 {
+			l.interpolations[n-1]--
+		}
 		tok = newToken(token.RBRACE, l.ch)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok = l.readStringToken(token.STRING_START, token.STRING)
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
@@ -133,15 +172,53 @@ func (l *Lexer) readNumber() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1
+// readStringToken reads a string literal, or what follows an interpolation
+// in one, up to the closing quote, giving a token of type end. If an
+// interpolation comes first, it gives a token of type part instead and
+// leaves the lexer on the { that opens the interpolation.
+func (l *Lexer) readStringToken(part, end token.TokenType) token.Token {
+	literal, interpolated := l.readString()
+	if interpolated {
+		l.readChar()
+		l.interpolations = append(l.interpolations, 0)
+		return token.Token{Type: part, Literal: literal}
+	}
+	return token.Token{Type: end, Literal: literal}
+}
+
+// readString reads a string literal up to the closing quote or the ${ of
+// an interpolation, reporting which it stopped at. The escapes \", \\,
+// \$, \n, \t and \r stand for the characters they do in Go; a backslash
+// before anything else is kept as it is.
+func (l *Lexer) readString() (string, bool) {
+	var out strings.Builder
 	for {
 		l.readChar()
 		if l.ch == '"' || l.ch == 0 {
 			break
 		}
+		if l.ch == '$' && l.peekChar() == '{' {
+			return out.String(), true
+		}
+		if l.ch == '\\' {
+			if escaped, ok := escapes[l.peekChar()]; ok {
+				l.readChar()
+				out.WriteByte(escaped)
+				continue
+			}
+		}
+		out.WriteByte(l.ch)
 	}
-	return l.input[position:l.position]
+	return out.String(), false
+}
+
+var escapes = map[byte]byte{
+	'"':  '"',
+	'\\': '\\',
+	'$':  '$',
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
 }
 
 func isLetter(ch byte) bool {
@@ -30,6 +30,9 @@ if (5 < 10) {
 "foo bar"
 [1, 2];
 {"foo": "bar"}
+m.x [...r] => match
+1..10 a..=b
+yield
 `
 
 	tests := []struct {
@@ -122,6 +125,22 @@ if (5 < 10) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RBRACE, "}"},
+		{token.IDENT, "m"},
+		{token.DOT, "."},
+		{token.IDENT, "x"},
+		{token.LBRACKET, "["},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "r"},
+		{token.RBRACKET, "]"},
+		{token.ARROW, "=>"},
+		{token.MATCH, "match"},
+		{token.INT, "1"},
+		{token.RANGE, ".."},
+		{token.INT, "10"},
+		{token.IDENT, "a"},
+		{token.RANGE_INC, "..="},
+		{token.IDENT, "b"},
+		{token.YIELD, "yield"},
 		{token.EOF, ""},
 	}
 
@@ -141,3 +160,72 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a\"b"`, `a"b`},
+		{`"a\\b"`, `a\b`},
+		{`"a\nb\tc\rd"`, "a\nb\tc\rd"},
+		{`"a\qb"`, `a\qb`},
+		{`"\\"`, `\`},
+		{`"\${x}"`, `${x}`},
+		{`"a $ b {c}"`, `a $ b {c}`},
+	}
+
+	for _, tt := range tests {
+		tok := New(tt.input).NextToken()
+
+		if tok.Type != token.STRING {
+			t.Fatalf("%s: tokentype wrong. expected=%q, got=%q", tt.input, token.STRING, tok.Type)
+		}
+		if tok.Literal != tt.expected {
+			t.Errorf("%s: literal wrong. expected=%q, got=%q", tt.input, tt.expected, tok.Literal)
+		}
+	}
+}
+
+func TestStringInterpolation(t *testing.T) {
+	input := `"a ${x} b ${ {"k": "${y}"}["k"] } c" "${z}"`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.STRING_START, "a "},
+		{token.IDENT, "x"},
+		{token.STRING_PART, " b "},
+		{token.LBRACE, "{"},
+		{token.STRING, "k"},
+		{token.COLON, ":"},
+		{token.STRING_START, ""},
+		{token.IDENT, "y"},
+		{token.STRING_END, ""},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "k"},
+		{token.RBRACKET, "]"},
+		{token.STRING_END, " c"},
+		{token.STRING_START, ""},
+		{token.IDENT, "z"},
+		{token.STRING_END, ""},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
@@ -1,10 +1,96 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"os"
+	"turtle/checker"
+	"turtle/compiler"
+	"turtle/lexer"
+	"turtle/object"
+	"turtle/parser"
 	"turtle/repl"
+	"turtle/vm"
 )
 
+var optimize = flag.Bool("O", false, "run the peephole optimizer over compiled bytecode")
+var specialize = flag.Bool("S", false, "compile hot instruction sequences to superinstructions")
+var typeCheck = flag.Bool("typecheck", true, "type check programs before compiling them")
+
 func main() {
-	repl.Start(os.Stdin, os.Stdout)
+	flag.Parse()
+
+	if flag.NArg() > 0 {
+		os.Exit(runFile(flag.Arg(0), flag.Args()[1:]))
+	}
+
+	repl.Start(os.Stdin, os.Stdout, repl.Options{
+		Optimize:     *optimize,
+		Specialize:   *specialize,
+		TypeCheck:    *typeCheck,
+		Capabilities: object.AllCapabilities,
+	})
+}
+
+// runFile runs the script at path with args. Scripts run from the command
+// line are trusted with every capability.
+func runFile(path string, args []string) int {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 1
+	}
+
+	l := lexer.New(string(source))
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		for _, msg := range p.Errors() {
+			fmt.Fprintf(os.Stderr, "%s: parser error: %s\n", path, msg)
+		}
+		return 1
+	}
+
+	if *typeCheck {
+		errors := checker.New().Check(program)
+		for _, msg := range errors {
+			fmt.Fprintf(os.Stderr, "%s: type error: %s\n", path, msg)
+		}
+		if len(errors) != 0 {
+			return 1
+		}
+	}
+
+	host := object.NewHost(os.Stdin, os.Stdout, os.Stderr)
+	host.Capabilities = object.AllCapabilities
+	host.Args = args
+
+	comp := compiler.New()
+	comp.SetHost(host)
+	comp.SetPath(path)
+	comp.SetOptimize(*optimize)
+	comp.SetSpecialize(*specialize)
+	err = comp.Compile(program)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: compilation failed: %s\n", path, err)
+		return 1
+	}
+
+	for _, msg := range comp.Warnings() {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", path, msg)
+	}
+
+	machine := vm.New(comp.Bytecode())
+	machine.SetHost(host)
+	err = machine.Run()
+	if exit, ok := err.(*object.ExitError); ok {
+		return exit.Code
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: executing bytecode failed: %s\n", path, err)
+		return 1
+	}
+
+	return 0
 }
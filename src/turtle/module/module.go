@@ -0,0 +1,80 @@
+// Package module finds, reads and parses the files programs import. The
+// compiler and the evaluator share it, so both engines agree on what an
+// import refers to.
+package module
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"turtle/ast"
+	"turtle/lexer"
+	"turtle/object"
+	"turtle/parser"
+)
+
+// Loader returns the source of the module at path.
+type Loader func(path string) (string, error)
+
+// HostLoader returns the default Loader, which reads modules through host
+// as read_file does: only if host grants object.CapReadFiles, and from
+// under host.Root if it is set.
+func HostLoader(host *object.Host) Loader {
+	return func(path string) (string, error) {
+		if !host.Allows(object.CapReadFiles) {
+			return "", object.ErrNotPermitted
+		}
+
+		source, err := host.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return string(source), nil
+	}
+}
+
+// Resolve returns the path of the module an import of path in the file
+// importer refers to. Relative paths are relative to the importer's
+// directory, or to the working directory if importer is empty.
+func Resolve(importer, path string) string {
+	if filepath.IsAbs(path) || importer == "" {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(filepath.Dir(importer), path)
+}
+
+// Load reads and parses the module at path. loading holds the modules whose
+// imports are being loaded, outermost first; Load refuses to load one of
+// them again.
+func Load(loader Loader, loading []string, path string) (*ast.Program, error) {
+	for i, p := range loading {
+		if p == path {
+			cycle := append(loading[i:len(loading):len(loading)], path)
+			return nil, fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	source, err := loader(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't import %s: %w", path, err)
+	}
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("can't import %s: parser errors: %s", path, strings.Join(p.Errors(), "; "))
+	}
+
+	return program, nil
+}
+
+// Exports returns the names program exports, in the order it exports them.
+func Exports(program *ast.Program) []string {
+	names := []string{}
+	for _, statement := range program.Statements {
+		if export, ok := statement.(*ast.ExportStatement); ok {
+			names = append(names, export.Statement.Name.Value)
+		}
+	}
+	return names
+}
@@ -0,0 +1,75 @@
+package object
+
+import "fmt"
+
+// BindArguments matches the arguments of a call to the parameters called
+// names, of which the last numDefaults have default values. The last
+// len(keywords) of args are keyword arguments, named by keywords in order.
+//
+// It returns the value of each parameter, nil for one left to its default,
+// followed by an array of the positional arguments left over if rest is
+// set.
+func BindArguments(names []string, numDefaults int, rest bool, args []Object, keywords []string) ([]Object, error) {
+	positional := args[:len(args)-len(keywords)]
+	required := len(names) - numDefaults
+
+	if len(positional) > len(names) && !rest {
+		return nil, wrongNumberOfArguments(required, len(names), rest, len(positional))
+	}
+
+	size := len(names)
+	if rest {
+		size++
+	}
+	bound := make([]Object, size)
+	copy(bound, positional)
+
+	if rest {
+		extra := []Object{}
+		if len(positional) > len(names) {
+			extra = append(extra, positional[len(names):]...)
+		}
+		bound[len(names)] = &Array{Elements: extra}
+	}
+
+	for i, keyword := range keywords {
+		index := -1
+		for j, name := range names {
+			if name == keyword {
+				index = j
+				break
+			}
+		}
+
+		switch {
+		case index == -1:
+			return nil, fmt.Errorf("unexpected keyword argument %s", keyword)
+		case bound[index] != nil:
+			return nil, fmt.Errorf("got multiple values for argument %s", keyword)
+		}
+		bound[index] = args[len(positional)+i]
+	}
+
+	for i, name := range names[:required] {
+		if bound[i] != nil {
+			continue
+		}
+		if len(keywords) == 0 {
+			return nil, wrongNumberOfArguments(required, len(names), rest, len(positional))
+		}
+		return nil, fmt.Errorf("missing argument %s", name)
+	}
+
+	return bound, nil
+}
+
+func wrongNumberOfArguments(required, max int, rest bool, got int) error {
+	want := fmt.Sprint(required)
+	switch {
+	case rest:
+		want = fmt.Sprintf("at least %d", required)
+	case required < max:
+		want = fmt.Sprintf("%d..%d", required, max)
+	}
+	return fmt.Errorf("wrong number of arguments: want=%s, got=%d", want, got)
+}
@@ -0,0 +1,133 @@
+package object
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	ErrInstructionLimit = errors.New("instruction limit exceeded")
+	ErrAllocationLimit  = errors.New("allocation limit exceeded")
+)
+
+// Limits bound how much work a program may do. A zero field means no limit.
+type Limits struct {
+	// MaxInstructions caps the instructions the VM executes, or the nodes
+	// the evaluator evaluates.
+	MaxInstructions int64
+	// MaxAllocations caps the objects, closures and call frames created.
+	// Builtins count each element of an array and each byte of a string
+	// they build.
+	MaxAllocations int64
+}
+
+// MaxCallDepth is how deeply calls may nest, counting the top level of the
+// program as one, before they fail with a stack overflow.
+const MaxCallDepth = 1024
+
+// cancelCheckInterval is how many steps run between two looks at the
+// context, which is much slower to check than a counter.
+const cancelCheckInterval = 1024
+
+// Budget tracks what a running program has used against its Limits and
+// whether its context has been canceled. Step and Allocate return
+// ErrInstructionLimit, ErrAllocationLimit or an error wrapping ctx.Err()
+// once the program must stop.
+type Budget struct {
+	limits Limits
+	ctx    context.Context
+
+	steps       int64
+	allocations int64
+	nextCheck   int64
+	depth       int
+}
+
+func NewBudget(ctx context.Context, limits Limits) *Budget {
+	b := &Budget{}
+	b.Reset(ctx, limits)
+	return b
+}
+
+// Reset starts counting from zero under ctx and limits.
+func (b *Budget) Reset(ctx context.Context, limits Limits) {
+	b.limits = limits
+	b.ctx = ctx
+	b.steps = 0
+	b.allocations = 0
+	b.scheduleCheck()
+}
+
+// Steps returns the number of steps taken since the last Reset.
+func (b *Budget) Steps() int64 { return b.steps }
+
+// Allocations returns the number of allocations since the last Reset.
+func (b *Budget) Allocations() int64 { return b.allocations }
+
+// Step counts one instruction.
+func (b *Budget) Step() error {
+	b.steps++
+	if b.steps < b.nextCheck {
+		return nil
+	}
+	return b.check()
+}
+
+// Allocate counts one allocation.
+func (b *Budget) Allocate() error {
+	return b.AllocateN(1)
+}
+
+// AllocateN counts n allocations at once, as building an array of n
+// elements or a string of n bytes does.
+func (b *Budget) AllocateN(n int64) error {
+	if n > math.MaxInt64-b.allocations {
+		b.allocations = math.MaxInt64
+	} else {
+		b.allocations += n
+	}
+	if b.limits.MaxAllocations > 0 && b.allocations > b.limits.MaxAllocations {
+		return ErrAllocationLimit
+	}
+	return nil
+}
+
+// Enter counts a call starting and fails if calls would nest deeper than
+// MaxCallDepth. Each successful Enter must be paired with a Leave.
+func (b *Budget) Enter() error {
+	if b.depth+1 >= MaxCallDepth {
+		return errors.New("stack overflow")
+	}
+	b.depth++
+	return nil
+}
+
+// Leave counts a call returning.
+func (b *Budget) Leave() { b.depth-- }
+
+func (b *Budget) check() error {
+	if b.limits.MaxInstructions > 0 && b.steps > b.limits.MaxInstructions {
+		return ErrInstructionLimit
+	}
+
+	select {
+	case <-b.ctx.Done():
+		return fmt.Errorf("execution stopped: %w", b.ctx.Err())
+	default:
+	}
+
+	b.scheduleCheck()
+	return nil
+}
+
+func (b *Budget) scheduleCheck() {
+	b.nextCheck = math.MaxInt64
+	if b.ctx.Done() != nil {
+		b.nextCheck = b.steps + cancelCheckInterval
+	}
+	if b.limits.MaxInstructions > 0 && b.limits.MaxInstructions+1 < b.nextCheck {
+		b.nextCheck = b.limits.MaxInstructions + 1
+	}
+}
@@ -1,6 +1,15 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
 
 var Builtins = []struct {
 	Name    string
@@ -8,7 +17,7 @@ var Builtins = []struct {
 }{
 	{
 		"len",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
 					len(args))
@@ -28,9 +37,9 @@ var Builtins = []struct {
 	},
 	{
 		"puts",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
 			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+				fmt.Fprintln(engine.Host().Stdout, arg.Inspect())
 			}
 
 			return nil
@@ -39,7 +48,7 @@ var Builtins = []struct {
 	},
 	{
 		"first",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
 					len(args))
@@ -60,7 +69,7 @@ var Builtins = []struct {
 	},
 	{
 		"last",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
 					len(args))
@@ -82,7 +91,7 @@ var Builtins = []struct {
 	},
 	{
 		"rest",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
 			if len(args) != 1 {
 				return newError("wrong number of arguments. got=%d, want=1",
 					len(args))
@@ -106,7 +115,7 @@ var Builtins = []struct {
 	},
 	{
 		"push",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
 			if len(args) != 2 {
 				return newError("wrong number of arguments. got=%d, want=2",
 					len(args))
@@ -127,12 +136,1783 @@ var Builtins = []struct {
 		},
 		},
 	},
+	{
+		"gets",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0",
+					len(args))
+			}
+
+			line, err := engine.Host().Stdin.ReadString('\n')
+			if err != nil && line == "" {
+				return nil
+			}
+
+			line = strings.TrimSuffix(line, "\n")
+			return &String{Value: strings.TrimSuffix(line, "\r")}
+		},
+		},
+	},
+	{
+		"warn",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			for _, arg := range args {
+				fmt.Fprintln(engine.Host().Stderr, arg.Inspect())
+			}
+
+			return nil
+		},
+		},
+	},
+	{
+		"map",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 2); err != nil {
+				return err
+			}
+			arr, err := arrayArg("map", args, 0)
+			if err != nil {
+				return err
+			}
+
+			if err := allocate(engine, int64(len(arr.Elements))); err != nil {
+				return err
+			}
+
+			elements := make([]Object, len(arr.Elements))
+			for i, el := range arr.Elements {
+				result, err := engine.Call(args[1], el)
+				if err != nil {
+					return callbackError(err)
+				}
+				elements[i] = result
+			}
+
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"filter",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 2); err != nil {
+				return err
+			}
+			arr, err := arrayArg("filter", args, 0)
+			if err != nil {
+				return err
+			}
+
+			elements := []Object{}
+			for _, el := range arr.Elements {
+				keep, err := engine.Call(args[1], el)
+				if err != nil {
+					return callbackError(err)
+				}
+				if isTruthy(keep) {
+					elements = append(elements, el)
+				}
+			}
+
+			if err := allocate(engine, int64(len(elements))); err != nil {
+				return err
+			}
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"reduce",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 3); err != nil {
+				return err
+			}
+			arr, err := arrayArg("reduce", args, 0)
+			if err != nil {
+				return err
+			}
+
+			elements := arr.Elements
+			var acc Object
+			if len(args) == 3 {
+				acc = args[2]
+			} else {
+				if len(elements) == 0 {
+					return nil
+				}
+				acc, elements = elements[0], elements[1:]
+			}
+
+			for _, el := range elements {
+				result, err := engine.Call(args[1], acc, el)
+				if err != nil {
+					return callbackError(err)
+				}
+				acc = result
+			}
+
+			return acc
+		},
+		},
+	},
+	{
+		"sort",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 2); err != nil {
+				return err
+			}
+			arr, err := arrayArg("sort", args, 0)
+			if err != nil {
+				return err
+			}
+
+			if len(args) == 1 {
+				return sortArray(arr.Elements, arr.Elements, compareObjects)
+			}
+
+			// the comparator returns whether its first argument goes first
+			return sortArray(arr.Elements, arr.Elements, func(a, b Object) (bool, error) {
+				less, err := engine.Call(args[1], a, b)
+				if err != nil {
+					return false, err
+				}
+				return isTruthy(less), nil
+			})
+		},
+		},
+	},
+	{
+		"sort_by",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 2); err != nil {
+				return err
+			}
+			arr, err := arrayArg("sort_by", args, 0)
+			if err != nil {
+				return err
+			}
+
+			keys := make([]Object, len(arr.Elements))
+			for i, el := range arr.Elements {
+				key, err := engine.Call(args[1], el)
+				if err != nil {
+					return callbackError(err)
+				}
+				keys[i] = key
+			}
+
+			return sortArray(arr.Elements, keys, compareObjects)
+		},
+		},
+	},
+	{
+		"zip",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if len(args) == 0 {
+				return newError("wrong number of arguments. got=0, want at least 1")
+			}
+
+			arrays := make([]*Array, len(args))
+			length := -1
+			for i := range args {
+				arr, err := arrayArg("zip", args, i)
+				if err != nil {
+					return err
+				}
+				arrays[i] = arr
+				if length == -1 || len(arr.Elements) < length {
+					length = len(arr.Elements)
+				}
+			}
+
+			if err := allocate(engine, int64(length*(len(arrays)+1))); err != nil {
+				return err
+			}
+
+			tuples := make([]Object, length)
+			for i := range tuples {
+				tuple := make([]Object, len(arrays))
+				for j, arr := range arrays {
+					tuple[j] = arr.Elements[i]
+				}
+				tuples[i] = &Array{Elements: tuple}
+			}
+
+			return &Array{Elements: tuples}
+		},
+		},
+	},
+	{
+		"enumerate",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+			arr, err := arrayArg("enumerate", args, 0)
+			if err != nil {
+				return err
+			}
+
+			if err := allocate(engine, int64(len(arr.Elements)*3)); err != nil {
+				return err
+			}
+
+			pairs := make([]Object, len(arr.Elements))
+			for i, el := range arr.Elements {
+				pairs[i] = &Array{Elements: []Object{&Integer{Value: int64(i)}, el}}
+			}
+
+			return &Array{Elements: pairs}
+		},
+		},
+	},
+	{
+		"any",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			return testElements(engine, "any", args, true)
+		},
+		},
+	},
+	{
+		"all",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			return testElements(engine, "all", args, false)
+		},
+		},
+	},
+	{
+		"range",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 3); err != nil {
+				return err
+			}
+
+			bounds := make([]int64, len(args))
+			for i, arg := range args {
+				integer, ok := arg.(*Integer)
+				if !ok {
+					return newError("argument to `range` must be INTEGER, got %s", arg.Type())
+				}
+				bounds[i] = integer.Value
+			}
+
+			start, end, step := int64(0), bounds[0], int64(1)
+			if len(bounds) > 1 {
+				start, end = bounds[0], bounds[1]
+			}
+			if len(bounds) > 2 {
+				step = bounds[2]
+			}
+			if step == 0 {
+				return newError("step of `range` must not be 0")
+			}
+
+			length := rangeLength(start, end, step)
+			if err := allocate(engine, length); err != nil {
+				return err
+			}
+			if length > math.MaxInt32 {
+				return newError("result of `range` is too long")
+			}
+
+			elements := make([]Object, length)
+			for i := range elements {
+				elements[i] = &Integer{Value: start + int64(i)*step}
+			}
+
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"reverse",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+			arr, err := arrayArg("reverse", args, 0)
+			if err != nil {
+				return err
+			}
+
+			length := len(arr.Elements)
+			if err := allocate(engine, int64(length)); err != nil {
+				return err
+			}
+
+			elements := make([]Object, length)
+			for i, el := range arr.Elements {
+				elements[length-1-i] = el
+			}
+
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"concat",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			elements := []Object{}
+			for i := range args {
+				arr, err := arrayArg("concat", args, i)
+				if err != nil {
+					return err
+				}
+				if err := allocate(engine, int64(len(arr.Elements))); err != nil {
+					return err
+				}
+				elements = append(elements, arr.Elements...)
+			}
+
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"slice",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 3); err != nil {
+				return err
+			}
+			arr, err := arrayArg("slice", args, 0)
+			if err != nil {
+				return err
+			}
+
+			bounds := []int64{0, int64(len(arr.Elements))}
+			for i, arg := range args[1:] {
+				integer, ok := arg.(*Integer)
+				if !ok {
+					return newError("argument to `slice` must be INTEGER, got %s", arg.Type())
+				}
+				bounds[i] = integer.Value
+			}
+
+			return arr.Slice(bounds[0], bounds[1])
+		},
+		},
+	},
+	{
+		"keys",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+			hash, err := hashArg("keys", args, 0)
+			if err != nil {
+				return err
+			}
+
+			if err := allocate(engine, int64(len(hash.Keys))); err != nil {
+				return err
+			}
+
+			keys := make([]Object, 0, len(hash.Keys))
+			for _, pair := range hash.OrderedPairs() {
+				keys = append(keys, pair.Key)
+			}
+
+			return &Array{Elements: keys}
+		},
+		},
+	},
+	{
+		"values",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+			hash, err := hashArg("values", args, 0)
+			if err != nil {
+				return err
+			}
+
+			if err := allocate(engine, int64(len(hash.Keys))); err != nil {
+				return err
+			}
+
+			values := make([]Object, 0, len(hash.Keys))
+			for _, pair := range hash.OrderedPairs() {
+				values = append(values, pair.Value)
+			}
+
+			return &Array{Elements: values}
+		},
+		},
+	},
+	{
+		"entries",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+			hash, err := hashArg("entries", args, 0)
+			if err != nil {
+				return err
+			}
+
+			if err := allocate(engine, int64(len(hash.Keys)*3)); err != nil {
+				return err
+			}
+
+			entries := make([]Object, 0, len(hash.Keys))
+			for _, pair := range hash.OrderedPairs() {
+				entries = append(entries, &Array{Elements: []Object{pair.Key, pair.Value}})
+			}
+
+			return &Array{Elements: entries}
+		},
+		},
+	},
+	{
+		"has",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 2); err != nil {
+				return err
+			}
+			hash, err := hashArg("has", args, 0)
+			if err != nil {
+				return err
+			}
+			key, ok := args[1].(Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+
+			_, found := hash.Pairs[key.HashKey()]
+			return NativeBool(found)
+		},
+		},
+	},
+	{
+		"delete",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 2); err != nil {
+				return err
+			}
+			hash, err := hashArg("delete", args, 0)
+			if err != nil {
+				return err
+			}
+			key, ok := args[1].(Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+
+			if err := allocate(engine, int64(len(hash.Keys))); err != nil {
+				return err
+			}
+
+			deleted := key.HashKey()
+			result := NewHash()
+			for _, pair := range hash.OrderedPairs() {
+				if pair.Key.(Hashable).HashKey() != deleted {
+					result.Set(pair.Key.(Hashable), pair.Value)
+				}
+			}
+
+			return result
+		},
+		},
+	},
+	{
+		"merge",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if len(args) == 0 {
+				return newError("wrong number of arguments. got=0, want at least 1")
+			}
+
+			result := NewHash()
+			for i := range args {
+				hash, err := hashArg("merge", args, i)
+				if err != nil {
+					return err
+				}
+				if err := allocate(engine, int64(len(hash.Keys))); err != nil {
+					return err
+				}
+				for _, pair := range hash.OrderedPairs() {
+					result.Set(pair.Key.(Hashable), pair.Value)
+				}
+			}
+
+			return result
+		},
+		},
+	},
+	{
+		"split",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 2); err != nil {
+				return err
+			}
+			strs, err := stringArgs("split", args)
+			if err != nil {
+				return err
+			}
+
+			parts := strings.Split(strs[0], strs[1])
+			if err := allocate(engine, int64(len(parts)+len(strs[0]))); err != nil {
+				return err
+			}
+			return stringArray(parts)
+		},
+		},
+	},
+	{
+		"join",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 2); err != nil {
+				return err
+			}
+			arr, err := arrayArg("join", args, 0)
+			if err != nil {
+				return err
+			}
+			sep, err := stringArg("join", args, 1)
+			if err != nil {
+				return err
+			}
+
+			parts := make([]string, len(arr.Elements))
+			size := len(sep) * len(parts)
+			for i, el := range arr.Elements {
+				parts[i] = el.Inspect()
+				size += len(parts[i])
+			}
+			if err := allocate(engine, int64(size)); err != nil {
+				return err
+			}
+
+			return &String{Value: strings.Join(parts, sep)}
+		},
+		},
+	},
+	{
+		"trim",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			return mapString("trim", args, strings.TrimSpace)
+		},
+		},
+	},
+	{
+		"upper",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			return mapString("upper", args, strings.ToUpper)
+		},
+		},
+	},
+	{
+		"lower",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			return mapString("lower", args, strings.ToLower)
+		},
+		},
+	},
+	{
+		"contains",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			return testStrings("contains", args, strings.Contains)
+		},
+		},
+	},
+	{
+		"starts_with",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			return testStrings("starts_with", args, strings.HasPrefix)
+		},
+		},
+	},
+	{
+		"ends_with",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			return testStrings("ends_with", args, strings.HasSuffix)
+		},
+		},
+	},
+	{
+		"replace",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 3, 3); err != nil {
+				return err
+			}
+			strs, err := stringArgs("replace", args)
+			if err != nil {
+				return err
+			}
+
+			matches := int64(strings.Count(strs[0], strs[1]))
+			size := int64(len(strs[0])) + matches*int64(len(strs[2]))
+			if err := allocate(engine, size); err != nil {
+				return err
+			}
+
+			return &String{Value: strings.ReplaceAll(strs[0], strs[1], strs[2])}
+		},
+		},
+	},
+	{
+		"index_of",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 2); err != nil {
+				return err
+			}
+			strs, err := stringArgs("index_of", args)
+			if err != nil {
+				return err
+			}
+
+			index := strings.Index(strs[0], strs[1])
+			if index > 0 {
+				index = utf8.RuneCountInString(strs[0][:index])
+			}
+
+			return &Integer{Value: int64(index)}
+		},
+		},
+	},
+	{
+		"substr",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 3); err != nil {
+				return err
+			}
+			str, err := stringArg("substr", args, 0)
+			if err != nil {
+				return err
+			}
+
+			runes := []rune(str)
+			length := int64(len(runes))
+
+			start, ok := args[1].(*Integer)
+			if !ok {
+				return newError("argument to `substr` must be INTEGER, got %s", args[1].Type())
+			}
+			from, to := clampIndex(start.Value, length), length
+
+			if len(args) == 3 {
+				count, ok := args[2].(*Integer)
+				if !ok {
+					return newError("argument to `substr` must be INTEGER, got %s", args[2].Type())
+				}
+				if count.Value < 0 {
+					return newError("length for `substr` must not be negative, got %d", count.Value)
+				}
+				if from+count.Value < to {
+					to = from + count.Value
+				}
+			}
+
+			return &String{Value: string(runes[from:to])}
+		},
+		},
+	},
+	{
+		"repeat",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 2); err != nil {
+				return err
+			}
+			str, err := stringArg("repeat", args, 0)
+			if err != nil {
+				return err
+			}
+
+			count, ok := args[1].(*Integer)
+			if !ok {
+				return newError("argument to `repeat` must be INTEGER, got %s", args[1].Type())
+			}
+			if count.Value < 0 {
+				return newError("count for `repeat` must not be negative, got %d", count.Value)
+			}
+			size := int64(math.MaxInt64)
+			if len(str) == 0 || count.Value <= size/int64(len(str)) {
+				size = int64(len(str)) * count.Value
+			}
+			if err := allocate(engine, size); err != nil {
+				return err
+			}
+			if size > math.MaxInt32 {
+				return newError("result of `repeat` is too long")
+			}
+
+			return &String{Value: strings.Repeat(str, int(count.Value))}
+		},
+		},
+	},
+	{
+		"chars",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+			str, err := stringArg("chars", args, 0)
+			if err != nil {
+				return err
+			}
+
+			if err := allocate(engine, int64(utf8.RuneCountInString(str)+len(str))); err != nil {
+				return err
+			}
+
+			chars := []string{}
+			for _, r := range str {
+				chars = append(chars, string(r))
+			}
+
+			return stringArray(chars)
+		},
+		},
+	},
+	{
+		"format",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			return format("format", args)
+		},
+		},
+	},
+	{
+		"sprintf",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			return format("sprintf", args)
+		},
+		},
+	},
+	{
+		"type",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+
+			return &String{Value: string(typeName(args[0]))}
+		},
+		},
+	},
+	{
+		"int",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+
+			switch arg := args[0].(type) {
+			case *Integer:
+				return arg
+			case *Float:
+				return roundFloat("int", args, math.Trunc)
+			case *String:
+				value, err := strconv.ParseInt(strings.TrimSpace(arg.Value), 10, 64)
+				if err != nil {
+					return newError("cannot convert %q to INTEGER", arg.Value)
+				}
+				return &Integer{Value: value}
+			case *Boolean:
+				if arg.Value {
+					return &Integer{Value: 1}
+				}
+				return &Integer{Value: 0}
+			}
+
+			return newError("argument to `int` not supported, got %s", args[0].Type())
+		},
+		},
+	},
+	{
+		"float",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+
+			switch arg := args[0].(type) {
+			case *Integer:
+				return &Float{Value: float64(arg.Value)}
+			case *Float:
+				return arg
+			case *String:
+				value, err := strconv.ParseFloat(strings.TrimSpace(arg.Value), 64)
+				if err != nil {
+					return newError("cannot convert %q to FLOAT", arg.Value)
+				}
+				return &Float{Value: value}
+			case *Boolean:
+				if arg.Value {
+					return &Float{Value: 1}
+				}
+				return &Float{Value: 0}
+			}
+
+			return newError("argument to `float` not supported, got %s", args[0].Type())
+		},
+		},
+	},
+	{
+		"str",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+			if str, ok := args[0].(*String); ok {
+				return str
+			}
+
+			return &String{Value: args[0].Inspect()}
+		},
+		},
+	},
+	{
+		"bool",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+
+			return NativeBool(isTruthy(args[0]))
+		},
+		},
+	},
+	{"is_int", isType(INTEGER_OBJ)},
+	{"is_float", isType(FLOAT_OBJ)},
+	{"is_string", isType(STRING_OBJ)},
+	{"is_bool", isType(BOOLEAN_OBJ)},
+	{"is_null", isType(NULL_OBJ)},
+	{"is_array", isType(ARRAY_OBJ)},
+	{"is_hash", isType(HASH_OBJ)},
+	{"is_function", isType(FUNCTION_OBJ, BUILTIN_OBJ)},
+	{
+		"abs",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+
+			switch arg := args[0].(type) {
+			case *Integer:
+				if arg.Value < 0 {
+					return &Integer{Value: -arg.Value}
+				}
+				return arg
+			case *Float:
+				return &Float{Value: math.Abs(arg.Value)}
+			}
+
+			return newError("argument to `abs` must be a number, got %s", args[0].Type())
+		},
+		},
+	},
+	{
+		"min",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			return extreme("min", args, func(a, b float64) bool { return a < b })
+		},
+		},
+	},
+	{
+		"max",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			return extreme("max", args, func(a, b float64) bool { return a > b })
+		},
+		},
+	},
+	{
+		"pow",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 2); err != nil {
+				return err
+			}
+
+			base, baseOk := args[0].(*Integer)
+			exp, expOk := args[1].(*Integer)
+			if baseOk && expOk && exp.Value >= 0 {
+				if result, ok := powInt(base.Value, exp.Value); ok {
+					return &Integer{Value: result}
+				}
+				// too big for an integer, so the result is a float
+			}
+
+			values, err := numberArgs("pow", args)
+			if err != nil {
+				return err
+			}
+			return &Float{Value: math.Pow(values[0], values[1])}
+		},
+		},
+	},
+	{
+		"sqrt",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+			values, err := numberArgs("sqrt", args)
+			if err != nil {
+				return err
+			}
+			if values[0] < 0 {
+				return newError("argument to `sqrt` must not be negative, got %s", args[0].Inspect())
+			}
+
+			return &Float{Value: math.Sqrt(values[0])}
+		},
+		},
+	},
+	{
+		"floor",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			return roundFloat("floor", args, math.Floor)
+		},
+		},
+	},
+	{
+		"ceil",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			return roundFloat("ceil", args, math.Ceil)
+		},
+		},
+	},
+	{
+		"round",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			return roundFloat("round", args, math.Round)
+		},
+		},
+	},
+	{
+		"clamp",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 3, 3); err != nil {
+				return err
+			}
+			values, err := numberArgs("clamp", args)
+			if err != nil {
+				return err
+			}
+			if values[1] > values[2] {
+				return newError("bounds for `clamp` are reversed: %s > %s",
+					args[1].Inspect(), args[2].Inspect())
+			}
+
+			switch {
+			case values[0] < values[1]:
+				return args[1]
+			case values[0] > values[2]:
+				return args[2]
+			}
+			return args[0]
+		},
+		},
+	},
+	{
+		"gcd",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 2); err != nil {
+				return err
+			}
+
+			a, aOk := args[0].(*Integer)
+			b, bOk := args[1].(*Integer)
+			if !aOk || !bOk {
+				return newError("arguments to `gcd` must be INTEGER, got %s and %s",
+					args[0].Type(), args[1].Type())
+			}
+
+			x, y := a.Value, b.Value
+			for y != 0 {
+				x, y = y, x%y
+			}
+			if x < 0 {
+				x = -x
+			}
+			return &Integer{Value: x}
+		},
+		},
+	},
+	{
+		"random",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 0, 0); err != nil {
+				return err
+			}
+
+			return &Float{Value: engine.Host().RandomFloat()}
+		},
+		},
+	},
+	{
+		"random_int",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 2); err != nil {
+				return err
+			}
+
+			bounds := []int64{0, 0}
+			for i, arg := range args {
+				integer, ok := arg.(*Integer)
+				if !ok {
+					return newError("argument to `random_int` must be INTEGER, got %s", arg.Type())
+				}
+				bounds[i+2-len(args)] = integer.Value
+			}
+
+			low, high := bounds[0], bounds[1]
+			if low >= high {
+				return newError("empty range for `random_int`: %d..%d", low, high)
+			}
+			// the span of the full int64 range only fits in a uint64, and
+			// adding the draw back wraps around to the right value
+			span := uint64(high) - uint64(low)
+			return &Integer{Value: low + int64(engine.Host().RandomInt(span))}
+		},
+		},
+	},
+	{
+		"seed",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := requireCapability(engine, "seed", CapSeed); err != nil {
+				return err
+			}
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+			seed, ok := args[0].(*Integer)
+			if !ok {
+				return newError("argument to `seed` must be INTEGER, got %s", args[0].Type())
+			}
+
+			engine.Host().Seed(uint64(seed.Value))
+			return nil
+		},
+		},
+	},
+	{
+		"json_parse",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+			input, err := stringArg("json_parse", args, 0)
+			if err != nil {
+				return err
+			}
+
+			value, parseErr := parseJSON(input)
+			if parseErr != nil {
+				return newError("invalid JSON: %s", parseErr)
+			}
+			return value
+		},
+		},
+	},
+	{
+		"json_stringify",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 2); err != nil {
+				return err
+			}
+
+			indent := ""
+			if len(args) == 2 {
+				switch arg := args[1].(type) {
+				case *Integer:
+					if arg.Value < 0 || arg.Value > 10 {
+						return newError("indent for `json_stringify` must be between 0 and 10, got %d", arg.Value)
+					}
+					indent = strings.Repeat(" ", int(arg.Value))
+				case *String:
+					indent = arg.Value
+				default:
+					return newError("indent for `json_stringify` must be INTEGER or STRING, got %s", arg.Type())
+				}
+			}
+
+			json, err := stringifyJSON(args[0], indent)
+			if err != nil {
+				return newError("%s", err)
+			}
+			return &String{Value: json}
+		},
+		},
+	},
+	{
+		"read_file",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+			if err := requireCapability(engine, "read_file", CapReadFiles); err != nil {
+				return err
+			}
+			path, err := stringArg("read_file", args, 0)
+			if err != nil {
+				return err
+			}
+
+			data, readErr := engine.Host().ReadFile(path)
+			if readErr != nil {
+				return newError("`read_file` failed: %s", readErr)
+			}
+			return &String{Value: string(data)}
+		},
+		},
+	},
+	{
+		"write_file",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 2); err != nil {
+				return err
+			}
+			if err := requireCapability(engine, "write_file", CapWriteFiles); err != nil {
+				return err
+			}
+			strs, err := stringArgs("write_file", args)
+			if err != nil {
+				return err
+			}
+
+			if writeErr := engine.Host().WriteFile(strs[0], []byte(strs[1])); writeErr != nil {
+				return newError("`write_file` failed: %s", writeErr)
+			}
+			return nil
+		},
+		},
+	},
+	{
+		"list_dir",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+			if err := requireCapability(engine, "list_dir", CapReadFiles); err != nil {
+				return err
+			}
+			path, err := stringArg("list_dir", args, 0)
+			if err != nil {
+				return err
+			}
+
+			names, readErr := engine.Host().ReadDir(path)
+			if readErr != nil {
+				return newError("`list_dir` failed: %s", readErr)
+			}
+			return stringArray(names)
+		},
+		},
+	},
+	{
+		"getenv",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+			if err := requireCapability(engine, "getenv", CapEnv); err != nil {
+				return err
+			}
+			name, err := stringArg("getenv", args, 0)
+			if err != nil {
+				return err
+			}
+
+			value, ok := os.LookupEnv(name)
+			if !ok {
+				return nil
+			}
+			return &String{Value: value}
+		},
+		},
+	},
+	{
+		"args",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 0, 0); err != nil {
+				return err
+			}
+			if err := requireCapability(engine, "args", CapArgs); err != nil {
+				return err
+			}
+
+			return stringArray(engine.Host().Args)
+		},
+		},
+	},
+	{
+		"exit",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 0, 1); err != nil {
+				return err
+			}
+			if err := requireCapability(engine, "exit", CapExit); err != nil {
+				return err
+			}
+
+			code := int64(0)
+			if len(args) == 1 {
+				integer, ok := args[0].(*Integer)
+				if !ok {
+					return newError("argument to `exit` must be INTEGER, got %s", args[0].Type())
+				}
+				code = integer.Value
+			}
+
+			exit := &ExitError{Code: int(code)}
+			return &Error{Message: exit.Error(), Err: exit}
+		},
+		},
+	},
+	{
+		"iter",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+
+			it, err := iterArg("iter", args, 0)
+			if err != nil {
+				return err
+			}
+			return it
+		},
+		},
+	},
+	{
+		"next",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+			it, ok := args[0].(Iterator)
+			if !ok {
+				return newError("argument to `next` must be ITERATOR, got %s", args[0].Type())
+			}
+
+			value, done, err := it.Next(engine)
+			if err != nil {
+				return callbackError(err)
+			}
+			return IterResult(value, done)
+		},
+		},
+	},
+	{
+		"collect",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 1, 1); err != nil {
+				return err
+			}
+			it, errObj := iterArg("collect", args, 0)
+			if errObj != nil {
+				return errObj
+			}
+
+			elements := []Object{}
+			for {
+				value, done, err := it.Next(engine)
+				if err != nil {
+					return callbackError(err)
+				}
+				if done {
+					return &Array{Elements: elements}
+				}
+				if err := allocate(engine, 1); err != nil {
+					return err
+				}
+				elements = append(elements, value)
+			}
+		},
+		},
+	},
+	{
+		"take",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 2); err != nil {
+				return err
+			}
+			it, err := iterArg("take", args, 0)
+			if err != nil {
+				return err
+			}
+			n, ok := args[1].(*Integer)
+			if !ok {
+				return newError("second argument to `take` must be INTEGER, got %s", args[1].Type())
+			}
+
+			return &takeIterator{source: it, left: n.Value}
+		},
+		},
+	},
+	{
+		"map_iter",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 2); err != nil {
+				return err
+			}
+			it, err := iterArg("map_iter", args, 0)
+			if err != nil {
+				return err
+			}
+
+			return &mapIterator{source: it, fn: args[1]}
+		},
+		},
+	},
+	{
+		"filter_iter",
+		&Builtin{Fn: func(engine Engine, args ...Object) Object {
+			if err := checkArgs(args, 2, 2); err != nil {
+				return err
+			}
+			it, err := iterArg("filter_iter", args, 0)
+			if err != nil {
+				return err
+			}
+
+			return &filterIterator{source: it, fn: args[1]}
+		},
+		},
+	},
+}
+
+// Constants are the predefined values every program can refer to by name.
+var Constants = []struct {
+	Name  string
+	Value Object
+}{
+	{"PI", &Float{Value: math.Pi}},
+	{"E", &Float{Value: math.E}},
 }
 
 func newError(format string, a ...interface{}) *Error {
 	return &Error{Message: fmt.Sprintf(format, a...)}
 }
 
+// checkArgs returns an error unless args has between min and max elements.
+func checkArgs(args []Object, min, max int) *Error {
+	if len(args) >= min && len(args) <= max {
+		return nil
+	}
+	if min == max {
+		return newError("wrong number of arguments. got=%d, want=%d", len(args), min)
+	}
+	return newError("wrong number of arguments. got=%d, want=%d..%d", len(args), min, max)
+}
+
+// arrayArg returns args[i] if it is an array.
+func arrayArg(name string, args []Object, i int) (*Array, *Error) {
+	arr, ok := args[i].(*Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be ARRAY, got %s", name, args[i].Type())
+	}
+	return arr, nil
+}
+
+// iterArg returns an iterator over args[i], which may be an array, a string
+// or an iterator.
+func iterArg(name string, args []Object, i int) (Iterator, *Error) {
+	it, err := Iter(args[i])
+	if err != nil {
+		return nil, newError("argument to `%s` must be ITERATOR, ARRAY or STRING, got %s", name, args[i].Type())
+	}
+	return it, nil
+}
+
+// hashArg returns args[i] if it is a hash.
+func hashArg(name string, args []Object, i int) (*Hash, *Error) {
+	hash, ok := args[i].(*Hash)
+	if !ok {
+		return nil, newError("argument to `%s` must be HASH, got %s", name, args[i].Type())
+	}
+	return hash, nil
+}
+
+// stringArg returns the value of args[i] if it is a string.
+func stringArg(name string, args []Object, i int) (string, *Error) {
+	str, ok := args[i].(*String)
+	if !ok {
+		return "", newError("argument to `%s` must be STRING, got %s", name, args[i].Type())
+	}
+	return str.Value, nil
+}
+
+// stringArgs returns the values of args, which must all be strings.
+func stringArgs(name string, args []Object) ([]string, *Error) {
+	strs := make([]string, len(args))
+	for i := range args {
+		str, err := stringArg(name, args, i)
+		if err != nil {
+			return nil, err
+		}
+		strs[i] = str
+	}
+	return strs, nil
+}
+
+func stringArray(strs []string) *Array {
+	elements := make([]Object, len(strs))
+	for i, str := range strs {
+		elements[i] = &String{Value: str}
+	}
+	return &Array{Elements: elements}
+}
+
+// mapString implements the builtins that turn one string into another.
+func mapString(name string, args []Object, fn func(string) string) Object {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return err
+	}
+	str, err := stringArg(name, args, 0)
+	if err != nil {
+		return err
+	}
+	return &String{Value: fn(str)}
+}
+
+// testStrings implements the builtins that compare a string with another.
+func testStrings(name string, args []Object, fn func(s, substr string) bool) Object {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return err
+	}
+	strs, err := stringArgs(name, args)
+	if err != nil {
+		return err
+	}
+	return NativeBool(fn(strs[0], strs[1]))
+}
+
+// format implements format and sprintf. %d takes an integer, %s a string
+// and %v any value; %% is a literal percent sign.
+func format(name string, args []Object) Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want at least 1")
+	}
+	layout, err := stringArg(name, args, 0)
+	if err != nil {
+		return err
+	}
+
+	var out strings.Builder
+	values := args[1:]
+	next := 0
+
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			out.WriteByte(layout[i])
+			continue
+		}
+
+		i++
+		if i == len(layout) {
+			return newError("`%s` layout ends with %%", name)
+		}
+
+		verb := layout[i]
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+
+		if next == len(values) {
+			return newError("missing argument for %%%c in `%s`", verb, name)
+		}
+		value := values[next]
+		next++
+
+		switch verb {
+		case 'd':
+			integer, ok := value.(*Integer)
+			if !ok {
+				return newError("%%d in `%s` needs INTEGER, got %s", name, value.Type())
+			}
+			out.WriteString(strconv.FormatInt(integer.Value, 10))
+		case 's':
+			str, ok := value.(*String)
+			if !ok {
+				return newError("%%s in `%s` needs STRING, got %s", name, value.Type())
+			}
+			out.WriteString(str.Value)
+		case 'v':
+			out.WriteString(value.Inspect())
+		default:
+			return newError("unknown verb %%%c in `%s`", verb, name)
+		}
+	}
+
+	if next < len(values) {
+		return newError("too many arguments for `%s`: %d unused", name, len(values)-next)
+	}
+
+	return &String{Value: out.String()}
+}
+
+// typeName returns the type of obj as scripts see it. Functions are
+// FUNCTION whether the evaluator or the VM made them.
+func typeName(obj Object) ObjectType {
+	switch obj.(type) {
+	case *Closure, *CompiledFunction:
+		return FUNCTION_OBJ
+	}
+	return obj.Type()
+}
+
+// isType returns the builtin behind the is_* predicates, which test for
+// any of types.
+func isType(types ...ObjectType) *Builtin {
+	return &Builtin{Fn: func(engine Engine, args ...Object) Object {
+		if err := checkArgs(args, 1, 1); err != nil {
+			return err
+		}
+		return NativeBool(slices.Contains(types, typeName(args[0])))
+	}}
+}
+
+// numberArgs returns the values of args, which must all be numbers.
+func numberArgs(name string, args []Object) ([]float64, *Error) {
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		value, ok := FloatValue(arg)
+		if !ok {
+			return nil, newError("argument to `%s` must be a number, got %s", name, arg.Type())
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// extreme implements min and max, which take either numbers or a single
+// array of numbers and return the one for which better holds against all
+// others.
+func extreme(name string, args []Object, better func(a, b float64) bool) Object {
+	if len(args) == 1 {
+		if arr, ok := args[0].(*Array); ok {
+			args = arr.Elements
+		}
+	}
+	if len(args) == 0 {
+		return newError("`%s` needs at least one number", name)
+	}
+
+	values, err := numberArgs(name, args)
+	if err != nil {
+		return err
+	}
+
+	best := 0
+	for i := range values {
+		if better(values[i], values[best]) {
+			best = i
+		}
+	}
+	return args[best]
+}
+
+// roundFloat implements floor, ceil and round, which turn numbers into
+// integers.
+func roundFloat(name string, args []Object, round func(float64) float64) Object {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return err
+	}
+
+	switch arg := args[0].(type) {
+	case *Integer:
+		return arg
+	case *Float:
+		value := round(arg.Value)
+		if math.IsNaN(value) || value < math.MinInt64 || value >= math.MaxInt64 {
+			return newError("cannot convert %s to INTEGER", arg.Inspect())
+		}
+		return &Integer{Value: int64(value)}
+	}
+
+	return newError("argument to `%s` must be a number, got %s", name, args[0].Type())
+}
+
+// requireCapability returns an error unless the host grants c to name.
+func requireCapability(engine Engine, name string, c Capability) *Error {
+	if engine.Host().Allows(c) {
+		return nil
+	}
+	return &Error{
+		Message: fmt.Sprintf("`%s` is %s", name, ErrNotPermitted),
+		Err:     ErrNotPermitted,
+	}
+}
+
+// allocate charges the budget of engine for the n elements or bytes of an
+// array or string a builtin is about to build.
+func allocate(engine Engine, n int64) *Error {
+	if err := engine.Budget().AllocateN(n); err != nil {
+		return &Error{Message: err.Error(), Err: err}
+	}
+	return nil
+}
+
+// callbackError is what a builtin returns when a function it called failed.
+// The engine reports the failure itself, this just stops the builtin.
+func callbackError(err error) *Error {
+	return &Error{Message: err.Error(), Err: err}
+}
+
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	default:
+		return true
+	}
+}
+
+// testElements implements any and all: it looks for an element for which
+// args[1], or the element itself if there is no args[1], is as truthy as
+// want.
+func testElements(engine Engine, name string, args []Object, want bool) Object {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return err
+	}
+	arr, err := arrayArg(name, args, 0)
+	if err != nil {
+		return err
+	}
+
+	for _, el := range arr.Elements {
+		result := el
+		if len(args) == 2 {
+			var err error
+			result, err = engine.Call(args[1], el)
+			if err != nil {
+				return callbackError(err)
+			}
+		}
+		if isTruthy(result) == want {
+			return NativeBool(want)
+		}
+	}
+
+	return NativeBool(!want)
+}
+
+// compareObjects orders numbers and strings by value.
+func compareObjects(a, b Object) (bool, error) {
+	switch a := a.(type) {
+	case *Integer:
+		if b, ok := b.(*Integer); ok {
+			return a.Value < b.Value, nil
+		}
+		if b, ok := b.(*Float); ok {
+			return float64(a.Value) < b.Value, nil
+		}
+	case *Float:
+		if b, ok := FloatValue(b); ok {
+			return a.Value < b, nil
+		}
+	case *String:
+		if b, ok := b.(*String); ok {
+			return a.Value < b.Value, nil
+		}
+	}
+	return false, fmt.Errorf("can't compare %s with %s", a.Type(), b.Type())
+}
+
+// sortArray returns a stably sorted copy of elements, ordered by keys.
+func sortArray(elements, keys []Object, less func(a, b Object) (bool, error)) Object {
+	indexes := make([]int, len(elements))
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	var failed error
+	sort.SliceStable(indexes, func(i, j int) bool {
+		if failed != nil {
+			return false
+		}
+		result, err := less(keys[indexes[i]], keys[indexes[j]])
+		if err != nil {
+			failed = err
+		}
+		return result
+	})
+	if failed != nil {
+		return callbackError(failed)
+	}
+
+	sorted := make([]Object, len(elements))
+	for i, index := range indexes {
+		sorted[i] = elements[index]
+	}
+	return &Array{Elements: sorted}
+}
+
+// powInt raises base to exp, which isn't negative, by squaring. It reports
+// false if the result doesn't fit in an int64.
+func powInt(base, exp int64) (int64, bool) {
+	result := int64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			var ok bool
+			if result, ok = mulInt(result, base); !ok {
+				return 0, false
+			}
+		}
+		exp >>= 1
+		if exp > 0 {
+			var ok bool
+			if base, ok = mulInt(base, base); !ok {
+				return 0, false
+			}
+		}
+	}
+	return result, true
+}
+
+// mulInt multiplies a and b, reporting false if the product overflows.
+func mulInt(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	product := a * b
+	if product/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+	return product, true
+}
+
+// rangeLength returns how many integers range produces going from start
+// towards end by step, which isn't 0.
+func rangeLength(start, end, step int64) int64 {
+	var distance, stride uint64
+	switch {
+	case step > 0 && start < end:
+		distance, stride = uint64(end)-uint64(start), uint64(step)
+	case step < 0 && start > end:
+		distance, stride = uint64(start)-uint64(end), -uint64(step)
+	default:
+		return 0
+	}
+
+	length := (distance-1)/stride + 1
+	if length > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(length)
+}
+
+// clampIndex turns a possibly negative index, counting from the end, into
+// an offset between 0 and length.
+func clampIndex(index, length int64) int64 {
+	if index < 0 {
+		index += length
+	}
+	if index < 0 {
+		return 0
+	}
+	if index > length {
+		return length
+	}
+	return index
+}
+
 func GetBuiltinByName(name string) *Builtin {
 	for _, def := range Builtins {
 		if def.Name == name {
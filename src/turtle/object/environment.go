@@ -1,19 +1,106 @@
 package object
 
+import (
+	"context"
+	"turtle/ast"
+)
+
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
+	env := NewModuleEnvironment(outer)
 	env.outer = outer
 	return env
 }
 
+// NewBlockEnvironment returns an environment for a block run in env, such
+// as a catch block, whose bindings go out of scope at its end. Unlike the
+// body of a call, the block yields wherever env does.
+func NewBlockEnvironment(env *Environment) *Environment {
+	block := NewEnclosedEnvironment(env)
+	block.yield = env.yield
+	return block
+}
+
+// NewModuleEnvironment returns an environment for the top level of a
+// module imported from env. It sees none of env's bindings but shares its
+// host, budget and modules.
+func NewModuleEnvironment(env *Environment) *Environment {
+	module := NewEnvironment()
+	module.host = env.host
+	module.budget = env.budget
+	module.modules = env.modules
+	return module
+}
+
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	budget := NewBudget(context.Background(), Limits{})
+	modules := &Modules{Loaded: make(map[string]Object)}
+	return &Environment{store: s, outer: nil, host: DefaultHost(), budget: budget, modules: modules}
 }
 
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+	host  *Host
+
+	budget  *Budget
+	modules *Modules
+
+	yield Yielder
+}
+
+// Yielder takes what a yield expression hands over in the environment of a
+// call to a generator function, and returns what the expression evaluates
+// to once the generator is resumed.
+type Yielder func(node *ast.YieldExpression, value Object) Object
+
+// Modules is what the evaluator knows about the modules a program imports.
+type Modules struct {
+	// Loader reads the source of a module. The evaluator reads files if it
+	// is nil.
+	Loader func(path string) (string, error)
+	// Path is the file of the main program, which relative imports in it
+	// are resolved against.
+	Path string
+
+	// Loaded holds the exports of every module imported so far by path.
+	Loaded map[string]Object
+	// Loading holds the modules being evaluated, outermost first.
+	Loading []string
+}
+
+// Host returns the host builtins called from this environment talk to.
+// Enclosed environments share the host of their outer environment.
+func (e *Environment) Host() *Host {
+	return e.host
+}
+
+func (e *Environment) SetHost(host *Host) {
+	e.host = host
+}
+
+// Modules returns the modules of the program running in this environment.
+// Enclosed environments share the modules of their outer environment.
+func (e *Environment) Modules() *Modules {
+	return e.modules
+}
+
+// Budget returns the budget evaluation in this environment counts against.
+// Enclosed environments share the budget of their outer environment.
+func (e *Environment) Budget() *Budget {
+	return e.budget
+}
+
+// Yielder returns what yield expressions evaluated in e hand their values
+// to, which is nil outside of the calls to generator functions. It isn't
+// inherited: a function called from a generator runs in an environment of
+// its own.
+func (e *Environment) Yielder() Yielder {
+	return e.yield
+}
+
+func (e *Environment) SetYielder(yield Yielder) {
+	e.yield = yield
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -0,0 +1,62 @@
+package object
+
+import (
+	"context"
+	"errors"
+)
+
+// Thrown is the error a program stops with when nothing catches a value it
+// threw.
+type Thrown struct {
+	Value Object
+}
+
+func (t *Thrown) Error() string {
+	return "uncaught exception: " + t.Value.Inspect()
+}
+
+// Throw returns the error that throwing obj raises. Throwing an error
+// object, such as one a builtin returned, raises a runtime error with its
+// message.
+func Throw(obj Object) error {
+	if errObj, ok := obj.(*Error); ok {
+		return &raised{obj: errObj}
+	}
+	return &Thrown{Value: obj}
+}
+
+// raised is the error behind a thrown error object.
+type raised struct {
+	obj *Error
+}
+
+func (r *raised) Error() string { return r.obj.Message }
+func (r *raised) Unwrap() error { return r.obj.Err }
+
+// Caught returns what a catch clause binds when err is raised: the value a
+// throw threw, or the message of a runtime error.
+func Caught(err error) Object {
+	var thrown *Thrown
+	if errors.As(err, &thrown) {
+		return thrown.Value
+	}
+	return &String{Value: err.Error()}
+}
+
+// Catchable reports whether a catch clause may handle err. Running out of
+// budget, being canceled and calling exit stop the program whatever it
+// tries to catch.
+func Catchable(err error) bool {
+	var exit *ExitError
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrInstructionLimit), errors.Is(err, ErrAllocationLimit):
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.As(err, &exit):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,194 @@
+package object
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Capability is something a host may let scripts do beyond reading and
+// writing its streams. Hosts grant none by default.
+type Capability uint
+
+const (
+	// CapReadFiles allows read_file and list_dir.
+	CapReadFiles Capability = 1 << iota
+	// CapWriteFiles allows write_file.
+	CapWriteFiles
+	// CapEnv allows getenv.
+	CapEnv
+	// CapArgs allows args.
+	CapArgs
+	// CapExit allows exit.
+	CapExit
+	// CapSeed allows seed, which makes random and random_int repeat
+	// themselves for every script sharing the host.
+	CapSeed
+
+	AllCapabilities = CapReadFiles | CapWriteFiles | CapEnv | CapArgs | CapExit | CapSeed
+)
+
+// ErrNotPermitted is behind the error a builtin returns when the host has
+// not granted the capability it needs.
+var ErrNotPermitted = errors.New("not permitted by the host")
+
+// ExitError is the error a program stops with when it calls exit.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// AsExit returns the ExitError behind obj if obj is the error exit
+// returned. Engines stop as soon as they see one.
+func AsExit(obj Object) (*ExitError, bool) {
+	errObj, ok := obj.(*Error)
+	if !ok || errObj.Err == nil {
+		return nil, false
+	}
+
+	var exit *ExitError
+	if errors.As(errObj.Err, &exit) {
+		return exit, true
+	}
+	return nil, false
+}
+
+// Host is the outside world as builtins see it: puts and warn write to
+// Stdout and Stderr, gets reads from Stdin. Every VM and every environment
+// carries one, so embedders and tests can capture a script's output.
+// random and random_int draw from the host's generator, which is the
+// process-wide one until Seed is called.
+type Host struct {
+	Stdin  *bufio.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Capabilities are what scripts may do besides using the streams.
+	Capabilities Capability
+	// Args are what args returns.
+	Args []string
+	// Root, if set, is the directory read_file, write_file and list_dir
+	// resolve paths against. They can't reach outside of it.
+	Root string
+
+	mu     sync.Mutex
+	random *rand.Rand
+}
+
+func NewHost(stdin io.Reader, stdout, stderr io.Writer) *Host {
+	return &Host{
+		Stdin:  bufio.NewReader(stdin),
+		Stdout: stdout,
+		Stderr: stderr,
+	}
+}
+
+var defaultHost = NewHost(os.Stdin, os.Stdout, os.Stderr)
+
+// DefaultHost returns the host connected to the process' standard streams.
+func DefaultHost() *Host {
+	return defaultHost
+}
+
+// Allows reports whether h grants c.
+func (h *Host) Allows(c Capability) bool {
+	return h.Capabilities&c == c
+}
+
+// ReadFile returns the contents of the named file.
+func (h *Host) ReadFile(name string) ([]byte, error) {
+	f, err := h.openFile(name, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// WriteFile replaces the contents of the named file with data, creating
+// the file if needed.
+func (h *Host) WriteFile(name string, data []byte) error {
+	f, err := h.openFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// ReadDir returns the sorted names of the entries of the named directory.
+func (h *Host) ReadDir(name string) ([]string, error) {
+	f, err := h.openFile(name, os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := f.ReadDir(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (h *Host) openFile(name string, flag int) (*os.File, error) {
+	if h.Root == "" {
+		return os.OpenFile(name, flag, 0644)
+	}
+
+	root, err := os.OpenRoot(h.Root)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	return root.OpenFile(name, flag, 0644)
+}
+
+// Seed gives h its own generator, seeded with seed, so the numbers it
+// produces from now on are the same on every run.
+func (h *Host) Seed(seed uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.random = rand.New(rand.NewPCG(seed, seed))
+}
+
+// RandomFloat returns a number in [0, 1).
+func (h *Host) RandomFloat() float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.random == nil {
+		return rand.Float64()
+	}
+	return h.random.Float64()
+}
+
+// RandomInt returns a number in [0, n). n must be positive. It's unsigned
+// so that the span between any two int64 bounds fits.
+func (h *Host) RandomInt(n uint64) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.random == nil {
+		return rand.Uint64N(n)
+	}
+	return h.random.Uint64N(n)
+}
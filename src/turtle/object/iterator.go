@@ -0,0 +1,133 @@
+package object
+
+import "fmt"
+
+// Iterator is an object that produces its values one at a time, computing
+// each only when it is asked for.
+type Iterator interface {
+	Object
+	// Next advances the iterator and returns the value it moved past. It
+	// reports done once there are no values left, and keeps doing so after.
+	// engine runs the functions the iterator calls.
+	Next(engine Engine) (value Object, done bool, err error)
+}
+
+// Iter returns an iterator over the elements of an array or the characters
+// of a string, or obj itself if it is an iterator already.
+func Iter(obj Object) (Iterator, error) {
+	switch obj := obj.(type) {
+	case Iterator:
+		return obj, nil
+	case *Array:
+		return &arrayIterator{elements: obj.Elements}, nil
+	case *String:
+		elements := []Object{}
+		for _, r := range obj.Value {
+			elements = append(elements, &String{Value: string(r)})
+		}
+		return &arrayIterator{elements: elements}, nil
+	default:
+		return nil, fmt.Errorf("can't iterate over %s", obj.Type())
+	}
+}
+
+// IterResult returns what the next builtin returns for a step of an
+// iterator: a hash of the value and whether the iterator was done.
+func IterResult(value Object, done bool) *Hash {
+	if value == nil {
+		value = NULL
+	}
+
+	result := NewHash()
+	result.Set(&String{Value: "value"}, value)
+	result.Set(&String{Value: "done"}, NativeBool(done))
+	return result
+}
+
+type arrayIterator struct {
+	elements []Object
+	next     int
+}
+
+func (ai *arrayIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (ai *arrayIterator) Inspect() string  { return "iterator" }
+
+func (ai *arrayIterator) Next(engine Engine) (Object, bool, error) {
+	if ai.next >= len(ai.elements) {
+		return nil, true, nil
+	}
+	ai.next++
+	return ai.elements[ai.next-1], false, nil
+}
+
+// takeIterator stops its source after left values.
+type takeIterator struct {
+	source Iterator
+	left   int64
+}
+
+func (ti *takeIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (ti *takeIterator) Inspect() string  { return "iterator" }
+
+func (ti *takeIterator) Next(engine Engine) (Object, bool, error) {
+	if ti.left <= 0 {
+		return nil, true, nil
+	}
+
+	value, done, err := ti.source.Next(engine)
+	if done || err != nil {
+		ti.left = 0
+		return nil, true, err
+	}
+	ti.left--
+	return value, false, nil
+}
+
+// mapIterator produces what fn returns for each value of its source.
+type mapIterator struct {
+	source Iterator
+	fn     Object
+}
+
+func (mi *mapIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (mi *mapIterator) Inspect() string  { return "iterator" }
+
+func (mi *mapIterator) Next(engine Engine) (Object, bool, error) {
+	value, done, err := mi.source.Next(engine)
+	if done || err != nil {
+		return nil, true, err
+	}
+
+	result, err := engine.Call(mi.fn, value)
+	if err != nil {
+		return nil, true, err
+	}
+	return result, false, nil
+}
+
+// filterIterator skips the values of its source for which fn returns
+// something falsy.
+type filterIterator struct {
+	source Iterator
+	fn     Object
+}
+
+func (fi *filterIterator) Type() ObjectType { return ITERATOR_OBJ }
+func (fi *filterIterator) Inspect() string  { return "iterator" }
+
+func (fi *filterIterator) Next(engine Engine) (Object, bool, error) {
+	for {
+		value, done, err := fi.source.Next(engine)
+		if done || err != nil {
+			return nil, true, err
+		}
+
+		keep, err := engine.Call(fi.fn, value)
+		if err != nil {
+			return nil, true, err
+		}
+		if isTruthy(keep) {
+			return value, false, nil
+		}
+	}
+}
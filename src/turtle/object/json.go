@@ -0,0 +1,194 @@
+package object
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// parseJSON decodes a single JSON value. Objects become hashes with their
+// keys in document order, numbers become integers when they fit and floats
+// otherwise.
+func parseJSON(input string) (Object, error) {
+	decoder := json.NewDecoder(strings.NewReader(input))
+	decoder.UseNumber()
+
+	value, err := decodeJSON(decoder)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("unexpected data after top-level value")
+	}
+	return value, nil
+}
+
+func decodeJSON(decoder *json.Decoder) (Object, error) {
+	token, err := decoder.Token()
+	if err == io.EOF {
+		return nil, errors.New("unexpected end of JSON input")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+	case nil:
+		return NULL, nil
+	case bool:
+		return NativeBool(token), nil
+	case string:
+		return &String{Value: token}, nil
+	case json.Number:
+		if value, err := token.Int64(); err == nil {
+			return &Integer{Value: value}, nil
+		}
+		value, err := token.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("number out of range: %s", token)
+		}
+		return &Float{Value: value}, nil
+	case json.Delim:
+		if token == '[' {
+			return decodeJSONArray(decoder)
+		}
+		return decodeJSONObject(decoder)
+	}
+
+	return nil, fmt.Errorf("unexpected token %v", token)
+}
+
+func decodeJSONArray(decoder *json.Decoder) (Object, error) {
+	elements := []Object{}
+	for decoder.More() {
+		element, err := decodeJSON(decoder)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+
+	// the closing bracket
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return &Array{Elements: elements}, nil
+}
+
+func decodeJSONObject(decoder *json.Decoder) (Object, error) {
+	hash := NewHash()
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := decodeJSON(decoder)
+		if err != nil {
+			return nil, err
+		}
+		hash.Set(&String{Value: key.(string)}, value)
+	}
+
+	// the closing brace
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return hash, nil
+}
+
+// stringifyJSON encodes obj as JSON. Hash keys keep their insertion order.
+// A non-empty indent puts every element on a line of its own, indented by
+// indent once per level of nesting.
+func stringifyJSON(obj Object, indent string) (string, error) {
+	var out bytes.Buffer
+	if err := encodeJSON(&out, obj, indent, 0); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func encodeJSON(out *bytes.Buffer, obj Object, indent string, depth int) error {
+	switch obj := obj.(type) {
+	case nil, *Null:
+		out.WriteString("null")
+	case *Boolean:
+		out.WriteString(strconv.FormatBool(obj.Value))
+	case *Integer:
+		out.WriteString(strconv.FormatInt(obj.Value, 10))
+	case *Float:
+		if math.IsNaN(obj.Value) || math.IsInf(obj.Value, 0) {
+			return fmt.Errorf("cannot encode %s as JSON", obj.Inspect())
+		}
+		out.WriteString(strconv.FormatFloat(obj.Value, 'g', -1, 64))
+	case *String:
+		encodeJSONString(out, obj.Value)
+	case *Array:
+		out.WriteByte('[')
+		for i, element := range obj.Elements {
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			newline(out, indent, depth+1)
+			if err := encodeJSON(out, element, indent, depth+1); err != nil {
+				return err
+			}
+		}
+		if len(obj.Elements) > 0 {
+			newline(out, indent, depth)
+		}
+		out.WriteByte(']')
+	case *Hash:
+		out.WriteByte('{')
+		for i, pair := range obj.OrderedPairs() {
+			key, ok := pair.Key.(*String)
+			if !ok {
+				return fmt.Errorf("JSON object keys must be STRING, got %s", pair.Key.Type())
+			}
+			if i > 0 {
+				out.WriteByte(',')
+			}
+			newline(out, indent, depth+1)
+			encodeJSONString(out, key.Value)
+			out.WriteByte(':')
+			if indent != "" {
+				out.WriteByte(' ')
+			}
+			if err := encodeJSON(out, pair.Value, indent, depth+1); err != nil {
+				return err
+			}
+		}
+		if len(obj.Keys) > 0 {
+			newline(out, indent, depth)
+		}
+		out.WriteByte('}')
+	default:
+		return fmt.Errorf("cannot encode %s as JSON", typeName(obj))
+	}
+
+	return nil
+}
+
+func encodeJSONString(out *bytes.Buffer, s string) {
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	// Encode ends every value with a newline
+	out.Truncate(out.Len() - 1)
+}
+
+func newline(out *bytes.Buffer, indent string, depth int) {
+	if indent == "" {
+		return
+	}
+	out.WriteByte('\n')
+	for i := 0; i < depth; i++ {
+		out.WriteString(indent)
+	}
+}
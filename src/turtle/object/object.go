@@ -4,12 +4,27 @@ import (
 	"bytes"
 	"fmt"
 	"hash/fnv"
+	"math"
+	"strconv"
 	"strings"
 	"turtle/ast"
 	"turtle/code"
+	"unicode/utf8"
 )
 
-type BuiltinFunction func(args ...Object) Object
+// Engine is the interpreter a builtin runs in. Through it a builtin reaches
+// the host's streams and calls back into functions written in turtle.
+type Engine interface {
+	Host() *Host
+	// Call applies fn, a function or builtin, to args. The error is the
+	// runtime error that stopped fn, if any.
+	Call(fn Object, args ...Object) (Object, error)
+	// Budget is what the running program counts against. Builtins charge it
+	// for the arrays and strings they build.
+	Budget() *Budget
+}
+
+type BuiltinFunction func(engine Engine, args ...Object) Object
 
 type ObjectType string
 
@@ -18,6 +33,7 @@ const (
 	ERROR_OBJ = "ERROR"
 
 	INTEGER_OBJ = "INTEGER"
+	FLOAT_OBJ   = "FLOAT"
 	BOOLEAN_OBJ = "BOOLEAN"
 	STRING_OBJ  = "STRING"
 
@@ -32,6 +48,8 @@ const (
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
 
 	CLOSURE_OBJ = "CLOSURE"
+
+	ITERATOR_OBJ = "ITERATOR"
 )
 
 type Closure struct {
@@ -68,6 +86,34 @@ func (i *Integer) HashKey() HashKey {
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType { return FLOAT_OBJ }
+
+// Inspect always shows a decimal point or exponent, so 2.0 doesn't read
+// as the integer 2.
+func (f *Float) Inspect() string {
+	s := strconv.FormatFloat(f.Value, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		s += ".0"
+	}
+	return s
+}
+
+// FloatValue returns the value of an integer or float as a float64, and
+// false for anything else.
+func FloatValue(obj Object) (float64, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value), true
+	case *Float:
+		return obj.Value, true
+	}
+	return 0, false
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -86,6 +132,22 @@ func (b *Boolean) HashKey() HashKey {
 	return HashKey{Type: b.Type(), Value: value}
 }
 
+// True, False and NULL are the only booleans and the only null the engines
+// and builtins create, so they can be compared by identity.
+var (
+	True  = &Boolean{Value: true}
+	False = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
+// NativeBool returns True or False.
+func NativeBool(b bool) *Boolean {
+	if b {
+		return True
+	}
+	return False
+}
+
 type Null struct{}
 
 func (n *Null) Type() ObjectType { return NULL_OBJ }
@@ -100,6 +162,9 @@ func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
 type Error struct {
 	Message string
+	// Err is the Go error behind Message, if any, so hosts can tell limits
+	// and cancellation apart from other errors with errors.Is.
+	Err error
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
@@ -107,8 +172,11 @@ func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
 type Function struct {
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression // nil entries for parameters without a default
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Generator  bool // Body yields, so calls return an iterator running it
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -116,8 +184,15 @@ func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
+	for i, p := range f.Parameters {
+		if i < len(f.Defaults) && f.Defaults[i] != nil {
+			params = append(params, p.String()+" = "+f.Defaults[i].String())
+		} else {
+			params = append(params, p.String())
+		}
+	}
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
 	}
 
 	out.WriteString("fn")
@@ -143,6 +218,102 @@ func (s *String) HashKey() HashKey {
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
 
+// CharAt returns the character at index i, counting characters rather than
+// bytes and from the end if i is negative, or false if s has no such
+// character.
+func (s *String) CharAt(i int64) (*String, bool) {
+	if i < 0 {
+		i += int64(utf8.RuneCountInString(s.Value))
+	}
+	if i < 0 {
+		return nil, false
+	}
+	for _, r := range s.Value {
+		if i == 0 {
+			return &String{Value: string(r)}, true
+		}
+		i--
+	}
+	return nil, false
+}
+
+// Slice returns the characters of s from low up to high, counting them the
+// way CharAt does. Negative bounds count from the end and both are clamped
+// to the string.
+func (s *String) Slice(low, high int64) *String {
+	runes := []rune(s.Value)
+	length := int64(len(runes))
+	low, high = clampIndex(low, length), clampIndex(high, length)
+	if low > high {
+		low = high
+	}
+	return &String{Value: string(runes[low:high])}
+}
+
+// SliceOf returns the part of an array or string between low and high,
+// either of which may be null to leave that end of it open.
+func SliceOf(left, low, high Object) (Object, error) {
+	var length int64
+	switch left := left.(type) {
+	case *Array:
+		length = int64(len(left.Elements))
+	case *String:
+		length = int64(utf8.RuneCountInString(left.Value))
+	default:
+		return nil, fmt.Errorf("slice operator not supported: %s", left.Type())
+	}
+
+	bounds := []int64{0, length}
+	for i, bound := range []Object{low, high} {
+		switch bound := bound.(type) {
+		case *Integer:
+			bounds[i] = bound.Value
+		case *Null:
+		default:
+			return nil, fmt.Errorf("slice bounds must be INTEGER, got %s", bound.Type())
+		}
+	}
+
+	if array, ok := left.(*Array); ok {
+		return array.Slice(bounds[0], bounds[1]), nil
+	}
+	return left.(*String).Slice(bounds[0], bounds[1]), nil
+}
+
+// RangeOf returns the array of the integers from start up to end, and end
+// itself if inclusive is set. It's empty if end comes before start. Its
+// elements are charged to budget before it is built.
+func RangeOf(start, end Object, inclusive bool, budget *Budget) (*Array, error) {
+	bounds := []int64{}
+	for _, bound := range []Object{start, end} {
+		integer, ok := bound.(*Integer)
+		if !ok {
+			return nil, fmt.Errorf("range bounds must be INTEGER, got %s", bound.Type())
+		}
+		bounds = append(bounds, integer.Value)
+	}
+
+	first, last := bounds[0], bounds[1]
+	length := rangeLength(first, last, 1)
+	if inclusive && first <= last && length < math.MaxInt64 {
+		length++
+	}
+
+	err := budget.AllocateN(length)
+	if err != nil {
+		return nil, err
+	}
+	if length > math.MaxInt32 {
+		return nil, fmt.Errorf("range %d..%d is too long", first, last)
+	}
+
+	elements := make([]Object, length)
+	for i := range elements {
+		elements[i] = &Integer{Value: first + int64(i)}
+	}
+	return &Array{Elements: elements}, nil
+}
+
 type Builtin struct {
 	Fn BuiltinFunction
 }
@@ -170,6 +341,32 @@ func (ao *Array) Inspect() string {
 	return out.String()
 }
 
+// At returns the element at index i, counting from the end if i is
+// negative, or false if ao has no such element.
+func (ao *Array) At(i int64) (Object, bool) {
+	if i < 0 {
+		i += int64(len(ao.Elements))
+	}
+	if i < 0 || i >= int64(len(ao.Elements)) {
+		return nil, false
+	}
+	return ao.Elements[i], true
+}
+
+// Slice returns a new array of the elements of ao from low up to high.
+// Negative bounds count from the end and both are clamped to the array.
+func (ao *Array) Slice(low, high int64) *Array {
+	length := int64(len(ao.Elements))
+	low, high = clampIndex(low, length), clampIndex(high, length)
+	if low > high {
+		low = high
+	}
+
+	elements := make([]Object, high-low)
+	copy(elements, ao.Elements[low:high])
+	return &Array{Elements: elements}
+}
+
 type HashPair struct {
 	Key   Object
 	Value Object
@@ -177,6 +374,31 @@ type HashPair struct {
 
 type Hash struct {
 	Pairs map[HashKey]HashPair
+	// Keys holds the keys of Pairs in insertion order, the order in which
+	// Inspect and the hash builtins walk the pairs.
+	Keys []HashKey
+}
+
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+// Set adds a pair for key, or replaces the existing one in its place.
+func (h *Hash) Set(key Hashable, value Object) {
+	hashKey := key.HashKey()
+	if _, ok := h.Pairs[hashKey]; !ok {
+		h.Keys = append(h.Keys, hashKey)
+	}
+	h.Pairs[hashKey] = HashPair{Key: key.(Object), Value: value}
+}
+
+// OrderedPairs returns the pairs of h in insertion order.
+func (h *Hash) OrderedPairs() []HashPair {
+	pairs := make([]HashPair, len(h.Keys))
+	for i, key := range h.Keys {
+		pairs[i] = h.Pairs[key]
+	}
+	return pairs
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
@@ -184,7 +406,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.OrderedPairs() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
 			pair.Key.Inspect(), pair.Value.Inspect()))
 	}
@@ -200,6 +422,17 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+
+	// ParameterNames names the parameters for keyword arguments. The last
+	// NumDefaults of them have default values, and if Rest is set the local
+	// after them holds an array of the arguments left over.
+	ParameterNames []string
+	NumDefaults    int
+	Rest           bool
+
+	// Generator is set if the function yields, so calling it returns an
+	// iterator instead of running it.
+	Generator bool
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -58,3 +58,22 @@ func TestIntegerHashKey(t *testing.T) {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
 }
+
+func TestHashInsertionOrder(t *testing.T) {
+	hash := NewHash()
+	hash.Set(&String{Value: "b"}, &Integer{Value: 1})
+	hash.Set(&Integer{Value: 1}, &Integer{Value: 2})
+	hash.Set(&String{Value: "a"}, &Integer{Value: 3})
+	hash.Set(&String{Value: "b"}, &Integer{Value: 4})
+
+	if len(hash.Keys) != 3 || len(hash.Pairs) != 3 {
+		t.Fatalf("wrong number of pairs. keys=%d, pairs=%d", len(hash.Keys), len(hash.Pairs))
+	}
+
+	expected := "{b: 4, 1: 2, a: 3}"
+	for i := 0; i < 10; i++ {
+		if hash.Inspect() != expected {
+			t.Fatalf("wrong Inspect. want=%q, got=%q", expected, hash.Inspect())
+		}
+	}
+}
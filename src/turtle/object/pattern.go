@@ -0,0 +1,45 @@
+package object
+
+// MatchesLiteral reports whether value equals literal, the integer, string
+// or boolean of a pattern. Values of different types never match, so 1.0
+// doesn't match 1.
+func MatchesLiteral(value, literal Object) bool {
+	v, ok := value.(Hashable)
+	if !ok {
+		return false
+	}
+	l, ok := literal.(Hashable)
+	return ok && v.HashKey() == l.HashKey()
+}
+
+// MatchesArray reports whether value is an array of n elements, or of at
+// least n if rest is set.
+func MatchesArray(value Object, n int, rest bool) bool {
+	arr, ok := value.(*Array)
+	if !ok {
+		return false
+	}
+	if rest {
+		return len(arr.Elements) >= n
+	}
+	return len(arr.Elements) == n
+}
+
+// MatchesHash reports whether value is a hash that has every one of keys.
+func MatchesHash(value Object, keys []Object) bool {
+	hash, ok := value.(*Hash)
+	if !ok {
+		return false
+	}
+
+	for _, key := range keys {
+		hashable, ok := key.(Hashable)
+		if !ok {
+			return false
+		}
+		if _, ok := hash.Pairs[hashable.HashKey()]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -617,6 +617,54 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 5;", "let x: int = 5;"},
+		{"let xs: [string] = y;", "let xs: [string] = y;"},
+		{"let xs: [[int]] = y;", "let xs: [[int]] = y;"},
+		{"let f: fn = g;", "let f: fn = g;"},
+		{"fn(a: int, b) { a }", "fnfn(a: int, b) a"},
+		{"fn(a: string): int { len(a) }", "fnfn(a: string): int len(a)"},
+		{"fn(): [int] { [] }", "fnfn(): [int] []"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestTypeAnnotationErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: = 5;", "expected type, got = instead"},
+		{"fn(a: 1) { a }", "expected type, got INT instead"},
+		{"let x: [int = 5;", "expected next token to be ], got = instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want first=%q, got=%q",
+				tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 
@@ -1112,3 +1160,434 @@ func checkParserErrors(t *testing.T, p *Parser) {
 	}
 	t.FailNow()
 }
+
+func TestImportAndExportStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "math.tt" as math;`, `import "math.tt" as math;`},
+		{`export let x = 5;`, `export let x = 5;`},
+		{`m.name`, `(m[name])`},
+		{`m.f(1)`, `(m[f])(1)`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestTryExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`throw 1 + 2;`, `throw (1 + 2);`},
+		{`try { f() } catch (e) { e }`, `try f() catch(e) e`},
+		{`try { f() } finally { g() }`, `try f() finally g()`},
+		{`try { f() } catch (err) { 1 } finally { g() }`, `try f() catch(err) 1 finally g()`},
+		{`let x = try { 1 } catch (e) { 2 };`, `let x = try 1 catch(e) 2;`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestTryExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { 1 }`, "expected catch or finally after try block, got EOF instead"},
+		{`try { 1 } catch { 2 }`, "expected next token to be (, got { instead"},
+		{`try { 1 } catch (1) { 2 }`, "expected next token to be IDENT, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want first=%q, got=%q",
+				tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestMatchExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match x { 1 => "one", _ => "other" }`, `match x { 1 => one, _ => other }`},
+		{`match x { -1 => a, "s" => b, true => c, }`, `match x { -1 => a, s => b, true => c }`},
+		{`match x { [] => 0, [a, [b]] => a, [h, ...t] => t }`, `match x { [] => 0, [a, [b]] => a, [h, ...t] => t }`},
+		{`match x { {"k": v, 1: [w]} => v }`, `match x { {k:v, 1:[w]} => v }`},
+		{`match x { n if n > 1 => n * 2 }`, `match x { n if (n > 1) => (n * 2) }`},
+		{`let y = match f(x) { _ => g(x) };`, `let y = match f(x) { _ => g(x) };`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestMatchExpressionErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match x { 1 }`, "expected next token to be =>, got } instead"},
+		{`match x { f(1) => 1 }`, "expected next token to be =>, got ( instead"},
+		{`match x { 1 + 2 => 1 }`, "expected next token to be =>, got + instead"},
+		{`match x { fn => 1 }`, "expected pattern, got FUNCTION instead"},
+		{`match x { {a: 1} => 1 }`, "expected literal key in hash pattern, got IDENT instead"},
+		{`match x { [...1] => 1 }`, "expected next token to be IDENT, got INT instead"},
+		{`match x { 1 => 1 2 => 2 }`, "expected next token to be ,, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want first=%q, got=%q",
+				tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestDestructuringLetParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b] = pair;`, `let [a, b] = pair;`},
+		{`let [a, ...rest] = f(x)`, `let [a, ...rest] = f(x);`},
+		{`let {"name": n, "age": a} = person;`, `let {name:n, age:a} = person;`},
+		{`let [{"k": [x]}, _] = v;`, `let [{k:[x]}, _] = v;`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestDestructuringLetErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b];`, "expected next token to be =, got ; instead"},
+		{`let [a]: array = v;`, "expected next token to be =, got : instead"},
+		{`let [a + 1] = v;`, "expected next token to be ,, got + instead"},
+		{`let {a: b} = v;`, "expected literal key in hash pattern, got IDENT instead"},
+		{`export let [a] = v;`, "can't export a destructuring let"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want first=%q, got=%q",
+				tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestParameterParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn(a, b = 1) { a }`, `fnfn(a, b = 1) a`},
+		{`fn(a: int = 1 + 2) { a }`, `fnfn(a: int = (1 + 2)) a`},
+		{`fn(...rest) { rest }`, `fnfn(...rest) rest`},
+		{`fn(a, b = [], ...rest) { a }`, `fnfn(a, b = [], ...rest) a`},
+		{`f(1, b = 2, c = g(x))`, `f(1, b = 2, c = g(x))`},
+		{`f(a = 1)`, `f(a = 1)`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestParameterErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn(a = 1, b) { a }`, "parameter b without a default follows one with a default"},
+		{`fn(...rest, a) { a }`, "expected next token to be ), got , instead"},
+		{`fn(...) { 1 }`, "expected next token to be IDENT, got ) instead"},
+		{`f(a = 1, 2)`, "positional argument follows keyword argument"},
+		{`f(a = 1, a = 2)`, "repeated keyword argument a"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want first=%q, got=%q",
+				tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestInterpolatedStringParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`"Hello ${name}!"`, []string{"Hello ", "name", "!"}},
+		{`"${a + b}"`, []string{"(a + b)"}},
+		{`"${x}${y}"`, []string{"x", "y"}},
+		{`"n: ${len(items)} items"`, []string{"n: ", "len(items)", " items"}},
+		{`"${ "inner ${x}" }"`, []string{"inner ${x}"}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		str, ok := stmt.Expression.(*ast.InterpolatedString)
+		if !ok {
+			t.Fatalf("exp not *ast.InterpolatedString. got=%T", stmt.Expression)
+		}
+
+		if len(str.Parts) != len(tt.expected) {
+			t.Fatalf("wrong number of parts for %q. want=%d, got=%d", tt.input, len(tt.expected), len(str.Parts))
+		}
+		for i, part := range str.Parts {
+			if part.String() != tt.expected[i] {
+				t.Errorf("part %d of %q wrong. want=%q, got=%q", i, tt.input, tt.expected[i], part.String())
+			}
+		}
+	}
+}
+
+func TestInterpolatedStringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a ${} b"`, "empty interpolation in string"},
+		{`"a ${}${x} b"`, "empty interpolation in string"},
+		{`"a ${x y} b"`, "expected } to close interpolation, got IDENT instead"},
+		{`"a ${x`, "expected } to close interpolation, got EOF instead"},
+		{`import "${x}" as m;`, "expected next token to be STRING, got STRING_START instead"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want first=%q, got=%q",
+				tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestSliceAndRangeParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`a[1:3]`, `(a[1:3])`},
+		{`a[:-1]`, `(a[:(-1)])`},
+		{`a[2:]`, `(a[2:])`},
+		{`a[:]`, `(a[:])`},
+		{`a[i + 1:len(a) - 1][0]`, `((a[(i + 1):(len(a) - 1)])[0])`},
+		{`1..10`, `(1..10)`},
+		{`1..=n + 1`, `(1..=(n + 1))`},
+		{`a < 1..2`, `(a < (1..2))`},
+		{`map(0..len(xs), f)`, `map((0..len(xs)), f)`},
+		{`(1..3)[1:]`, `((1..3)[1:])`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestSliceErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`a[1:2:3]`, "expected next token to be ], got : instead"},
+		{`a[1:2`, "expected next token to be ], got EOF instead"},
+		{`1..`, "no prefix parse function for EOF found"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want first=%q, got=%q",
+				tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestYieldExpressionParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		tail     []bool
+	}{
+		{`fn() { yield 1 }`, "yield 1", []bool{false}},
+		{`fn() { yield a + 1; yield ...xs }`, "yield (a + 1)yield ...xs", []bool{false, true}},
+		{`fn() { yield ...xs; 1 }`, "yield ...xs1", []bool{false}},
+		{`fn(n) { if (n) { yield ...f(n) } else { yield n } }`, "ifn yield ...f(n)else yield n", []bool{true, false}},
+		{`fn() { let x = yield 1; x }`, "let x = yield 1;x", []bool{false}},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function, ok := stmt.Expression.(*ast.FunctionLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.FunctionLiteral. got=%T", stmt.Expression)
+		}
+		if !function.Generator {
+			t.Errorf("%q: function is not a generator", tt.input)
+		}
+		if function.Body.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, function.Body.String())
+		}
+
+		yields := []*ast.YieldExpression{}
+		var collect func(node ast.Node)
+		collect = func(node ast.Node) {
+			switch node := node.(type) {
+			case *ast.BlockStatement:
+				for _, s := range node.Statements {
+					collect(s)
+				}
+			case *ast.ExpressionStatement:
+				collect(node.Expression)
+			case *ast.LetStatement:
+				collect(node.Value)
+			case *ast.IfExpression:
+				collect(node.Consequence)
+				if node.Alternative != nil {
+					collect(node.Alternative)
+				}
+			case *ast.YieldExpression:
+				yields = append(yields, node)
+			}
+		}
+		collect(function.Body)
+
+		if len(yields) != len(tt.tail) {
+			t.Fatalf("%q: wrong number of yields. want=%d, got=%d", tt.input, len(tt.tail), len(yields))
+		}
+		for i, yield := range yields {
+			if yield.Tail != tt.tail[i] {
+				t.Errorf("%q: yield %d has Tail=%t, want %t", tt.input, i, yield.Tail, tt.tail[i])
+			}
+		}
+	}
+}
+
+func TestYieldMakesInnermostFunctionAGenerator(t *testing.T) {
+	input := `fn() { let inner = fn() { yield 1 }; inner }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	outer := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	inner := outer.Body.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if outer.Generator {
+		t.Errorf("outer function is a generator")
+	}
+	if !inner.Generator {
+		t.Errorf("inner function is not a generator")
+	}
+}
+
+func TestYieldErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`yield 1`, "yield outside of a function body"},
+		{`fn(a = yield 1) { a }`, "yield outside of a function body"},
+		{`fn() { yield }`, "no prefix parse function for } found"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong parser errors for %q. want first=%q, got=%q",
+				tt.input, tt.expected, p.Errors())
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package regvm
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Instructions are 32-bit words. The low byte is the opcode, followed by
+// three 8-bit operands A, B and C. Instructions that need a wider operand
+// use B and C together as the 16-bit Bx.
+//
+//	| C (8) | B (8) | A (8) | op (8) |
+//	|    Bx (16)    | A (8) | op (8) |
+type Instructions []uint32
+
+type Opcode byte
+
+const (
+	OpLoadConstant   Opcode = iota // R(A) = K(Bx)
+	OpLoadTrue                     // R(A) = true
+	OpLoadFalse                    // R(A) = false
+	OpLoadNull                     // R(A) = null
+	OpMove                         // R(A) = R(B)
+	OpGetGlobal                    // R(A) = G(Bx)
+	OpSetGlobal                    // G(Bx) = R(A)
+	OpGetBuiltin                   // R(A) = builtin B
+	OpGetFree                      // R(A) = free variable B of the running closure
+	OpCurrentClosure               // R(A) = the running closure
+	OpAdd                          // R(A) = R(B) + R(C)
+	OpSub                          // R(A) = R(B) - R(C)
+	OpMul                          // R(A) = R(B) * R(C)
+	OpDiv                          // R(A) = R(B) / R(C)
+	OpEqual                        // R(A) = R(B) == R(C)
+	OpNotEqual                     // R(A) = R(B) != R(C)
+	OpGreaterThan                  // R(A) = R(B) > R(C)
+	OpMinus                        // R(A) = -R(B)
+	OpBang                         // R(A) = !R(B)
+	OpJump                         // ip = Bx
+	OpJumpNotTruthy                // if !R(A) { ip = Bx }
+	OpArray                        // R(A) = [R(B), ..., R(B+C-1)]
+	OpAppend                       // R(A) = R(A) + [R(B), ..., R(B+C-1)]
+	OpHash                         // R(A) = {R(B): R(B+1), ...} with C registers
+	OpHashSet                      // R(A) = R(A) + {R(B): R(B+1), ...} with C registers
+	OpIndex                        // R(A) = R(B)[R(C)]
+	OpCall                         // R(A) = R(A)(R(A+1), ..., R(A+B))
+	OpReturn                       // return R(A)
+	OpReturnNull                   // return null
+	OpClosure                      // R(A) = closure of K(Bx) over R(A+1), ...
+)
+
+type Definition struct {
+	Name string
+	// Wide is set for instructions that use A and Bx instead of A, B and C.
+	Wide     bool
+	Operands int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpLoadConstant:   {"LOADK", true, 2},
+	OpLoadTrue:       {"LOADTRUE", false, 1},
+	OpLoadFalse:      {"LOADFALSE", false, 1},
+	OpLoadNull:       {"LOADNULL", false, 1},
+	OpMove:           {"MOVE", false, 2},
+	OpGetGlobal:      {"GETGLOBAL", true, 2},
+	OpSetGlobal:      {"SETGLOBAL", true, 2},
+	OpGetBuiltin:     {"GETBUILTIN", false, 2},
+	OpGetFree:        {"GETFREE", false, 2},
+	OpCurrentClosure: {"CURRENTCLOSURE", false, 1},
+	OpAdd:            {"ADD", false, 3},
+	OpSub:            {"SUB", false, 3},
+	OpMul:            {"MUL", false, 3},
+	OpDiv:            {"DIV", false, 3},
+	OpEqual:          {"EQ", false, 3},
+	OpNotEqual:       {"NE", false, 3},
+	OpGreaterThan:    {"GT", false, 3},
+	OpMinus:          {"MINUS", false, 2},
+	OpBang:           {"NOT", false, 2},
+	OpJump:           {"JMP", true, 1},
+	OpJumpNotTruthy:  {"JMPNOT", true, 2},
+	OpArray:          {"ARRAY", false, 3},
+	OpAppend:         {"APPEND", false, 3},
+	OpHash:           {"HASH", false, 3},
+	OpHashSet:        {"HASHSET", false, 3},
+	OpIndex:          {"INDEX", false, 3},
+	OpCall:           {"CALL", false, 2},
+	OpReturn:         {"RETURN", false, 1},
+	OpReturnNull:     {"RETURNNULL", false, 0},
+	OpClosure:        {"CLOSURE", true, 2},
+}
+
+func Lookup(op Opcode) (*Definition, error) {
+	def, ok := definitions[op]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// MakeABC encodes an instruction with three 8-bit operands.
+func MakeABC(op Opcode, a, b, c int) uint32 {
+	return uint32(op) | uint32(a&0xFF)<<8 | uint32(b&0xFF)<<16 | uint32(c&0xFF)<<24
+}
+
+// MakeABx encodes an instruction with an 8-bit and a 16-bit operand.
+func MakeABx(op Opcode, a, bx int) uint32 {
+	return uint32(op) | uint32(a&0xFF)<<8 | uint32(bx&0xFFFF)<<16
+}
+
+func decodeOp(ins uint32) Opcode { return Opcode(ins) }
+func decodeA(ins uint32) int     { return int(ins >> 8 & 0xFF) }
+func decodeB(ins uint32) int     { return int(ins >> 16 & 0xFF) }
+func decodeC(ins uint32) int     { return int(ins >> 24) }
+func decodeBx(ins uint32) int    { return int(ins >> 16) }
+
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	for i, word := range ins {
+		def, err := Lookup(decodeOp(word))
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			continue
+		}
+
+		operands := []int{decodeA(word), decodeB(word), decodeC(word)}
+		switch {
+		case def.Wide && def.Operands == 1:
+			operands = []int{decodeBx(word)}
+		case def.Wide:
+			operands = []int{decodeA(word), decodeBx(word)}
+		}
+
+		fmt.Fprintf(&out, "%04d %s", i, def.Name)
+		for _, operand := range operands[:def.Operands] {
+			fmt.Fprintf(&out, " %d", operand)
+		}
+		out.WriteString("\n")
+	}
+
+	return out.String()
+}
@@ -0,0 +1,608 @@
+package regvm
+
+import (
+	"fmt"
+	"turtle/ast"
+	"turtle/compiler"
+	"turtle/object"
+)
+
+// MaxRegisters is the number of registers a single frame can address with
+// an 8-bit operand.
+const MaxRegisters = 256
+
+// chunkSize bounds the number of registers used to build one piece of an
+// array or hash literal; longer literals are built with OpAppend/OpHashSet.
+const chunkSize = 32
+
+// resultRegister holds the value of the last expression statement of the
+// main program, the register machine's equivalent of the stack VM's last
+// popped element.
+const resultRegister = 0
+
+type compilationScope struct {
+	instructions Instructions
+	nextRegister int
+	numRegisters int
+}
+
+// Compiler is a second back end for the ast that targets the register
+// machine. It shares the symbol table with the stack compiler: local
+// symbols are mapped directly onto the registers of their frame.
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *compiler.SymbolTable
+	scopes      []*compilationScope
+}
+
+type Bytecode struct {
+	Instructions Instructions
+	NumRegisters int
+	Constants    []object.Object
+}
+
+func NewCompiler() *Compiler {
+	symbolTable := compiler.NewSymbolTable()
+	for i, b := range object.Builtins {
+		symbolTable.DefineBuiltin(i, b.Name)
+	}
+	for i, constant := range object.Constants {
+		symbolTable.DefineConstant(i, constant.Name)
+	}
+
+	main := &compilationScope{
+		nextRegister: resultRegister + 1,
+		numRegisters: resultRegister + 1,
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []*compilationScope{main},
+	}
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	main := c.scopes[0]
+	return &Bytecode{
+		Instructions: main.instructions,
+		NumRegisters: main.numRegisters,
+		Constants:    c.constants,
+	}
+}
+
+func (c *Compiler) Compile(program *ast.Program) error {
+	for _, statement := range program.Statements {
+		err := c.compileStatement(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Compiler) scope() *compilationScope {
+	return c.scopes[len(c.scopes)-1]
+}
+
+func (c *Compiler) inFunction() bool {
+	return len(c.scopes) > 1
+}
+
+func (c *Compiler) emit(ins uint32) int {
+	s := c.scope()
+	s.instructions = append(s.instructions, ins)
+	return len(s.instructions) - 1
+}
+
+func (c *Compiler) patchJump(pos int) {
+	s := c.scope()
+	ins := s.instructions[pos]
+	s.instructions[pos] = MakeABx(decodeOp(ins), decodeA(ins), len(s.instructions))
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+// allocRegister reserves the next free temporary register. Temporaries are
+// released in bulk by resetting nextRegister to a value saved earlier.
+func (c *Compiler) allocRegister() (int, error) {
+	s := c.scope()
+	if s.nextRegister >= MaxRegisters {
+		return 0, fmt.Errorf("expression needs more than %d registers", MaxRegisters)
+	}
+
+	r := s.nextRegister
+	s.nextRegister++
+	if s.nextRegister > s.numRegisters {
+		s.numRegisters = s.nextRegister
+	}
+	return r, nil
+}
+
+func (c *Compiler) compileStatement(node ast.Statement) error {
+	mark := c.scope().nextRegister
+	defer func() { c.scope().nextRegister = mark }()
+
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		dst := resultRegister
+		if c.inFunction() {
+			r, err := c.allocRegister()
+			if err != nil {
+				return err
+			}
+			dst = r
+		}
+		return c.compileInto(node.Expression, dst)
+
+	case *ast.LetStatement:
+		if node.Pattern != nil {
+			return fmt.Errorf("destructuring is not supported by the register vm")
+		}
+
+		symbol := c.symbolTable.Define(node.Name.Value)
+		if symbol.Scope != compiler.GlobalScope {
+			return c.compileInto(node.Value, symbol.Index)
+		}
+
+		// like the stack VM, leave the value of a global let behind as the
+		// result of the program
+		r := resultRegister
+		if c.inFunction() {
+			reg, err := c.allocRegister()
+			if err != nil {
+				return err
+			}
+			r = reg
+		}
+		err := c.compileInto(node.Value, r)
+		if err != nil {
+			return err
+		}
+		c.emit(MakeABx(OpSetGlobal, r, symbol.Index))
+
+	case *ast.ReturnStatement:
+		r, err := c.operand(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+		c.emit(MakeABC(OpReturn, r, 0, 0))
+
+	case *ast.BlockStatement:
+		for _, statement := range node.Statements {
+			err := c.compileStatement(statement)
+			if err != nil {
+				return err
+			}
+		}
+
+	case *ast.ImportStatement, *ast.ExportStatement:
+		return fmt.Errorf("modules are not supported by the register vm")
+
+	case *ast.ThrowStatement:
+		return fmt.Errorf("exceptions are not supported by the register vm")
+	}
+
+	return nil
+}
+
+// compileBlockInto compiles block and leaves the value of its trailing
+// expression statement, or null, in dst.
+func (c *Compiler) compileBlockInto(block *ast.BlockStatement, dst int) error {
+	statements := block.Statements
+	if len(statements) == 0 {
+		c.emit(MakeABC(OpLoadNull, dst, 0, 0))
+		return nil
+	}
+
+	for _, statement := range statements[:len(statements)-1] {
+		err := c.compileStatement(statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	last, ok := statements[len(statements)-1].(*ast.ExpressionStatement)
+	if ok {
+		return c.compileInto(last.Expression, dst)
+	}
+
+	err := c.compileStatement(statements[len(statements)-1])
+	if err != nil {
+		return err
+	}
+	c.emit(MakeABC(OpLoadNull, dst, 0, 0))
+	return nil
+}
+
+// operand returns a register holding the value of node. Local variables
+// are used in place; everything else is compiled into a new temporary.
+func (c *Compiler) operand(node ast.Expression) (int, error) {
+	if ident, ok := node.(*ast.Identifier); ok {
+		symbol, ok := c.symbolTable.Resolve(ident.Value)
+		if ok && symbol.Scope == compiler.LocalScope {
+			return symbol.Index, nil
+		}
+	}
+
+	r, err := c.allocRegister()
+	if err != nil {
+		return 0, err
+	}
+	return r, c.compileInto(node, r)
+}
+
+// compileInto compiles node so that its value ends up in register dst. Any
+// temporaries used along the way are free again once it returns.
+func (c *Compiler) compileInto(node ast.Expression, dst int) error {
+	mark := c.scope().nextRegister
+	defer func() { c.scope().nextRegister = mark }()
+
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(MakeABx(OpLoadConstant, dst, c.addConstant(integer)))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(MakeABx(OpLoadConstant, dst, c.addConstant(str)))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(MakeABC(OpLoadTrue, dst, 0, 0))
+		} else {
+			c.emit(MakeABC(OpLoadFalse, dst, 0, 0))
+		}
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable %s", node.Value)
+		}
+		c.loadSymbol(symbol, dst)
+
+	case *ast.PrefixExpression:
+		right, err := c.operand(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "-":
+			c.emit(MakeABC(OpMinus, dst, right, 0))
+		case "!":
+			c.emit(MakeABC(OpBang, dst, right, 0))
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		leftNode, rightNode := node.Left, node.Right
+		if node.Operator == "<" {
+			leftNode, rightNode = rightNode, leftNode
+		}
+
+		left, err := c.operand(leftNode)
+		if err != nil {
+			return err
+		}
+		right, err := c.operand(rightNode)
+		if err != nil {
+			return err
+		}
+
+		var op Opcode
+		switch node.Operator {
+		case "+":
+			op = OpAdd
+		case "-":
+			op = OpSub
+		case "*":
+			op = OpMul
+		case "/":
+			op = OpDiv
+		case "==":
+			op = OpEqual
+		case "!=":
+			op = OpNotEqual
+		case ">", "<":
+			op = OpGreaterThan
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		c.emit(MakeABC(op, dst, left, right))
+
+	case *ast.IfExpression:
+		condition, err := c.operand(node.Condition)
+		if err != nil {
+			return err
+		}
+		jumpNotTruthy := c.emit(MakeABx(OpJumpNotTruthy, condition, 0))
+
+		err = c.compileBlockInto(node.Consequence, dst)
+		if err != nil {
+			return err
+		}
+		jump := c.emit(MakeABx(OpJump, 0, 0))
+		c.patchJump(jumpNotTruthy)
+
+		if node.Alternative == nil {
+			c.emit(MakeABC(OpLoadNull, dst, 0, 0))
+		} else {
+			err = c.compileBlockInto(node.Alternative, dst)
+			if err != nil {
+				return err
+			}
+		}
+		c.patchJump(jump)
+
+	case *ast.ArrayLiteral:
+		return c.compileSequence(node.Elements, dst, OpArray, OpAppend)
+
+	case *ast.HashLiteral:
+		elements := []ast.Expression{}
+		for _, k := range node.Keys {
+			elements = append(elements, k, node.Pairs[k])
+		}
+		return c.compileSequence(elements, dst, OpHash, OpHashSet)
+
+	case *ast.IndexExpression:
+		left, err := c.operand(node.Left)
+		if err != nil {
+			return err
+		}
+		index, err := c.operand(node.Index)
+		if err != nil {
+			return err
+		}
+		c.emit(MakeABC(OpIndex, dst, left, index))
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, dst)
+
+	case *ast.CallExpression:
+		if len(node.Keywords) > 0 {
+			return fmt.Errorf("keyword arguments are not supported by the register vm")
+		}
+
+		base, err := c.allocRegister()
+		if err != nil {
+			return err
+		}
+		err = c.compileInto(node.Function, base)
+		if err != nil {
+			return err
+		}
+
+		for _, argument := range node.Arguments {
+			r, err := c.allocRegister()
+			if err != nil {
+				return err
+			}
+			err = c.compileInto(argument, r)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(MakeABC(OpCall, base, len(node.Arguments), 0))
+		c.move(dst, base)
+
+	case *ast.TryExpression:
+		return fmt.Errorf("exceptions are not supported by the register vm")
+
+	case *ast.MatchExpression:
+		return fmt.Errorf("match is not supported by the register vm")
+
+	case *ast.InterpolatedString:
+		return fmt.Errorf("string interpolation is not supported by the register vm")
+
+	case *ast.SliceExpression:
+		return fmt.Errorf("slices are not supported by the register vm")
+
+	case *ast.RangeExpression:
+		return fmt.Errorf("ranges are not supported by the register vm")
+	}
+
+	return nil
+}
+
+// compileSequence builds an array or hash literal from elements in chunks
+// of consecutive registers.
+func (c *Compiler) compileSequence(elements []ast.Expression, dst int, create, extend Opcode) error {
+	op := create
+	for start := 0; start == 0 || start < len(elements); start += chunkSize {
+		mark := c.scope().nextRegister
+
+		end := min(start+chunkSize, len(elements))
+		base := c.scope().nextRegister
+		for _, e := range elements[start:end] {
+			r, err := c.allocRegister()
+			if err != nil {
+				return err
+			}
+			err = c.compileInto(e, r)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(MakeABC(op, dst, base, end-start))
+		op = extend
+
+		c.scope().nextRegister = mark
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, dst int) error {
+	if node.Generator {
+		return fmt.Errorf("generators are not supported by the register vm")
+	}
+	if node.Rest != nil {
+		return fmt.Errorf("rest parameters are not supported by the register vm")
+	}
+	for _, value := range node.Defaults {
+		if value != nil {
+			return fmt.Errorf("default parameters are not supported by the register vm")
+		}
+	}
+
+	numLocals := len(node.Parameters) + countLets(node.Body)
+	if numLocals >= MaxRegisters {
+		return fmt.Errorf("function has more than %d locals", MaxRegisters)
+	}
+
+	c.scopes = append(c.scopes, &compilationScope{
+		nextRegister: numLocals,
+		numRegisters: numLocals,
+	})
+	c.symbolTable = compiler.NewEnclosedSymbolTable(c.symbolTable)
+
+	if node.Name != "" {
+		c.symbolTable.DefineFunctionName(node.Name)
+	}
+	for _, parameter := range node.Parameters {
+		c.symbolTable.Define(parameter.Value)
+	}
+
+	err := c.compileFunctionBody(node.Body)
+	if err != nil {
+		return err
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	scope := c.scope()
+	fn := &Function{
+		Instructions:  scope.instructions,
+		NumRegisters:  scope.numRegisters,
+		NumParameters: len(node.Parameters),
+		NumFree:       len(freeSymbols),
+	}
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.symbolTable = c.symbolTable.Outer
+
+	base, err := c.allocRegister()
+	if err != nil {
+		return err
+	}
+	for _, s := range freeSymbols {
+		r, err := c.allocRegister()
+		if err != nil {
+			return err
+		}
+		c.loadSymbol(s, r)
+	}
+
+	c.emit(MakeABx(OpClosure, base, c.addConstant(fn)))
+	c.move(dst, base)
+	return nil
+}
+
+func (c *Compiler) compileFunctionBody(body *ast.BlockStatement) error {
+	statements := body.Statements
+	if len(statements) == 0 {
+		c.emit(MakeABC(OpReturnNull, 0, 0, 0))
+		return nil
+	}
+
+	for _, statement := range statements[:len(statements)-1] {
+		err := c.compileStatement(statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch last := statements[len(statements)-1].(type) {
+	case *ast.ExpressionStatement:
+		r, err := c.operand(last.Expression)
+		if err != nil {
+			return err
+		}
+		c.emit(MakeABC(OpReturn, r, 0, 0))
+	case *ast.ReturnStatement:
+		return c.compileStatement(last)
+	default:
+		err := c.compileStatement(last)
+		if err != nil {
+			return err
+		}
+		c.emit(MakeABC(OpReturnNull, 0, 0, 0))
+	}
+
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s compiler.Symbol, dst int) {
+	switch s.Scope {
+	case compiler.GlobalScope:
+		c.emit(MakeABx(OpGetGlobal, dst, s.Index))
+	case compiler.LocalScope:
+		c.move(dst, s.Index)
+	case compiler.BuiltinScope:
+		c.emit(MakeABC(OpGetBuiltin, dst, s.Index, 0))
+	case compiler.ConstantScope:
+		c.emit(MakeABx(OpLoadConstant, dst, c.addConstant(object.Constants[s.Index].Value)))
+	case compiler.FreeScope:
+		c.emit(MakeABC(OpGetFree, dst, s.Index, 0))
+	case compiler.FunctionScope:
+		c.emit(MakeABC(OpCurrentClosure, dst, 0, 0))
+	}
+}
+
+func (c *Compiler) move(dst, src int) {
+	if dst != src {
+		c.emit(MakeABC(OpMove, dst, src, 0))
+	}
+}
+
+// countLets counts the let statements that define locals of the function
+// whose body is node, without descending into nested functions. Their
+// registers are reserved up front so temporaries never overlap them.
+func countLets(node ast.Node) int {
+	count := 0
+
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			count += countLets(s)
+		}
+	case *ast.LetStatement:
+		count = 1 + countLets(node.Value)
+	case *ast.ReturnStatement:
+		count = countLets(node.ReturnValue)
+	case *ast.ExpressionStatement:
+		count = countLets(node.Expression)
+	case *ast.PrefixExpression:
+		count = countLets(node.Right)
+	case *ast.InfixExpression:
+		count = countLets(node.Left) + countLets(node.Right)
+	case *ast.IfExpression:
+		count = countLets(node.Condition) + countLets(node.Consequence)
+		if node.Alternative != nil {
+			count += countLets(node.Alternative)
+		}
+	case *ast.CallExpression:
+		count = countLets(node.Function)
+		for _, a := range node.Arguments {
+			count += countLets(a)
+		}
+	case *ast.ArrayLiteral:
+		for _, e := range node.Elements {
+			count += countLets(e)
+		}
+	case *ast.HashLiteral:
+		for _, k := range node.Keys {
+			count += countLets(k) + countLets(node.Pairs[k])
+		}
+	case *ast.IndexExpression:
+		count = countLets(node.Left) + countLets(node.Index)
+	}
+
+	return count
+}
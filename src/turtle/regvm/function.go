@@ -0,0 +1,36 @@
+package regvm
+
+import (
+	"fmt"
+	"turtle/object"
+)
+
+const (
+	FUNCTION_OBJ = "REGISTER_FUNCTION"
+	CLOSURE_OBJ  = object.CLOSURE_OBJ
+)
+
+// Function is the register machine's counterpart of object.CompiledFunction.
+// Parameters occupy the first registers of a frame, followed by the other
+// locals and then the temporaries, NumRegisters in total.
+type Function struct {
+	Instructions  Instructions
+	NumRegisters  int
+	NumParameters int
+	NumFree       int
+}
+
+func (f *Function) Type() object.ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	return fmt.Sprintf("RegisterFunction[%p]", f)
+}
+
+type Closure struct {
+	Fn   *Function
+	Free []object.Object
+}
+
+func (c *Closure) Type() object.ObjectType { return CLOSURE_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
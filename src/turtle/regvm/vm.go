@@ -0,0 +1,443 @@
+package regvm
+
+import (
+	"context"
+	"fmt"
+	"turtle/object"
+)
+
+const RegisterFileSize = 65536
+const GlobalSize = 65536
+const MaxFrames = object.MaxCallDepth
+
+var True = object.True
+var False = object.False
+var Null = object.NULL
+
+type Frame struct {
+	cl *Closure
+	ip int
+	// base is the index of the frame's register 0 in the register file.
+	base int
+}
+
+// VM is the register machine. Every frame owns a window of the register
+// file; a call places the callee and its arguments in consecutive registers
+// of the caller so the arguments become the callee's first registers
+// without being copied, and the result is written back over the callee.
+type VM struct {
+	constants []object.Object
+
+	registers []object.Object
+	globals   []object.Object
+
+	frames      []Frame
+	framesIndex int
+
+	host   *object.Host
+	budget *object.Budget
+}
+
+func New(bytecode *Bytecode) *VM {
+	mainFn := &Function{
+		Instructions: bytecode.Instructions,
+		NumRegisters: bytecode.NumRegisters,
+	}
+
+	frames := make([]Frame, MaxFrames)
+	frames[0] = Frame{cl: &Closure{Fn: mainFn}}
+
+	return &VM{
+		constants:   bytecode.Constants,
+		registers:   make([]object.Object, RegisterFileSize),
+		globals:     make([]object.Object, GlobalSize),
+		frames:      frames,
+		framesIndex: 1,
+		host:        object.DefaultHost(),
+		budget:      object.NewBudget(context.Background(), object.Limits{}),
+	}
+}
+
+// Host returns the host builtins run by vm read from and write to.
+func (vm *VM) Host() *object.Host {
+	return vm.host
+}
+
+// Budget is what builtins charge. The register machine has no limits yet,
+// so it never runs out.
+func (vm *VM) Budget() *object.Budget {
+	return vm.budget
+}
+
+// Call applies a builtin to args. Builtins can't call back into closures on
+// the register machine yet.
+func (vm *VM) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	builtin, ok := fn.(*object.Builtin)
+	if !ok {
+		return nil, fmt.Errorf("register vm can't call %s from a builtin", fn.Type())
+	}
+
+	result := builtin.Fn(vm, args...)
+	if exit, ok := object.AsExit(result); ok {
+		return nil, exit
+	}
+	if result == nil {
+		result = Null
+	}
+	return result, nil
+}
+
+// SetHost sets the host builtins run by vm read from and write to.
+func (vm *VM) SetHost(host *object.Host) {
+	vm.host = host
+}
+
+// LastValue returns the value of the last expression statement of the main
+// program.
+func (vm *VM) LastValue() object.Object {
+	if vm.registers[resultRegister] == nil {
+		return Null
+	}
+	return vm.registers[resultRegister]
+}
+
+func (vm *VM) Run() error {
+	frame := &vm.frames[vm.framesIndex-1]
+	ins := frame.cl.Fn.Instructions
+	regs := vm.registers[frame.base:]
+	ip := frame.ip
+
+	for ip < len(ins) {
+		word := ins[ip]
+		ip++
+
+		switch decodeOp(word) {
+		case OpLoadConstant:
+			regs[decodeA(word)] = vm.constants[decodeBx(word)]
+
+		case OpLoadTrue:
+			regs[decodeA(word)] = True
+
+		case OpLoadFalse:
+			regs[decodeA(word)] = False
+
+		case OpLoadNull:
+			regs[decodeA(word)] = Null
+
+		case OpMove:
+			regs[decodeA(word)] = regs[decodeB(word)]
+
+		case OpGetGlobal:
+			regs[decodeA(word)] = vm.globals[decodeBx(word)]
+
+		case OpSetGlobal:
+			vm.globals[decodeBx(word)] = regs[decodeA(word)]
+
+		case OpGetBuiltin:
+			regs[decodeA(word)] = object.Builtins[decodeB(word)].Builtin
+
+		case OpGetFree:
+			regs[decodeA(word)] = frame.cl.Free[decodeB(word)]
+
+		case OpCurrentClosure:
+			regs[decodeA(word)] = frame.cl
+
+		case OpAdd, OpSub, OpMul, OpDiv:
+			result, err := executeBinaryOperation(decodeOp(word), regs[decodeB(word)], regs[decodeC(word)])
+			if err != nil {
+				return err
+			}
+			regs[decodeA(word)] = result
+
+		case OpEqual, OpNotEqual, OpGreaterThan:
+			result, err := executeComparison(decodeOp(word), regs[decodeB(word)], regs[decodeC(word)])
+			if err != nil {
+				return err
+			}
+			regs[decodeA(word)] = result
+
+		case OpMinus:
+			right := regs[decodeB(word)]
+			if float, ok := right.(*object.Float); ok {
+				regs[decodeA(word)] = &object.Float{Value: -float.Value}
+				break
+			}
+			integer, ok := right.(*object.Integer)
+			if !ok {
+				return fmt.Errorf("unsupported type for negatiion: %s", right.Type())
+			}
+			if integer.Value == 0 {
+				regs[decodeA(word)] = integer
+			} else {
+				regs[decodeA(word)] = &object.Integer{Value: -integer.Value}
+			}
+
+		case OpBang:
+			regs[decodeA(word)] = nativeBoolToBooleanObject(!isTruthy(regs[decodeB(word)]))
+
+		case OpJump:
+			ip = decodeBx(word)
+
+		case OpJumpNotTruthy:
+			if !isTruthy(regs[decodeA(word)]) {
+				ip = decodeBx(word)
+			}
+
+		case OpArray, OpAppend:
+			a, b, c := decodeA(word), decodeB(word), decodeC(word)
+			elements := []object.Object{}
+			if decodeOp(word) == OpAppend {
+				elements = regs[a].(*object.Array).Elements
+			}
+			elements = append(elements, regs[b:b+c]...)
+			regs[a] = &object.Array{Elements: elements}
+
+		case OpHash, OpHashSet:
+			a, b, c := decodeA(word), decodeB(word), decodeC(word)
+			hash := object.NewHash()
+			if decodeOp(word) == OpHashSet {
+				hash = regs[a].(*object.Hash)
+			}
+			for i := b; i < b+c; i += 2 {
+				key, ok := regs[i].(object.Hashable)
+				if !ok {
+					return fmt.Errorf("unusable as hash key: %s", regs[i].Type())
+				}
+				hash.Set(key, regs[i+1])
+			}
+			regs[a] = hash
+
+		case OpIndex:
+			result, err := executeIndexExpression(regs[decodeB(word)], regs[decodeC(word)])
+			if err != nil {
+				return err
+			}
+			regs[decodeA(word)] = result
+
+		case OpCall:
+			a, numArgs := decodeA(word), decodeB(word)
+
+			switch callee := regs[a].(type) {
+			case *Closure:
+				if numArgs != callee.Fn.NumParameters {
+					return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+						callee.Fn.NumParameters, numArgs)
+				}
+
+				base := frame.base + a + 1
+				if vm.framesIndex >= MaxFrames || base+callee.Fn.NumRegisters > len(vm.registers) {
+					return fmt.Errorf("stack overflow")
+				}
+
+				frame.ip = ip
+				vm.frames[vm.framesIndex] = Frame{cl: callee, base: base}
+				vm.framesIndex++
+
+				frame = &vm.frames[vm.framesIndex-1]
+				ins = callee.Fn.Instructions
+				regs = vm.registers[base:]
+				ip = 0
+
+			case *object.Builtin:
+				result := callee.Fn(vm, regs[a+1:a+1+numArgs]...)
+				if exit, ok := object.AsExit(result); ok {
+					return exit
+				}
+				if result == nil {
+					result = Null
+				}
+				regs[a] = result
+
+			default:
+				return fmt.Errorf("calling non-function and non-built-in")
+			}
+
+		case OpReturn, OpReturnNull:
+			var result object.Object = Null
+			if decodeOp(word) == OpReturn {
+				result = regs[decodeA(word)]
+			}
+
+			vm.framesIndex--
+			if vm.framesIndex == 0 {
+				vm.registers[resultRegister] = result
+				return nil
+			}
+
+			vm.registers[frame.base-1] = result
+
+			frame = &vm.frames[vm.framesIndex-1]
+			ins = frame.cl.Fn.Instructions
+			regs = vm.registers[frame.base:]
+			ip = frame.ip
+
+		case OpClosure:
+			a := decodeA(word)
+			fn, ok := vm.constants[decodeBx(word)].(*Function)
+			if !ok {
+				return fmt.Errorf("not a function: %+v", vm.constants[decodeBx(word)])
+			}
+
+			free := make([]object.Object, fn.NumFree)
+			copy(free, regs[a+1:a+1+fn.NumFree])
+			regs[a] = &Closure{Fn: fn, Free: free}
+		}
+	}
+
+	frame.ip = ip
+	return nil
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBooleanObject(b bool) object.Object {
+	if b {
+		return True
+	}
+	return False
+}
+
+func executeBinaryOperation(op Opcode, left, right object.Object) (object.Object, error) {
+	switch left := left.(type) {
+	case *object.Integer:
+		if right, ok := right.(*object.Integer); ok {
+			return executeBinaryIntegerOperation(op, left.Value, right.Value)
+		}
+	case *object.String:
+		if right, ok := right.(*object.String); ok {
+			if op != OpAdd {
+				return nil, fmt.Errorf("unknown string operator: %d", op)
+			}
+			return &object.String{Value: left.Value + right.Value}, nil
+		}
+	}
+
+	if leftValue, ok := object.FloatValue(left); ok {
+		if rightValue, ok := object.FloatValue(right); ok {
+			return executeBinaryFloatOperation(op, leftValue, rightValue)
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported types for binary operation: %s %s", left.Type(), right.Type())
+}
+
+func executeBinaryIntegerOperation(op Opcode, left, right int64) (object.Object, error) {
+	switch op {
+	case OpAdd:
+		return &object.Integer{Value: left + right}, nil
+	case OpSub:
+		return &object.Integer{Value: left - right}, nil
+	case OpMul:
+		return &object.Integer{Value: left * right}, nil
+	case OpDiv:
+		if right == 0 {
+			return nil, fmt.Errorf("can't divide by 0")
+		}
+		return &object.Integer{Value: left / right}, nil
+	}
+
+	return nil, fmt.Errorf("unknow integer operation: %d", op)
+}
+
+func executeBinaryFloatOperation(op Opcode, left, right float64) (object.Object, error) {
+	switch op {
+	case OpAdd:
+		return &object.Float{Value: left + right}, nil
+	case OpSub:
+		return &object.Float{Value: left - right}, nil
+	case OpMul:
+		return &object.Float{Value: left * right}, nil
+	case OpDiv:
+		if right == 0 {
+			return nil, fmt.Errorf("can't divide by 0")
+		}
+		return &object.Float{Value: left / right}, nil
+	}
+
+	return nil, fmt.Errorf("unknow float operation: %d", op)
+}
+
+func executeComparison(op Opcode, left, right object.Object) (object.Object, error) {
+	if left, ok := left.(*object.Integer); ok {
+		if right, ok := right.(*object.Integer); ok {
+			switch op {
+			case OpEqual:
+				return nativeBoolToBooleanObject(left.Value == right.Value), nil
+			case OpNotEqual:
+				return nativeBoolToBooleanObject(left.Value != right.Value), nil
+			case OpGreaterThan:
+				return nativeBoolToBooleanObject(left.Value > right.Value), nil
+			}
+		}
+	}
+
+	if leftValue, ok := object.FloatValue(left); ok {
+		if rightValue, ok := object.FloatValue(right); ok {
+			switch op {
+			case OpEqual:
+				return nativeBoolToBooleanObject(leftValue == rightValue), nil
+			case OpNotEqual:
+				return nativeBoolToBooleanObject(leftValue != rightValue), nil
+			case OpGreaterThan:
+				return nativeBoolToBooleanObject(leftValue > rightValue), nil
+			}
+		}
+	}
+
+	switch op {
+	case OpEqual:
+		return nativeBoolToBooleanObject(left == right), nil
+	case OpNotEqual:
+		return nativeBoolToBooleanObject(left != right), nil
+	}
+
+	return nil, fmt.Errorf("unknow operator : %d (%s %s)", op, left.Type(), right.Type())
+}
+
+func executeIndexExpression(left, index object.Object) (object.Object, error) {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			break
+		}
+		element, ok := left.At(i.Value)
+		if !ok {
+			return Null, nil
+		}
+		return element, nil
+
+	case *object.String:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			break
+		}
+		char, ok := left.CharAt(i.Value)
+		if !ok {
+			return Null, nil
+		}
+		return char, nil
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hash key: %s", index.Type())
+		}
+		pair, ok := left.Pairs[key.HashKey()]
+		if !ok {
+			return Null, nil
+		}
+		return pair.Value, nil
+	}
+
+	return nil, fmt.Errorf("index operator not supported: %s", left.Type())
+}
@@ -0,0 +1,239 @@
+package regvm
+
+import (
+	"regexp"
+	"testing"
+	"turtle/ast"
+	"turtle/compiler"
+	"turtle/lexer"
+	"turtle/object"
+	"turtle/parser"
+	"turtle/vm"
+)
+
+// sharedTests are run through both the stack VM and the register VM, which
+// must agree on the result or on the error.
+var sharedTests = []string{
+	`1`,
+	`1 + 2`,
+	`50 - 2 - 2 + 4`,
+	`(5 + 10 * 2 + 15 / 3) * 2 + -10`,
+	`-0`,
+	`1 < 2`,
+	`1 > 2`,
+	`1 == 1`,
+	`1 != 1`,
+	`true == false`,
+	`true != false`,
+	`(1 < 2) == true`,
+	`!true`,
+	`!!5`,
+	`!(if (false) { 5; })`,
+	`"tur" + "tle"`,
+	`"a" == "a"`,
+	`if (true) { 10 }`,
+	`if (false) { 10 }`,
+	`if (1 > 2) { 10 } else { 20 }`,
+	`if ((if (false) { 10 })) { 10 } else { 20 }`,
+	`let one = 1; let two = one + one; one + two`,
+	`let a = 1; a; let b = 2;`,
+	`[]`,
+	`[1, 2 * 2, 3 + 3]`,
+	`[1, 2, 3][1]`,
+	`[1, 2, 3][3]`,
+	`[1, 2, 3][-1]`,
+	`[[1, 1, 1]][0][0]`,
+	`{}[0]`,
+	`{1: 2, 2: 3}[2]`,
+	`{"a": 1}["b"]`,
+	`let h = {"one": 1, "two": 2}; h["one"] + h["two"]`,
+	`[1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20,
+	  21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34, 35, 36, 37, 38,
+	  39, 40][39]`,
+	`fn() { 5 + 10; }()`,
+	`let one = fn() { 1; }; let two = fn() { 2; }; one() + two()`,
+	`let earlyExit = fn() { return 99; 100; }; earlyExit();`,
+	`let noReturn = fn() { }; noReturn();`,
+	`let noValue = fn() { let a = 1; }; noValue();`,
+	`let returnsOne = fn() { 1; }; let returnsOneReturner = fn() { returnsOne; }; returnsOneReturner()();`,
+	`let one = fn() { let one = 1; one }; one();`,
+	`let oneAndTwo = fn() { let one = 1; let two = 2; one + two; }; oneAndTwo();`,
+	`let globalSeed = 50;
+	 let minusOne = fn() { let num = 1; globalSeed - num; }
+	 let minusTwo = fn() { let num = 2; globalSeed - num; }
+	 minusOne() + minusTwo();`,
+	`let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4);`,
+	`let outer = fn() { let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2) + sum(3, 4); }; outer();`,
+	`let f = fn(x) { let y = if (x > 0) { let z = x * 2; z } else { 0 }; y + 1 }; f(3) + f(-3)`,
+	`let f = fn(a) { 1 + if (a) { let b = 5; b * 2 } else { 0 } }; f(true)`,
+	`let newClosure = fn(a) { fn() { a; }; }; let closure = newClosure(99); closure();`,
+	`let newAdderOuter = fn(a, b) {
+		let c = a + b;
+		fn(d) { let e = d + c; fn(f) { e + f; }; };
+	 };
+	 let newAdderInner = newAdderOuter(1, 2)
+	 let adder = newAdderInner(3);
+	 adder(8);`,
+	`let newClosure = fn(a, b) {
+		let one = fn() { a; };
+		let two = fn() { b; };
+		fn() { one() + two(); };
+	 };
+	 newClosure(9, 90)();`,
+	`let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } }; countDown(10);`,
+	`let wrapper = fn() {
+		let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+		countDown(1);
+	 };
+	 wrapper();`,
+	`let fibonacci = fn(x) {
+		if (x == 0) { return 0; } else { if (x == 1) { return 1; } else { fibonacci(x - 1) + fibonacci(x - 2); } }
+	 };
+	 fibonacci(15);`,
+	`len("hello world")`,
+	`len(1)`,
+	`len([1, 2, 3])`,
+	`puts("hello")`,
+	`first([1, 2, 3])`,
+	`last([])`,
+	`rest([1, 2, 3])`,
+	`push([], 1)`,
+	`let map = fn(arr, f) {
+		let iter = fn(arr, accumulated) {
+			if (len(arr) == 0) { accumulated } else { iter(rest(arr), push(accumulated, f(first(arr)))); }
+		};
+		iter(arr, []);
+	 };
+	 map([1, 2, 3, 4], fn(x) { x * 2 });`,
+	`fn() { 1; }(1);`,
+	`fn(a, b) { a + b; }(1);`,
+	`1 + "a"`,
+	`"a" - "b"`,
+	`-true`,
+	`1 / 0`,
+	`1(2)`,
+	`1[0]`,
+	`{[1]: 2}`,
+	`{"a": 1}[[]]`,
+	`true > false`,
+}
+
+func TestSharedResults(t *testing.T) {
+	for _, input := range sharedTests {
+		program := parse(input)
+
+		expected, expectedErr := runStackVM(t, program)
+		actual, actualErr := runRegisterVM(t, program)
+
+		if expectedErr != "" || actualErr != "" {
+			if normalizeError(expectedErr) != normalizeError(actualErr) {
+				t.Errorf("%s\nerrors differ. stack vm=%q, register vm=%q",
+					input, expectedErr, actualErr)
+			}
+			continue
+		}
+
+		if expected != actual.Inspect() {
+			t.Errorf("%s\nresults differ. stack vm=%q, register vm=%q",
+				input, expected, actual.Inspect())
+		}
+	}
+}
+
+func TestRegisterVM(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`1 + 2`, int64(3)},
+		{`if (false) { 1 }`, Null},
+		{`"a" + "b"`, "ab"},
+		{`let f = fn(a, b) { a * b }; f(6, 7)`, int64(42)},
+		{`return 5; 6`, int64(5)},
+		{`len(1)`, &object.Error{Message: "argument to `len` not supported, got INTEGER"}},
+	}
+
+	for _, tt := range tests {
+		actual, err := runRegisterVM(t, parse(tt.input))
+		if err != "" {
+			t.Fatalf("vm error: %s", err)
+		}
+
+		switch expected := tt.expected.(type) {
+		case int64:
+			integer, ok := actual.(*object.Integer)
+			if !ok || integer.Value != expected {
+				t.Errorf("%s: wrong result. want=%d, got=%s", tt.input, expected, actual.Inspect())
+			}
+		case string:
+			str, ok := actual.(*object.String)
+			if !ok || str.Value != expected {
+				t.Errorf("%s: wrong result. want=%q, got=%s", tt.input, expected, actual.Inspect())
+			}
+		case *object.Null:
+			if actual != Null {
+				t.Errorf("%s: object is not Null: %T (%+v)", tt.input, actual, actual)
+			}
+		case *object.Error:
+			errObj, ok := actual.(*object.Error)
+			if !ok || errObj.Message != expected.Message {
+				t.Errorf("%s: wrong error. want=%q, got=%s", tt.input, expected.Message, actual.Inspect())
+			}
+		}
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	_, err := runRegisterVM(t, parse(`let f = fn(x) { f(x) }; f(1)`))
+	if err != "stack overflow" {
+		t.Errorf("expected stack overflow, got=%q", err)
+	}
+}
+
+func runStackVM(t *testing.T, program *ast.Program) (string, string) {
+	t.Helper()
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := vm.New(comp.Bytecode())
+	err = machine.Run()
+	if err != nil {
+		return "", err.Error()
+	}
+	return machine.LastPoppedStackElem().Inspect(), ""
+}
+
+func runRegisterVM(t *testing.T, program *ast.Program) (object.Object, string) {
+	t.Helper()
+
+	comp := NewCompiler()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := New(comp.Bytecode())
+	err = machine.Run()
+	if err != nil {
+		return nil, err.Error()
+	}
+	return machine.LastValue(), ""
+}
+
+var opcodeInError = regexp.MustCompile(`operator ?: \d+`)
+
+// normalizeError drops the opcode numbers some errors mention, since the two
+// machines number their instructions differently.
+func normalizeError(msg string) string {
+	return opcodeInError.ReplaceAllString(msg, "operator: <op>")
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
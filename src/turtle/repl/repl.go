@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"turtle/checker"
 	"turtle/compiler"
 	"turtle/lexer"
 	"turtle/object"
@@ -13,8 +14,23 @@ import (
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+type Options struct {
+	// Optimize runs the peephole optimizer over the compiled bytecode.
+	Optimize bool
+	// Specialize compiles hot instruction sequences to superinstructions.
+	Specialize bool
+	// TypeCheck runs the static type checker before compiling each line.
+	TypeCheck bool
+	// Capabilities are granted to the lines run. exit ends the session.
+	Capabilities object.Capability
+}
+
+// Start reads lines from in and writes results to out. Builtins share the
+// same streams: puts and warn write to out, gets reads the next line of in.
+func Start(in io.Reader, out io.Writer, opts Options) {
+	reader := bufio.NewReader(in)
+	host := object.NewHost(reader, out, out)
+	host.Capabilities = opts.Capabilities
 
 	constants := []object.Object{}
 	globals := make([]object.Object, vm.GlobalSize)
@@ -23,15 +39,19 @@ func Start(in io.Reader, out io.Writer) {
 	for i, v := range object.Builtins {
 		symbolTable.DefineBuiltin(i, v.Name)
 	}
+	for i, v := range object.Constants {
+		symbolTable.DefineConstant(i, v.Name)
+	}
+
+	typeChecker := checker.New()
 
 	for {
 		fmt.Fprintf(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
 			return
 		}
 
-		line := scanner.Text()
 		l := lexer.New(line)
 		p := parser.New(l)
 
@@ -41,17 +61,33 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
+		if opts.TypeCheck {
+			errors := typeChecker.Check(program)
+			if len(errors) != 0 {
+				printTypeErrors(out, errors)
+				continue
+			}
+		}
+
 		comp := compiler.NewWithState(symbolTable, constants)
-		err := comp.Compile(program)
+		comp.SetHost(host)
+		comp.SetOptimize(opts.Optimize)
+		comp.SetSpecialize(opts.Specialize)
+		err = comp.Compile(program)
 		if err != nil {
 			fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
 			continue
 		}
+		printWarnings(out, comp.Warnings())
 
 		code := comp.Bytecode()
 		constants = code.Constants
 		machine := vm.NewWithGlobalsStore(code, globals)
+		machine.SetHost(host)
 		err = machine.Run()
+		if _, ok := err.(*object.ExitError); ok {
+			return
+		}
 		if err != nil {
 			fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", err)
 			continue
@@ -83,3 +119,16 @@ func printParserErrors(out io.Writer, errors []string) {
 		io.WriteString(out, "\t"+msg+"\n")
 	}
 }
+
+func printTypeErrors(out io.Writer, errors []string) {
+	io.WriteString(out, "Woops! The types don't add up:\n")
+	for _, msg := range errors {
+		io.WriteString(out, "\t"+msg+"\n")
+	}
+}
+
+func printWarnings(out io.Writer, warnings []string) {
+	for _, msg := range warnings {
+		io.WriteString(out, "warning: "+msg+"\n")
+	}
+}
@@ -11,6 +11,12 @@ const (
 	INT    = "INT"    // 1343456
 	STRING = "STRING" // "foobar"
 
+	// An interpolated string "a ${x} b ${y} c" is the tokens STRING_START
+	// "a ", those of x, STRING_PART " b ", those of y and STRING_END " c".
+	STRING_START = "STRING_START"
+	STRING_PART  = "STRING_PART"
+	STRING_END   = "STRING_END"
+
 	// Operators
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -29,6 +35,11 @@ const (
 	COMMA     = ","
 	SEMICOLON = ";"
 	COLON     = ":"
+	DOT       = "."
+	ELLIPSIS  = "..."
+	RANGE     = ".."
+	RANGE_INC = "..="
+	ARROW     = "=>"
 
 	LPAREN   = "("
 	RPAREN   = ")"
@@ -45,6 +56,14 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	THROW    = "THROW"
+	TRY      = "TRY"
+	CATCH    = "CATCH"
+	FINALLY  = "FINALLY"
+	MATCH    = "MATCH"
+	YIELD    = "YIELD"
 )
 
 type Token struct {
@@ -53,13 +72,21 @@ type Token struct {
 }
 
 var keywords = map[string]TokenType{
-	"fn":     FUNCTION,
-	"let":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"fn":      FUNCTION,
+	"let":     LET,
+	"true":    TRUE,
+	"false":   FALSE,
+	"if":      IF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"import":  IMPORT,
+	"export":  EXPORT,
+	"throw":   THROW,
+	"try":     TRY,
+	"catch":   CATCH,
+	"finally": FINALLY,
+	"match":   MATCH,
+	"yield":   YIELD,
 }
 
 func LookupIdent(ident string) TokenType {
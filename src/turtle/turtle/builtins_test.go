@@ -0,0 +1,421 @@
+package turtle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"turtle/evaluator"
+	"turtle/lexer"
+	"turtle/object"
+	"turtle/parser"
+)
+
+// engineTest is a program and the Inspect output of its result, which must
+// be the same on the VM and the evaluator.
+type engineTest struct {
+	input    string
+	expected string
+}
+
+func TestCollectionBuiltins(t *testing.T) {
+	tests := []engineTest{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]"},
+		{`map([], fn(x) { x })`, "[]"},
+		{`map(["a", "bc"], len)`, "[1, 2]"},
+		{`map(1, fn(x) { x })`, "ERROR: argument to `map` must be ARRAY, got INTEGER"},
+		{`map([1])`, "ERROR: wrong number of arguments. got=1, want=2"},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, "[3, 4]"},
+		{`reduce([1, 2, 3, 4], fn(acc, x) { acc + x }, 10)`, "20"},
+		{`reduce([1, 2, 3, 4], fn(acc, x) { acc * x })`, "24"},
+		{`reduce([], fn(acc, x) { acc + x })`, "null"},
+		{`sort([3, 1, 2])`, "[1, 2, 3]"},
+		{`sort(["b", "c", "a"])`, "[a, b, c]"},
+		{`sort([1, "a"])`, "ERROR: can't compare STRING with INTEGER"},
+		{`sort([1, 3, 2], fn(a, b) { a > b })`, "[3, 2, 1]"},
+		{`sort_by(["ccc", "a", "bb"], len)`, "[a, bb, ccc]"},
+		{`sort_by([[2, "b"], [1, "a"], [2, "a"]], first)`, "[[1, a], [2, b], [2, a]]"},
+		{`zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`zip([1], [2], [3])`, "[[1, 2, 3]]"},
+		{`enumerate(["a", "b"])`, "[[0, a], [1, b]]"},
+		{`any([1, 2, 3], fn(x) { x > 2 })`, "true"},
+		{`any([1, 2, 3], fn(x) { x > 3 })`, "false"},
+		{`any([])`, "false"},
+		{`all([1, 2, 3], fn(x) { x > 0 })`, "true"},
+		{`all([true, false])`, "false"},
+		{`all([])`, "true"},
+		{`range(4)`, "[0, 1, 2, 3]"},
+		{`range(2, 5)`, "[2, 3, 4]"},
+		{`range(10, 0, -3)`, "[10, 7, 4, 1]"},
+		{`range(0, 5, 0)`, "ERROR: step of `range` must not be 0"},
+		{`range("a")`, "ERROR: argument to `range` must be INTEGER, got STRING"},
+		{`reverse([1, 2, 3])`, "[3, 2, 1]"},
+		{`concat([1], [], [2, 3])`, "[1, 2, 3]"},
+		{`concat()`, "[]"},
+		{`concat([1], 2)`, "ERROR: argument to `concat` must be ARRAY, got INTEGER"},
+		{`slice([1, 2, 3, 4], 1, 3)`, "[2, 3]"},
+		{`slice([1, 2, 3, 4], 2)`, "[3, 4]"},
+		{`slice([1, 2, 3, 4], -2)`, "[3, 4]"},
+		{`slice([1, 2, 3, 4], 3, 1)`, "[]"},
+		{`slice([1, 2, 3, 4], 0, 100)`, "[1, 2, 3, 4]"},
+		{`let a = [3, 1, 2]; sort(a); reverse(a); a`, "[3, 1, 2]"},
+		{`reduce(map(range(1, 11), fn(x) { x * x }), fn(a, b) { a + b })`, "385"},
+	}
+
+	testEngines(t, tests)
+}
+
+func TestHashBuiltins(t *testing.T) {
+	tests := []engineTest{
+		{`{"b": 1, "a": 2, 3: 3, true: 4}`, "{b: 1, a: 2, 3: 3, true: 4}"},
+		{`{"a": 1, "b": 2, "a": 3}`, "{a: 3, b: 2}"},
+		{`keys({"z": 1, "y": 2, "x": 3})`, "[z, y, x]"},
+		{`values({"z": 1, "y": 2, "x": 3})`, "[1, 2, 3]"},
+		{`entries({"z": 1, "y": 2})`, "[[z, 1], [y, 2]]"},
+		{`keys({})`, "[]"},
+		{`keys([1])`, "ERROR: argument to `keys` must be HASH, got ARRAY"},
+		{`has({"a": 1}, "a")`, "true"},
+		{`has({"a": 1}, "b")`, "false"},
+		{`has({"a": 1}, [1])`, "ERROR: unusable as hash key: ARRAY"},
+		{`delete({"a": 1, "b": 2, "c": 3}, "b")`, "{a: 1, c: 3}"},
+		{`delete({"a": 1}, "x")`, "{a: 1}"},
+		{`let h = {"a": 1}; delete(h, "a"); h`, "{a: 1}"},
+		{`merge({"a": 1, "b": 2}, {"b": 3, "c": 4})`, "{a: 1, b: 3, c: 4}"},
+		{`merge({"a": 1}, {}, {"z": 0})`, "{a: 1, z: 0}"},
+		{`merge({"a": 1}, 1)`, "ERROR: argument to `merge` must be HASH, got INTEGER"},
+		{`map(entries({"a": 1, "b": 2}), fn(e) { e[0] })`, "[a, b]"},
+	}
+
+	testEngines(t, tests)
+}
+
+func TestStringBuiltins(t *testing.T) {
+	tests := []engineTest{
+		{`split("a,b,,c", ",")`, "[a, b, , c]"},
+		{`split("abc", "")`, "[a, b, c]"},
+		{`split(1, ",")`, "ERROR: argument to `split` must be STRING, got INTEGER"},
+		{`join(["a", "b", "c"], "-")`, "a-b-c"},
+		{`join([1, true, "x"], ", ")`, "1, true, x"},
+		{`join([], ",")`, ""},
+		{"trim(\"  a b \t\n\")", "a b"},
+		{`upper("abc")`, "ABC"},
+		{`lower("ÄBC")`, "äbc"},
+		{`upper("a", "b")`, "ERROR: wrong number of arguments. got=2, want=1"},
+		{`contains("turtle", "rtl")`, "true"},
+		{`contains("turtle", "x")`, "false"},
+		{`starts_with("turtle", "tur")`, "true"},
+		{`ends_with("turtle", "tur")`, "false"},
+		{`replace("a.b.c", ".", "/")`, "a/b/c"},
+		{`index_of("turtle", "tle")`, "3"},
+		{`index_of("äbc", "c")`, "2"},
+		{`index_of("turtle", "x")`, "-1"},
+		{`substr("turtle", 2)`, "rtle"},
+		{`substr("turtle", 1, 3)`, "urt"},
+		{`substr("turtle", -3)`, "tle"},
+		{`substr("turtle", 4, 10)`, "le"},
+		{`substr("äbc", 1, 1)`, "b"},
+		{`substr("turtle", 1, -1)`, "ERROR: length for `substr` must not be negative, got -1"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`repeat("ab", 0)`, ""},
+		{`repeat("ab", -1)`, "ERROR: count for `repeat` must not be negative, got -1"},
+		{`chars("aäb")`, "[a, ä, b]"},
+		{`chars("")`, "[]"},
+		{`"turtle"[0]`, "t"},
+		{`"aäb"[1]`, "ä"},
+		{`"turtle"[6]`, "null"},
+		{`"turtle"[-1]`, "e"},
+		{`"aäb"[-2]`, "ä"},
+		{`"turtle"[-7]`, "null"},
+		{`let s = "abc"; s[len(s) - 1]`, "c"},
+		{`format("%s is %d", "x", 42)`, "x is 42"},
+		{`sprintf("%v and %v", [1, 2], {"a": true})`, "[1, 2] and {a: true}"},
+		{`format("100%%")`, "100%"},
+		{`format("%d", "x")`, "ERROR: %d in `format` needs INTEGER, got STRING"},
+		{`format("%s", 1)`, "ERROR: %s in `format` needs STRING, got INTEGER"},
+		{`format("%d %d", 1)`, "ERROR: missing argument for %d in `format`"},
+		{`sprintf("%d", 1, 2)`, "ERROR: too many arguments for `sprintf`: 1 unused"},
+		{`format("%x", 1)`, "ERROR: unknown verb %x in `format`"},
+		{`format("50%")`, "ERROR: `format` layout ends with %"},
+	}
+
+	testEngines(t, tests)
+}
+
+func TestConversionBuiltins(t *testing.T) {
+	tests := []engineTest{
+		{`type(1)`, "INTEGER"},
+		{`type("a")`, "STRING"},
+		{`type(true)`, "BOOLEAN"},
+		{`type(if (false) { 1 })`, "NULL"},
+		{`type([])`, "ARRAY"},
+		{`type({})`, "HASH"},
+		{`type(fn() {})`, "FUNCTION"},
+		{`type(len)`, "BUILTIN"},
+		{`type(float(1))`, "FLOAT"},
+		{`int("42") + 1`, "43"},
+		{`int(" -7 ")`, "-7"},
+		{`int("4x")`, "ERROR: cannot convert \"4x\" to INTEGER"},
+		{`int(float("2.9"))`, "2"},
+		{`int(float("-2.9"))`, "-2"},
+		{`int(float("NaN"))`, "ERROR: cannot convert NaN to INTEGER"},
+		{`int(true) + int(false)`, "1"},
+		{`int([])`, "ERROR: argument to `int` not supported, got ARRAY"},
+		{`float("2.5")`, "2.5"},
+		{`float(2)`, "2.0"},
+		{`float("1e3")`, "1000.0"},
+		{`float("x")`, "ERROR: cannot convert \"x\" to FLOAT"},
+		{`float({})`, "ERROR: argument to `float` not supported, got HASH"},
+		{`float(1) / 4 + 1`, "1.25"},
+		{`3 * float("0.5")`, "1.5"},
+		{`-float(2) < 1`, "true"},
+		{`float(2) == 2`, "true"},
+		{`str(42) + "!"`, "42!"},
+		{`str([1, "a"])`, "[1, a]"},
+		{`str("a")`, "a"},
+		{`bool(0)`, "true"},
+		{`bool(if (false) { 1 })`, "false"},
+		{`bool(false) == false`, "true"},
+		{`is_int(1)`, "true"},
+		{`is_int("1")`, "false"},
+		{`!is_string("a")`, "false"},
+		{`is_float(float(1))`, "true"},
+		{`is_bool(false)`, "true"},
+		{`is_null(first([]))`, "true"},
+		{`is_array([])`, "true"},
+		{`is_hash([])`, "false"},
+		{`is_function(fn() {})`, "true"},
+		{`is_function(len)`, "true"},
+		{`has({"a": 1}, "a") == true`, "true"},
+		{`is_int()`, "ERROR: wrong number of arguments. got=0, want=1"},
+	}
+
+	testEngines(t, tests)
+}
+
+func TestMathBuiltins(t *testing.T) {
+	tests := []engineTest{
+		{`abs(-3)`, "3"},
+		{`abs(float("-2.5"))`, "2.5"},
+		{`abs("a")`, "ERROR: argument to `abs` must be a number, got STRING"},
+		{`min(3, 1, 2)`, "1"},
+		{`max(3, float("3.5"), 2)`, "3.5"},
+		{`max([4, 9, 2])`, "9"},
+		{`min([])`, "ERROR: `min` needs at least one number"},
+		{`min(1, "a")`, "ERROR: argument to `min` must be a number, got STRING"},
+		{`pow(2, 10)`, "1024"},
+		{`pow(2, -1)`, "0.5"},
+		{`pow(1, 100000000000)`, "1"},
+		{`pow(-1, 100000000001)`, "-1"},
+		{`pow(3, 39)`, "4052555153018976267"},
+		{`pow(-2, 63)`, "-9223372036854775808"},
+		{`pow(10, 30)`, "1e+30"},
+		{`pow(2, 63)`, "9.223372036854776e+18"},
+		{`pow(float("2.25"), float("0.5"))`, "1.5"},
+		{`sqrt(16)`, "4.0"},
+		{`sqrt(-1)`, "ERROR: argument to `sqrt` must not be negative, got -1"},
+		{`floor(float("2.7"))`, "2"},
+		{`floor(float("-2.2"))`, "-3"},
+		{`ceil(float("2.1"))`, "3"},
+		{`round(float("2.5"))`, "3"},
+		{`round(7)`, "7"},
+		{`round(sqrt(-0))`, "0"},
+		{`clamp(15, 0, 10)`, "10"},
+		{`clamp(-5, 0, 10)`, "0"},
+		{`clamp(5, 0, 10)`, "5"},
+		{`clamp(5, 10, 0)`, "ERROR: bounds for `clamp` are reversed: 10 > 0"},
+		{`gcd(12, 18)`, "6"},
+		{`gcd(-4, 6)`, "2"},
+		{`gcd(0, 5)`, "5"},
+		{`gcd(1, "a")`, "ERROR: arguments to `gcd` must be INTEGER, got INTEGER and STRING"},
+		{`PI`, "3.141592653589793"},
+		{`round(E * 1000)`, "2718"},
+		{`let f = fn() { PI * 2 }; f() > 6`, "true"},
+		{`let PI = 3; PI`, "3"},
+		{`sort([3, float("1.5"), 2])`, "[1.5, 2, 3]"},
+		{`let r = random(); if (r < 0) { false } else { r < 1 }`, "true"},
+		{`let max = 9223372036854775807; all(map(range(0, 100), fn(i) { random_int(-max, max) }), fn(r) { if (r < -max) { false } else { r < max } })`, "true"},
+		{`let max = 9223372036854775807; random_int(max - 1, max)`, "9223372036854775806"},
+		{`let max = 9223372036854775807; random_int(-max, -max + 1)`, "-9223372036854775807"},
+		{`random_int(5, 5)`, "ERROR: empty range for `random_int`: 5..5"},
+		{`random_int(0)`, "ERROR: empty range for `random_int`: 0..0"},
+		{`random_int("a")`, "ERROR: argument to `random_int` must be INTEGER, got STRING"},
+	}
+
+	testEngines(t, tests)
+}
+
+func TestJSONBuiltins(t *testing.T) {
+	tests := []engineTest{
+		{`json_parse("{\"b\": [1, 2.5, true, null], \"a\": {\"x\": \"y\"}}")`, "{b: [1, 2.5, true, null], a: {x: y}}"},
+		{`json_parse("[]")`, "[]"},
+		{`json_parse("\"a\\u00e4\"")`, "aä"},
+		{`json_parse("12345678901234567890")`, "1.2345678901234567e+19"},
+		{`json_parse("{\"a\": 1}")["a"] + 1`, "2"},
+		{`is_null(json_parse("null"))`, "true"},
+		{`if (json_parse("[null]")[0]) { 1 } else { 2 }`, "2"},
+		{`json_parse("[1,")`, "ERROR: invalid JSON: unexpected end of JSON input"},
+		{`json_parse("")`, "ERROR: invalid JSON: unexpected end of JSON input"},
+		{`json_parse("[1] [2]")`, "ERROR: invalid JSON: unexpected data after top-level value"},
+		{`json_parse("{1: 2}")`, "ERROR: invalid JSON: object member name must be a string"},
+		{`json_parse(1)`, "ERROR: argument to `json_parse` must be STRING, got INTEGER"},
+		{`json_stringify({"b": 1, "a": [true, "x\"<y>", if (false) { 1 }]})`, `{"b":1,"a":[true,"x\"<y>",null]}`},
+		{`json_stringify(float(1) / 4)`, "0.25"},
+		{`json_stringify({"a": [1, 2], "b": {}, "c": []}, 2)`, "{\n  \"a\": [\n    1,\n    2\n  ],\n  \"b\": {},\n  \"c\": []\n}"},
+		{`json_stringify([1], "\t")`, "[\n\t1\n]"},
+		{`json_stringify({1: 2})`, "ERROR: JSON object keys must be STRING, got INTEGER"},
+		{`json_stringify([fn() { 1 }])`, "ERROR: cannot encode FUNCTION as JSON"},
+		{`json_stringify(len)`, "ERROR: cannot encode BUILTIN as JSON"},
+		{`json_stringify(1, true)`, "ERROR: indent for `json_stringify` must be INTEGER or STRING, got BOOLEAN"},
+		{`json_stringify(json_parse(json_stringify({"k": [1, "two", {"x": [], "y": if (false) { 1 }}]})))`, `{"k":[1,"two",{"x":[],"y":null}]}`},
+	}
+
+	testEngines(t, tests)
+}
+
+func TestCollectionBuiltinCallbackErrors(t *testing.T) {
+	tests := []struct {
+		input      string
+		vmError    string
+		evalResult string
+	}{
+		{
+			`map([1, 2], fn(x) { x + "a" })`,
+			"executing bytecode failed: unsupported types for binary operation: INTEGER STRING",
+			"ERROR: type mismatch: INTEGER + STRING",
+		},
+		{
+			`sort([1, 2, 3], fn(a) { true })`,
+			"executing bytecode failed: wrong number of arguments: want=1, got=2",
+			"ERROR: wrong number of arguments: want=1, got=2",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := NewRuntime().Run(tt.input)
+		if err == nil || err.Error() != tt.vmError {
+			t.Errorf("%q: wrong vm error. want=%q, got=%v", tt.input, tt.vmError, err)
+		}
+
+		result := evaluate(t, tt.input)
+		if result != tt.evalResult {
+			t.Errorf("%q: wrong evaluator result. want=%q, got=%q", tt.input, tt.evalResult, result)
+		}
+	}
+}
+
+func TestBuiltinAllocationLimits(t *testing.T) {
+	limits := object.Limits{MaxAllocations: 1000}
+
+	tests := []struct {
+		input    string
+		expected error
+	}{
+		{`len(range(0, 100))`, nil},
+		{`len(range(0, 20000000))`, object.ErrAllocationLimit},
+		{`len(range(0, 9223372036854775807, 2))`, object.ErrAllocationLimit},
+		{`len(repeat("ab", 100000000))`, object.ErrAllocationLimit},
+		{`len(split(repeat("a", 900), ""))`, object.ErrAllocationLimit},
+		{`let xs = range(0, 600); len(map(xs, fn(x) { x }))`, object.ErrAllocationLimit},
+		{`let s = repeat("a", 400); len(replace(s, "a", "aaaa"))`, object.ErrAllocationLimit},
+		{`try { len(range(0, 20000000)) } catch (e) { 0 }`, object.ErrAllocationLimit},
+		{`let h = {1: 1, 2: 2, 3: 3, 4: 4, 5: 5, 6: 6, 7: 7, 8: 8}; len(keys(h))`, nil},
+		{`let h = {1: 1, 2: 2, 3: 3, 4: 4, 5: 5, 6: 6, 7: 7, 8: 8}; reduce(range(0, 200), fn(n, i) { n + len(keys(h)) }, 0)`, object.ErrAllocationLimit},
+		{`let h = {1: 1, 2: 2, 3: 3, 4: 4, 5: 5, 6: 6, 7: 7, 8: 8}; reduce(range(0, 200), fn(n, i) { n + len(values(h)) }, 0)`, object.ErrAllocationLimit},
+		{`let h = {1: 1, 2: 2, 3: 3, 4: 4, 5: 5, 6: 6, 7: 7, 8: 8}; reduce(range(0, 100), fn(n, i) { n + len(entries(h)) }, 0)`, object.ErrAllocationLimit},
+		{`let h = {1: 1, 2: 2, 3: 3, 4: 4, 5: 5, 6: 6, 7: 7, 8: 8}; reduce(range(0, 60), fn(n, i) { n + len(keys(merge(h, h))) }, 0)`, object.ErrAllocationLimit},
+	}
+
+	for _, tt := range tests {
+		runtime := NewRuntime()
+		runtime.SetLimits(limits)
+		_, err := runtime.Run(tt.input)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%q: wrong vm error. want=%v, got=%v", tt.input, tt.expected, err)
+		}
+
+		p := parser.New(lexer.New(tt.input))
+		evaluated := evaluator.EvalContext(context.Background(), p.ParseProgram(), object.NewEnvironment(), limits)
+		err = nil
+		if errObj, ok := evaluated.(*object.Error); ok {
+			err = errObj.Err
+			if err == nil {
+				err = errors.New(errObj.Message)
+			}
+		}
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%q: wrong evaluator error. want=%v, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	tooLong := []engineTest{
+		{`range(0, 9223372036854775807)`, "ERROR: result of `range` is too long"},
+		{`repeat("ab", 4611686018427387904)`, "ERROR: result of `repeat` is too long"},
+	}
+	testEngines(t, tooLong)
+}
+
+func TestSeed(t *testing.T) {
+	host := object.NewHost(strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{})
+	host.Capabilities = object.CapSeed
+
+	tests := []engineTest{
+		{`seed(42); [random_int(100), random_int(100), random_int(10, 20)]`, "[61, 37, 16]"},
+		{`seed(42); let r = random(); if (r < 0) { false } else { r < 1 }`, "true"},
+		{`seed(7); let a = random(); seed(7); a == random()`, "true"},
+		{`seed("a")`, "ERROR: argument to `seed` must be INTEGER, got STRING"},
+	}
+
+	testEnginesWithHost(t, host, tests)
+}
+
+// testEngines runs every test on the VM and on the evaluator.
+func testEngines(t *testing.T, tests []engineTest) {
+	t.Helper()
+	testEnginesWithHost(t, object.DefaultHost(), tests)
+}
+
+// testEnginesWithHost is like testEngines, with builtins running against
+// host.
+func testEnginesWithHost(t *testing.T, host *object.Host, tests []engineTest) {
+	t.Helper()
+
+	for _, tt := range tests {
+		runtime := NewRuntime()
+		runtime.SetHost(host)
+		result, err := runtime.Run(tt.input)
+		if err != nil {
+			t.Errorf("%q: vm error: %s", tt.input, err)
+		} else if result.Inspect() != tt.expected {
+			t.Errorf("%q: wrong vm result. want=%q, got=%q", tt.input, tt.expected, result.Inspect())
+		}
+
+		evaluated := evaluateWithHost(t, host, tt.input)
+		if evaluated != tt.expected {
+			t.Errorf("%q: wrong evaluator result. want=%q, got=%q", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
+func evaluate(t *testing.T, input string) string {
+	t.Helper()
+	return evaluateWithHost(t, object.DefaultHost(), input)
+}
+
+func evaluateWithHost(t *testing.T, host *object.Host, input string) string {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("%q: parser errors: %q", input, p.Errors())
+	}
+
+	env := object.NewEnvironment()
+	env.SetHost(host)
+	result := evaluator.Eval(program, env)
+	if result == nil {
+		return "null"
+	}
+	return result.Inspect()
+}
@@ -0,0 +1,50 @@
+package turtle
+
+import "testing"
+
+func TestDestructuring(t *testing.T) {
+	tests := []engineTest{
+		{`let [a, b] = [1, 2]; a + b`, "3"},
+		{`let [a, b, ...rest] = [1, 2, 3, 4]; rest`, "[3, 4]"},
+		{`let [a, ...rest] = [1]; rest`, "[]"},
+		{`let [_, second] = ["a", "b"]; second`, "b"},
+		{`let [a, [b, c]] = [1, [2, 3]]; a * b * c`, "6"},
+		{`let {"name": n, "age": a} = {"name": "turtle", "age": 3}; [n, a]`, "[turtle, 3]"},
+		{`let {"point": [x, y]} = {"point": [3, 4], "label": "p"}; x * y`, "12"},
+		{`let [{"k": v}] = [{"k": 1}]; v`, "1"},
+		{`let ["ok", value] = ["ok", 5]; value`, "5"},
+		{`let f = fn(pair) { let [a, b] = pair; a - b }; f([5, 2])`, "3"},
+		{`let a = 1; let [a, b] = [a + 1, a + 2]; [a, b]`, "[2, 3]"},
+		{`let swap = fn(p) { let [a, b] = p; [b, a] }; swap(swap([1, 2]))`, "[1, 2]"},
+		{`let first = fn(xs) { let [h, ...t] = xs; h }; try { first([]) } catch (e) { e }`, "can't destructure [] into [h, ...t]"},
+	}
+
+	testEngines(t, tests)
+}
+
+func TestDestructuringErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b] = [1, 2, 3];`, "can't destructure [1, 2, 3] into [a, b]"},
+		{`let [a, b, ...r] = [1];`, "can't destructure [1] into [a, b, ...r]"},
+		{`let [a] = "a";`, "can't destructure a into [a]"},
+		{`let {"name": n} = {"age": 3};`, "can't destructure {age: 3} into {name:n}"},
+		{`let {"name": n} = [1];`, "can't destructure [1] into {name:n}"},
+		{`let [1, x] = [2, 3];`, "can't destructure [2, 3] into [1, x]"},
+		{`let {"p": [x, y]} = {"p": [1]};`, "can't destructure {p: [1]} into {p:[x, y]}"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewRuntime().Run(tt.input)
+		if err == nil || err.Error() != "executing bytecode failed: "+tt.expected {
+			t.Errorf("%q: wrong vm error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+
+		result := evaluate(t, tt.input)
+		if result != "ERROR: "+tt.expected {
+			t.Errorf("%q: wrong evaluator result. want=%q, got=%q", tt.input, tt.expected, result)
+		}
+	}
+}
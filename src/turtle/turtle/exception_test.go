@@ -0,0 +1,154 @@
+package turtle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"turtle/evaluator"
+	"turtle/lexer"
+	"turtle/object"
+	"turtle/parser"
+)
+
+func TestTryCatch(t *testing.T) {
+	tests := []engineTest{
+		{`try { 1 } catch (e) { 2 }`, "1"},
+		{`try { throw 5; 1 } catch (e) { e * 2 }`, "10"},
+		{`try { throw "bad input" } catch (e) { "caught " + e }`, "caught bad input"},
+		{`try { throw [1, 2] } catch (e) { len(e) }`, "2"},
+		{`try { 1 / 0 } catch (e) { e }`, "can't divide by 0"},
+		{`try { 1 + "a" } catch (e) { type(e) }`, "STRING"},
+		{`try { len(1) } catch (e) { e }`, "argument to `len` not supported, got INTEGER"},
+		{`try { int("x") } catch (e) { -1 }`, "-1"},
+		{`try { let x = 1; } catch (e) { 2 }`, "null"},
+		{`let e = 0; try { throw 1 } catch (e) { }; e`, "0"},
+		{`let x = 1; try { throw 2 } catch (x) { x }; x`, "1"},
+		{`let x = 1; let r = try { throw 2 } catch (x) { x * 10 }; [x, r]`, "[1, 20]"},
+		{`let f = fn() { let x = 1; try { throw 2 } catch (x) { x }; x }; f()`, "1"},
+		{`let f = fn() { let x = 1; let g = try { throw 2 } catch (x) { fn() { x } }; [x, g()] }; f()`, "[1, 2]"},
+		{`let x = 1; try { throw 2 } catch (e) { let x = e; x }; x`, "1"},
+		{`let f = fn() { throw "deep" }; let g = fn() { f() + 1 }; try { g() } catch (e) { e }`, "deep"},
+		{`let f = fn(x) { try { throw x } catch (e) { e + 1 } }; f(1) + f(2)`, "5"},
+		{`try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e + 1 }`, "3"},
+		{`try { map([1, 2], fn(x) { throw x * 10 }) } catch (e) { e }`, "10"},
+		{`let r = try { 1 } catch (e) { 2 }; r + 1`, "2"},
+		{`let f = fn() { try { return 1; } catch (e) { 2 }; 3 }; f()`, "1"},
+		{`let f = fn() { try { throw 1 } catch (e) { return e + 1; }; 3 }; f()`, "2"},
+		{`let f = fn() { f() }; try { f() } catch (e) { e }`, "stack overflow"},
+		{`let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(500)`, "500"},
+	}
+
+	testEngines(t, tests)
+}
+
+func TestFinally(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		output   string
+	}{
+		{`try { 1 } finally { puts("f") }`, "1", "f\n"},
+		{`try { throw 1 } catch (e) { e + 1 } finally { puts("f") }`, "2", "f\n"},
+		{`try { try { throw 1 } finally { puts("f") } } catch (e) { e }`, "1", "f\n"},
+		{`try { try { 1 } catch (e) { throw 2 } finally { puts("f") } } catch (e) { e }`, "1", "f\n"},
+		{`try { try { throw 1 } catch (e) { throw e + 1 } finally { puts("f") } } catch (e) { e }`, "2", "f\n"},
+		{`let f = fn() { try { return 1; } finally { puts("f") } }; f()`, "1", "f\n"},
+		{`let f = fn() { try { return 1; } finally { return 2; } }; f()`, "2", ""},
+		{`let f = fn() { try { try { return 1; } finally { puts("a") } } finally { puts("b") } }; f()`, "1", "a\nb\n"},
+		{`let f = fn() { try { return 1; } finally { puts("a") } }; try { f(); throw 2 } catch (e) { e }`, "2", "a\n"},
+		{`try { try { throw 1 } finally { throw 2 } } catch (e) { e }`, "2", ""},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range []string{"vm", "evaluator"} {
+			var out bytes.Buffer
+			host := object.NewHost(strings.NewReader(""), &out, &out)
+
+			var result string
+			if engine == "vm" {
+				runtime := NewRuntime()
+				runtime.SetHost(host)
+				obj, err := runtime.Run(tt.input)
+				if err != nil {
+					t.Errorf("%q: vm error: %s", tt.input, err)
+					continue
+				}
+				result = obj.Inspect()
+			} else {
+				result = evaluateWithHost(t, host, tt.input)
+			}
+
+			if result != tt.expected {
+				t.Errorf("%q: wrong %s result. want=%q, got=%q", tt.input, engine, tt.expected, result)
+			}
+			if out.String() != tt.output {
+				t.Errorf("%q: wrong %s output. want=%q, got=%q", tt.input, engine, tt.output, out.String())
+			}
+		}
+	}
+}
+
+func TestUncaughtExceptions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`throw "boom"`, "uncaught exception: boom"},
+		{`throw [1, "a"]`, "uncaught exception: [1, a]"},
+		{`let f = fn() { throw 1 }; f(); 2`, "uncaught exception: 1"},
+		{`try { throw 1 } catch (e) { throw e + 1 }`, "uncaught exception: 2"},
+		{`try { throw 1 } finally { 2 }`, "uncaught exception: 1"},
+		{`try { 1 / 0 } finally { 2 }`, "can't divide by 0"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewRuntime().Run(tt.input)
+		if err == nil || err.Error() != "executing bytecode failed: "+tt.expected {
+			t.Errorf("%q: wrong vm error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+
+		result := evaluate(t, tt.input)
+		if result != "ERROR: "+tt.expected {
+			t.Errorf("%q: wrong evaluator result. want=%q, got=%q", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestUncatchableErrors(t *testing.T) {
+	host := object.NewHost(strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{})
+	host.Capabilities = object.CapExit
+
+	exit := `try { exit(3) } catch (e) { 1 }`
+
+	runtime := NewRuntime()
+	runtime.SetHost(host)
+	_, err := runtime.Run(exit)
+	var exitErr *object.ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 {
+		t.Errorf("%q: wrong vm error. want exit status 3, got=%v", exit, err)
+	}
+
+	result := evaluateWithHost(t, host, exit)
+	if result != "ERROR: exit status 3" {
+		t.Errorf("%q: wrong evaluator result. got=%q", exit, result)
+	}
+
+	loop := `let f = fn() { try { f() } catch (e) { f() } }; f()`
+	limits := object.Limits{MaxInstructions: 10000}
+
+	runtime = NewRuntime()
+	runtime.SetLimits(limits)
+	_, err = runtime.Run(loop)
+	if !errors.Is(err, object.ErrInstructionLimit) {
+		t.Errorf("%q: wrong vm error. want instruction limit, got=%v", loop, err)
+	}
+
+	p := parser.New(lexer.New(loop))
+	evaluated := evaluator.EvalContext(context.Background(), p.ParseProgram(), object.NewEnvironment(), limits)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || !errors.Is(errObj.Err, object.ErrInstructionLimit) {
+		t.Errorf("%q: wrong evaluator result. want instruction limit, got=%s", loop, evaluated.Inspect())
+	}
+}
@@ -0,0 +1,105 @@
+package turtle
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"turtle/evaluator"
+	"turtle/lexer"
+	"turtle/object"
+	"turtle/parser"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestGolden runs every testdata/*.tt script on the VM and the evaluator and
+// compares what it prints with testdata/*.golden. A script reads its input
+// from testdata/*.in when that file exists.
+func TestGolden(t *testing.T) {
+	scripts, err := filepath.Glob(filepath.Join("testdata", "*.tt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, script := range scripts {
+		base := strings.TrimSuffix(script, ".tt")
+
+		source, err := os.ReadFile(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		input, err := os.ReadFile(base + ".in")
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+
+		vmOutput := runScriptOnVM(t, string(source), input)
+		evalOutput := runScriptOnEvaluator(t, string(source), input)
+
+		golden := base + ".golden"
+		if *update {
+			err := os.WriteFile(golden, []byte(vmOutput), 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if vmOutput != string(expected) {
+			t.Errorf("%s: wrong vm output.\nwant=\n%s\ngot=\n%s", script, expected, vmOutput)
+		}
+		if evalOutput != string(expected) {
+			t.Errorf("%s: wrong evaluator output.\nwant=\n%s\ngot=\n%s", script, expected, evalOutput)
+		}
+	}
+}
+
+func runScriptOnVM(t *testing.T, source string, input []byte) string {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	r := NewRuntime()
+	r.SetHost(object.NewHost(bytes.NewReader(input), &stdout, &stderr))
+
+	_, err := r.Run(source)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	return output(stdout, stderr)
+}
+
+func runScriptOnEvaluator(t *testing.T, source string, input []byte) string {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	env := object.NewEnvironment()
+	env.SetHost(object.NewHost(bytes.NewReader(input), &stdout, &stderr))
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %q", p.Errors())
+	}
+
+	result := evaluator.Eval(program, env)
+	if result != nil && result.Type() == object.ERROR_OBJ {
+		t.Fatalf("evaluation failed: %s", result.Inspect())
+	}
+
+	return output(stdout, stderr)
+}
+
+func output(stdout, stderr bytes.Buffer) string {
+	if stderr.Len() == 0 {
+		return stdout.String()
+	}
+	return stdout.String() + "--- stderr ---\n" + stderr.String()
+}
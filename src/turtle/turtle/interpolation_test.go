@@ -0,0 +1,21 @@
+package turtle
+
+import "testing"
+
+func TestStringInterpolation(t *testing.T) {
+	tests := []engineTest{
+		{`let name = "turtle"; "Hello ${name}"`, "Hello turtle"},
+		{`let items = [1, 2, 3]; "you have ${len(items)} items"`, "you have 3 items"},
+		{`"${1} ${true} ${[1, "a"]} ${{"k": 2}}"`, "1 true [1, a] {k: 2}"},
+		{`"${puts}"`, "builtin function"},
+		{`"${if (false) { 1 }}"`, "null"},
+		{`"${"nested ${1 + 1}"}!"`, "nested 2!"},
+		{`"\${not interpolated}"`, "${not interpolated}"},
+		{`let f = fn(x) { "${x}${x}" }; f("ab") + f(1)`, "abab11"},
+		{`len("${12}${345}")`, "5"},
+		{`try { "${1 / 0}" } catch (e) { "caught: ${e}" }`, "caught: can't divide by 0"},
+		{`let h = {"a": 1}; "${h["a"]}"`, "1"},
+	}
+
+	testEngines(t, tests)
+}
@@ -0,0 +1,100 @@
+package turtle
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIterators(t *testing.T) {
+	tests := []engineTest{
+		{`collect(iter([1, 2, 3]))`, "[1, 2, 3]"},
+		{`collect("abc")`, "[a, b, c]"},
+		{`let it = iter([1]); [next(it), next(it), next(it)]`,
+			"[{value: 1, done: false}, {value: null, done: true}, {value: null, done: true}]"},
+		{`let it = iter([1, 2, 3]); next(it); collect(it)`, "[2, 3]"},
+		{`collect(take([1, 2, 3], 2))`, "[1, 2]"},
+		{`collect(take([1, 2], 5))`, "[1, 2]"},
+		{`collect(take([1, 2], 0))`, "[]"},
+		{`collect(map_iter([1, 2, 3], fn(x) { x * x }))`, "[1, 4, 9]"},
+		{`collect(filter_iter(1..10, fn(x) { x / 3 * 3 == x }))`, "[3, 6, 9]"},
+		{`let n = 10; collect(map_iter(take("abcdef", 3), fn(c) { c + str(n) }))`, "[a10, b10, c10]"},
+		{`type(iter([]))`, "ITERATOR"},
+		{`let calls = []; let it = map_iter([1, 2, 3], fn(x) { push(calls, x); x }); next(it); calls`, "[]"},
+	}
+
+	testEngines(t, tests)
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []engineTest{
+		{`let g = fn() { yield 1; yield 2; yield 3 }; collect(g())`, "[1, 2, 3]"},
+		{`let g = fn(a, b = a * 2) { yield a; yield b }; collect(g(5))`, "[5, 10]"},
+		{`let g = fn() { yield 1; 99 }; collect(g())`, "[1]"},
+		{`let g = fn() { yield 1 }; let it = g(); [next(it), next(it)]`,
+			"[{value: 1, done: false}, {value: null, done: true}]"},
+		{`let g = fn() { yield 1 }; type(g())`, "ITERATOR"},
+		{`let g = fn(x) { if (x > 0) { yield "pos" } else { yield "neg" }; yield "end" }; collect(g(-1))`,
+			"[neg, end]"},
+		{`let g = fn() { let x = yield 1; yield x }; collect(g())`, "[1, null]"},
+		{`let g = fn() { yield 0; yield ...[1, 2]; yield ..."ab"; yield 3 }; collect(g())`,
+			"[0, 1, 2, a, b, 3]"},
+		{`let inner = fn() { yield 1; yield 2 }; let outer = fn() { yield ...inner(); yield ...inner() }; collect(outer())`,
+			"[1, 2, 1, 2]"},
+		{`let count = fn(n) { yield n; yield ...count(n + 1) }; collect(take(count(1), 5))`,
+			"[1, 2, 3, 4, 5]"},
+		{`let count = fn(n) { yield n; yield ...count(n + 1) }; collect(take(filter_iter(count(1), fn(x) { x / 2 * 2 == x }), 3))`,
+			"[2, 4, 6]"},
+		{`let count = fn(n) { yield n; yield ...count(n + 1) }; collect(take(map_iter(count(1), fn(x) { x * 10 }), 3))`,
+			"[10, 20, 30]"},
+		{`let upto = fn(n, i = 0) { if (i < n) { yield i; yield ...upto(n, i + 1) } }; len(collect(upto(20000)))`,
+			"20000"},
+		{`let g = fn(xs) { if (len(xs) > 0) { yield xs[0] * 2; yield ...g(xs[1:]) } }; collect(g([1, 2, 3]))`,
+			"[2, 4, 6]"},
+		{`let g = fn() { yield 1; yield 2 }; let a = g(); let b = g(); next(a); [next(a)["value"], next(b)["value"]]`,
+			"[2, 1]"},
+		{`let g = fn() { try { yield 1; throw "boom" } catch (e) { yield e }; yield 2 }; collect(g())`,
+			"[1, boom, 2]"},
+		{`let g = fn() { yield 1; throw "bad" }; let it = g(); next(it); try { next(it) } catch (e) { e }`, "bad"},
+		{`let g = fn() { yield 1; throw "bad" }; let it = g(); next(it); try { next(it) } catch (e) { 0 }; next(it)`,
+			"{value: null, done: true}"},
+		{`let g = fn() { yield 1; yield 2 }; let it = g(); let f = fn() { next(it)["value"] }; f() + f()`, "3"},
+	}
+
+	testEngines(t, tests)
+}
+
+func TestIteratorErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`next([1])`, "argument to `next` must be ITERATOR, got ARRAY"},
+		{`collect(5)`, "argument to `collect` must be ITERATOR, ARRAY or STRING, got INTEGER"},
+		{`take([1], "a")`, "second argument to `take` must be INTEGER, got STRING"},
+	}
+
+	for _, tt := range tests {
+		testEngines(t, []engineTest{{tt.input, "ERROR: " + tt.expected}})
+	}
+
+	runtimeErrors := []struct {
+		input    string
+		expected string
+	}{
+		{`let g = fn() { yield ...5 }; collect(g())`, "can't yield from INTEGER"},
+		{`let g = fn(f) { yield ...f() }; let it = g(fn() { it }); collect(it)`, "generator is already running"},
+		{`collect(map_iter([1], fn(x) { x / 0 }))`, "can't divide by 0"},
+	}
+
+	for _, tt := range runtimeErrors {
+		_, err := NewRuntime().Run(tt.input)
+		if err == nil || !strings.HasSuffix(err.Error(), tt.expected) {
+			t.Errorf("%q: wrong vm error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+
+		result := evaluate(t, tt.input)
+		if result != "ERROR: "+tt.expected {
+			t.Errorf("%q: wrong evaluator result. want=%q, got=%q", tt.input, tt.expected, result)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package turtle
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []engineTest{
+		{`match 0 { 0 => "zero", _ => "other" }`, "zero"},
+		{`match 5 { 0 => "zero", _ => "other" }`, "other"},
+		{`match -1 { -1 => "minus one", _ => "other" }`, "minus one"},
+		{`match "b" { "a" => 1, "b" => 2 }`, "2"},
+		{`match true { false => 0, true => 1 }`, "1"},
+		{`match 3 { 1 => 1, 2 => 2 }`, "null"},
+		{`match 1 { "1" => "string", 1 => "int" }`, "int"},
+		{`match 7 { n => n * 2 }`, "14"},
+		{`match [1, 2, 3] { [] => "empty", [first, ...rest] => rest }`, "[2, 3]"},
+		{`match [] { [] => "empty", [first, ...rest] => first }`, "empty"},
+		{`match [1, 2] { [a] => a, [a, b] => a + b, _ => 0 }`, "3"},
+		{`match [1, 2, 3] { [a, b] => a + b, _ => "no" }`, "no"},
+		{`match [1, [2, 3]] { [1, [x, y]] => x * y }`, "6"},
+		{`match [1, 2] { [2, x] => x, [1, x] => -x }`, "-2"},
+		{`match [1, 2, 3] { [_, ...tail] => len(tail) }`, "2"},
+		{`match "abc" { [x] => x, _ => "not an array" }`, "not an array"},
+		{`match {"type": "circle", "r": 2} { {"type": "square", "side": s} => s * s, {"type": "circle", "r": r} => 3 * r * r }`, "12"},
+		{`match {"a": 1} { {"b": b} => b, {} => "some hash" }`, "some hash"},
+		{`match {"a": [1]} { {"a": [a]} => a, _ => "no a" }`, "1"},
+		{`match [1, 2] { {} => "hash", _ => "other" }`, "other"},
+		{`match 5 { n if n > 10 => "big", n if n > 3 => "medium", _ => "small" }`, "medium"},
+		{`match [3, 4] { [a, b] if a > b => a, [a, b] => b }`, "4"},
+		{`let x = 1; match [5, 6] { [x, 7] => 0, _ => x }`, "1"},
+		{`let describe = fn(v) { match v { 0 => "zero", [_, ...r] => "list", {"k": k} => k, s => type(s) } }; [describe(0), describe([1]), describe({"k": "key"}), describe("s")]`, "[zero, list, key, STRING]"},
+		{`let f = fn(n) { match n { 0 => 1, _ => n * f(n - 1) } }; f(5)`, "120"},
+		{`match match 1 { 1 => 2 } { 2 => "nested" }`, "nested"},
+		{`let x = 1; match 5 { x if x > 10 => 1, _ => 2 }; x`, "1"},
+		{`let x = 1; let r = match 5 { x if x > 10 => 1, x => x * 2 }; [x, r]`, "[1, 10]"},
+		{`let x = 1; let f = fn() { x }; match 5 { x if x > 10 => 1, _ => 2 }; [x, f()]`, "[1, 1]"},
+		{`let f = fn() { let x = 1; let g = fn() { x }; match 5 { x if x > 10 => 1, _ => 2 }; [x, g()] }; f()`, "[1, 1]"},
+		{`let f = fn() { let x = 1; let g = match 5 { x => fn() { x } }; [x, g()] }; f()`, "[1, 5]"},
+		{`let [a, b] = [1, 2]; match [3, 4] { [a, 5] => 0, [_, b] => b }; [a, b]`, "[1, 2]"},
+	}
+
+	testEngines(t, tests)
+}
@@ -0,0 +1,235 @@
+package turtle
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"turtle/compiler"
+	"turtle/evaluator"
+	"turtle/lexer"
+	"turtle/object"
+	"turtle/parser"
+)
+
+// modules is an in-memory module loader that counts how often each module
+// is read.
+type modules struct {
+	files map[string]string
+	reads map[string]int
+}
+
+func newModules(files map[string]string) *modules {
+	return &modules{files: files, reads: map[string]int{}}
+}
+
+func (m *modules) load(path string) (string, error) {
+	source, ok := m.files[path]
+	if !ok {
+		return "", fmt.Errorf("no such module")
+	}
+	m.reads[path]++
+	return source, nil
+}
+
+var moduleFiles = map[string]string{
+	"math.tt": `
+		let square = fn(x) { x * x };
+		export let pi = 3;
+		export let area = fn(r) { pi * square(r) };
+	`,
+	"lib/strings.tt": `
+		import "helpers.tt" as helpers;
+		export let shout = fn(s) { helpers.exclaim(upper(s)) };
+	`,
+	"lib/helpers.tt": `
+		puts("loading helpers");
+		export let exclaim = fn(s) { s + "!" };
+	`,
+	"counter.tt": `
+		let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } };
+		export let five = fact(5);
+	`,
+	"a.tt":      `import "b.tt" as b; export let x = 1;`,
+	"b.tt":      `import "c.tt" as c; export let y = 2;`,
+	"c.tt":      `import "a.tt" as a; export let z = 3;`,
+	"self.tt":   `import "self.tt" as me;`,
+	"broken.tt": `let = 1;`,
+	"nested.tt": `let f = fn() { import "math.tt" as m; m }; f();`,
+}
+
+func TestModules(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		output   string
+	}{
+		{`import "math.tt" as math; math.area(2)`, "12", ""},
+		{`import "math.tt" as math; math.pi`, "3", ""},
+		{`import "math.tt" as math; keys(math)`, "[pi, area]", ""},
+		{`import "math.tt" as math; math.square`, "null", ""},
+		{`let square = 10; import "math.tt" as math; math.area(1) + square`, "13", ""},
+		{`import "lib/strings.tt" as s; s.shout("hi")`, "HI!", "loading helpers\n"},
+		{`import "lib/strings.tt" as s; import "lib/helpers.tt" as h; h.exclaim(s.shout("a"))`, "A!!", "loading helpers\n"},
+		{`import "math.tt" as a; import "math.tt" as b; a.area(1) + b.pi`, "6", ""},
+		{`import "counter.tt" as c; c.five`, "120", ""},
+		{`let h = {"name": "turtle"}; h.name`, "turtle", ""},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range []string{"vm", "evaluator"} {
+			var out bytes.Buffer
+			host := object.NewHost(strings.NewReader(""), &out, &out)
+
+			var result string
+			if engine == "vm" {
+				runtime := NewRuntime()
+				runtime.SetHost(host)
+				runtime.SetLoader(newModules(moduleFiles).load)
+				obj, err := runtime.Run(tt.input)
+				if err != nil {
+					t.Errorf("%q: vm error: %s", tt.input, err)
+					continue
+				}
+				result = obj.Inspect()
+			} else {
+				result = evaluateModules(t, host, newModules(moduleFiles), tt.input)
+			}
+
+			if result != tt.expected {
+				t.Errorf("%q: wrong %s result. want=%q, got=%q", tt.input, engine, tt.expected, result)
+			}
+			if out.String() != tt.output {
+				t.Errorf("%q: wrong %s output. want=%q, got=%q", tt.input, engine, tt.output, out.String())
+			}
+		}
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "a.tt" as a;`, "import cycle: a.tt -> b.tt -> c.tt -> a.tt"},
+		{`import "self.tt" as me;`, "import cycle: self.tt -> self.tt"},
+		{`import "missing.tt" as m;`, "can't import missing.tt: no such module"},
+		{`import "broken.tt" as b;`, "can't import broken.tt: parser errors: expected next token to be IDENT, got = instead"},
+		{`if (true) { import "math.tt" as m; }`, "import must be at the top level of a file"},
+		{`import "nested.tt" as n;`, "import must be at the top level of a file"},
+		{`let f = fn() { export let x = 1; }; f()`, "export must be at the top level of a file"},
+	}
+
+	for _, tt := range tests {
+		runtime := NewRuntime()
+		runtime.SetLoader(newModules(moduleFiles).load)
+		_, err := runtime.Run(tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%q: wrong vm error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+
+		host := object.NewHost(strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{})
+		result := evaluateModules(t, host, newModules(moduleFiles), tt.input)
+		if !strings.HasPrefix(result, "ERROR: "+tt.expected) {
+			t.Errorf("%q: wrong evaluator error. want=%q, got=%q", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestModulesCompiledOnce(t *testing.T) {
+	loader := newModules(moduleFiles)
+
+	runtime := NewRuntime()
+	runtime.SetHost(object.NewHost(strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{}))
+	runtime.SetLoader(loader.load)
+	for _, input := range []string{
+		`import "lib/strings.tt" as s;`,
+		`import "lib/helpers.tt" as h;`,
+		`import "lib/strings.tt" as again; again.shout("x")`,
+	} {
+		if _, err := runtime.Run(input); err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+	}
+
+	for path, reads := range loader.reads {
+		if reads != 1 {
+			t.Errorf("%s read %d times", path, reads)
+		}
+	}
+}
+
+func TestModulesFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.tt":      `import "lib/greet.tt" as greet; greet.hello("turtle")`,
+		"lib/greet.tt": `import "../names.tt" as names; export let hello = fn(name) { "hello " + names.fix(name) };`,
+		"names.tt":     `export let fix = fn(name) { upper(name) };`,
+	}
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	host := object.NewHost(strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{})
+	host.Root = dir
+
+	runtime := NewRuntime()
+	runtime.SetHost(host)
+	_, err := runtime.Run(files["main.tt"])
+	if err == nil || !strings.Contains(err.Error(), object.ErrNotPermitted.Error()) {
+		t.Fatalf("expected imports to need a capability, got %v", err)
+	}
+
+	evaluated := evaluateWithHost(t, host, files["main.tt"])
+	if !strings.Contains(evaluated, object.ErrNotPermitted.Error()) {
+		t.Fatalf("expected evaluator imports to need a capability, got %q", evaluated)
+	}
+
+	comp := compiler.New()
+	err = comp.Compile(parser.New(lexer.New(files["main.tt"])).ParseProgram())
+	if err == nil || !strings.Contains(err.Error(), object.ErrNotPermitted.Error()) {
+		t.Fatalf("expected the default host of the compiler to refuse imports, got %v", err)
+	}
+
+	host.Capabilities = object.CapReadFiles
+	result, err := runtime.Run(files["main.tt"])
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if result.Inspect() != "hello TURTLE" {
+		t.Errorf("wrong vm result. got=%q", result.Inspect())
+	}
+
+	evaluated = evaluateWithHost(t, host, files["main.tt"])
+	if evaluated != "hello TURTLE" {
+		t.Errorf("wrong evaluator result. got=%q", evaluated)
+	}
+}
+
+func evaluateModules(t *testing.T, host *object.Host, loader *modules, input string) string {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("%q: parser errors: %q", input, p.Errors())
+	}
+
+	env := object.NewEnvironment()
+	env.SetHost(host)
+	env.Modules().Loader = loader.load
+
+	result := evaluator.Eval(program, env)
+	if result == nil {
+		return "null"
+	}
+	return result.Inspect()
+}
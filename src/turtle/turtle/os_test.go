@@ -0,0 +1,111 @@
+package turtle
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"turtle/evaluator"
+	"turtle/lexer"
+	"turtle/object"
+	"turtle/parser"
+)
+
+func TestOSBuiltinsDeniedByDefault(t *testing.T) {
+	tests := []engineTest{
+		{`read_file("x")`, "ERROR: `read_file` is not permitted by the host"},
+		{`write_file("x", "y")`, "ERROR: `write_file` is not permitted by the host"},
+		{`list_dir(".")`, "ERROR: `list_dir` is not permitted by the host"},
+		{`getenv("HOME")`, "ERROR: `getenv` is not permitted by the host"},
+		{`args()`, "ERROR: `args` is not permitted by the host"},
+		{`exit(1)`, "ERROR: `exit` is not permitted by the host"},
+		{`seed(1)`, "ERROR: `seed` is not permitted by the host"},
+	}
+
+	testEngines(t, tests)
+}
+
+func TestOSBuiltins(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"name": "turtle"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TURTLE_TEST_VAR", "shell")
+
+	host := object.NewHost(strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{})
+	host.Capabilities = object.AllCapabilities
+	host.Args = []string{"-v", "input.txt"}
+	host.Root = dir
+
+	tests := []engineTest{
+		{`read_file("config.json")`, `{"name": "turtle"}`},
+		{`json_parse(read_file("config.json"))["name"]`, "turtle"},
+		{`read_file("missing")`, "ERROR: `read_file` failed: openat missing: no such file or directory"},
+		{`read_file("../outside")`, "ERROR: `read_file` failed: openat ../outside: path escapes from parent"},
+		{`write_file("out.txt", "hello"); read_file("out.txt")`, "hello"},
+		{`write_file("sub/out.txt", 1)`, "ERROR: argument to `write_file` must be STRING, got INTEGER"},
+		{`list_dir(".")`, "[config.json, out.txt, sub]"},
+		{`list_dir("sub")`, "[]"},
+		{`getenv("TURTLE_TEST_VAR")`, "shell"},
+		{`getenv("TURTLE_TEST_UNSET")`, "null"},
+		{`args()`, "[-v, input.txt]"},
+	}
+
+	testEnginesWithHost(t, host, tests)
+}
+
+func TestOSBuiltinsSingleCapability(t *testing.T) {
+	host := object.NewHost(strings.NewReader(""), &bytes.Buffer{}, &bytes.Buffer{})
+	host.Capabilities = object.CapArgs
+
+	tests := []engineTest{
+		{`args()`, "[]"},
+		{`getenv("HOME")`, "ERROR: `getenv` is not permitted by the host"},
+	}
+
+	testEnginesWithHost(t, host, tests)
+}
+
+func TestExit(t *testing.T) {
+	input := `puts("before"); map([1, 2], fn(x) { if (x == 2) { exit(3) } }); puts("after")`
+
+	var out bytes.Buffer
+	host := object.NewHost(strings.NewReader(""), &out, &out)
+	host.Capabilities = object.CapExit
+
+	runtime := NewRuntime()
+	runtime.SetHost(host)
+	_, err := runtime.Run(input)
+
+	var exit *object.ExitError
+	if !errors.As(err, &exit) {
+		t.Fatalf("vm: expected an ExitError, got %v", err)
+	}
+	if exit.Code != 3 {
+		t.Errorf("vm: wrong exit code. want=3, got=%d", exit.Code)
+	}
+	if out.String() != "before\n" {
+		t.Errorf("vm: wrong output. got=%q", out.String())
+	}
+
+	out.Reset()
+	env := object.NewEnvironment()
+	env.SetHost(host)
+	result := evaluator.Eval(parser.New(lexer.New(input)).ParseProgram(), env)
+
+	exit, ok := object.AsExit(result)
+	if !ok {
+		t.Fatalf("evaluator: expected an exit error, got %s", result.Inspect())
+	}
+	if exit.Code != 3 {
+		t.Errorf("evaluator: wrong exit code. want=3, got=%d", exit.Code)
+	}
+	if out.String() != "before\n" {
+		t.Errorf("evaluator: wrong output. got=%q", out.String())
+	}
+}
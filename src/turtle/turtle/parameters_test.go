@@ -0,0 +1,82 @@
+package turtle
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultParameters(t *testing.T) {
+	tests := []engineTest{
+		{`let f = fn(a, b = 10) { a + b }; f(1)`, "11"},
+		{`let f = fn(a, b = 10) { a + b }; f(1, 2)`, "3"},
+		{`let f = fn(a = 1, b = a + 1) { [a, b] }; f()`, "[1, 2]"},
+		{`let f = fn(a = 1, b = a + 1) { [a, b] }; f(5)`, "[5, 6]"},
+		{`let b = 100; let f = fn(a = b, b = 1) { a }; f()`, "100"},
+		{`let f = fn(xs = []) { push(xs, 1) }; f(); f()`, "[1]"},
+		{`let f = fn(a = puts("default")) { a }; f(1)`, "1"},
+		{`let greet = fn(name, greeting = "hello") { greeting + " " + name }; greet("turtle")`, "hello turtle"},
+		{`let f = fn(x, step = 1) { if (x > 3) { x } else { f(x + step) } }; f(0) + f(0, 2)`, "8"},
+		{`let make = fn(base) { fn(x = base) { x * 2 } }; make(4)()`, "8"},
+		{`let f = fn(a = 1 / 0) { a }; try { f() } catch (e) { e }`, "can't divide by 0"},
+		{`let f = fn(a = 1 / 0) { a }; f(2)`, "2"},
+	}
+
+	testEngines(t, tests)
+}
+
+func TestRestParameters(t *testing.T) {
+	tests := []engineTest{
+		{`let f = fn(...args) { args }; f()`, "[]"},
+		{`let f = fn(...args) { args }; f(1, 2, 3)`, "[1, 2, 3]"},
+		{`let f = fn(first, ...rest) { [first, rest] }; f(1, 2, 3)`, "[1, [2, 3]]"},
+		{`let f = fn(a, b = 2, ...rest) { [a, b, rest] }; f(1)`, "[1, 2, []]"},
+		{`let f = fn(a, b = 2, ...rest) { [a, b, rest] }; f(1, 3, 5, 7)`, "[1, 3, [5, 7]]"},
+		{`let sum = fn(...xs) { reduce(xs, fn(acc, x) { acc + x }, 0) }; sum(1, 2, 3, 4)`, "10"},
+		{`let f = fn(...xs) { len(xs) }; map([[1], [2]], f)`, "[1, 1]"},
+	}
+
+	testEngines(t, tests)
+}
+
+func TestKeywordArguments(t *testing.T) {
+	tests := []engineTest{
+		{`let f = fn(a, b) { a - b }; f(b = 1, a = 5)`, "4"},
+		{`let f = fn(a, b) { a - b }; f(5, b = 1)`, "4"},
+		{`let f = fn(a, b = 2, c = 3) { [a, b, c] }; f(1, c = 30)`, "[1, 2, 30]"},
+		{`let f = fn(a = 1, b = a * 10) { [a, b] }; f(a = 2)`, "[2, 20]"},
+		{`let f = fn(a, ...rest) { [a, rest] }; f(a = 1)`, "[1, []]"},
+		{`let order = []; let f = fn(a, b) { b }; f(b = push(order, "b"), a = push(order, "a"))`, "[b]"},
+		{`let f = fn(a, b) { [a, b] }; let g = fn(x) { f(x, b = x * 2) }; g(3)`, "[3, 6]"},
+	}
+
+	testEngines(t, tests)
+}
+
+func TestParameterErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let f = fn(a, b) { a }; f(1)`, "wrong number of arguments: want=2, got=1"},
+		{`let f = fn(a, b = 1) { a }; f()`, "wrong number of arguments: want=1..2, got=0"},
+		{`let f = fn(a, b = 1) { a }; f(1, 2, 3)`, "wrong number of arguments: want=1..2, got=3"},
+		{`let f = fn(a, ...r) { a }; f()`, "wrong number of arguments: want=at least 1, got=0"},
+		{`let f = fn(a, b) { a }; f(1, c = 2)`, "unexpected keyword argument c"},
+		{`let f = fn(a, b) { a }; f(1, a = 2)`, "got multiple values for argument a"},
+		{`let f = fn(a, b) { a }; f(b = 2)`, "missing argument a"},
+		{`let f = fn(a, ...r) { a }; f(1, r = 2)`, "unexpected keyword argument r"},
+		{`len(x = "a")`, "builtin functions don't take keyword arguments"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewRuntime().Run(tt.input)
+		if err == nil || !strings.HasSuffix(err.Error(), tt.expected) {
+			t.Errorf("%q: wrong vm error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+
+		result := evaluate(t, tt.input)
+		if result != "ERROR: "+tt.expected {
+			t.Errorf("%q: wrong evaluator result. want=%q, got=%q", tt.input, tt.expected, result)
+		}
+	}
+}
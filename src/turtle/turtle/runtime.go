@@ -0,0 +1,168 @@
+// Package turtle embeds the compiler and virtual machine in Go programs.
+package turtle
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"turtle/compiler"
+	"turtle/lexer"
+	"turtle/module"
+	"turtle/object"
+	"turtle/parser"
+	"turtle/vm"
+)
+
+// MaxBuiltins is the number of builtins OpGetBuiltin can address.
+const MaxBuiltins = 256
+
+// Runtime is an isolated turtle instance. Each runtime has its own set of
+// builtins, made of the standard ones plus whatever the host registers, and
+// its own globals, which survive from one call to Run to the next.
+type Runtime struct {
+	symbolTable *compiler.SymbolTable
+	constants   []object.Object
+	globals     []object.Object
+	builtins    []*object.Builtin
+	host        *object.Host
+	limits      object.Limits
+	loader      module.Loader
+}
+
+func NewRuntime() *Runtime {
+	r := &Runtime{
+		symbolTable: compiler.NewSymbolTable(),
+		constants:   []object.Object{},
+		globals:     make([]object.Object, vm.GlobalSize),
+		host:        object.DefaultHost(),
+	}
+
+	for _, b := range object.Builtins {
+		r.defineBuiltin(b.Name, b.Builtin)
+	}
+	for i, constant := range object.Constants {
+		r.symbolTable.DefineConstant(i, constant.Name)
+	}
+
+	return r
+}
+
+// Register makes fn callable from turtle code run by r under name. A host
+// function registered under the name of a standard builtin replaces it.
+func (r *Runtime) Register(name string, fn object.BuiltinFunction) error {
+	if len(r.builtins) >= MaxBuiltins {
+		return fmt.Errorf("too many builtins, can't register %s", name)
+	}
+
+	r.defineBuiltin(name, &object.Builtin{Fn: fn})
+	return nil
+}
+
+func (r *Runtime) defineBuiltin(name string, builtin *object.Builtin) {
+	r.symbolTable.DefineBuiltin(len(r.builtins), name)
+	r.builtins = append(r.builtins, builtin)
+}
+
+// SetHost redirects the input and output of the builtins run by r, which
+// default to the process' standard streams.
+func (r *Runtime) SetHost(host *object.Host) {
+	r.host = host
+}
+
+// SetLoader sets what reads the modules programs import. By default they
+// are read through the host, which must grant object.CapReadFiles.
+func (r *Runtime) SetLoader(loader module.Loader) {
+	r.loader = loader
+}
+
+func (r *Runtime) loadModule(path string) (string, error) {
+	if r.loader != nil {
+		return r.loader(path)
+	}
+	return module.HostLoader(r.host)(path)
+}
+
+// SetLimits bounds the instructions and allocations of every later run.
+func (r *Runtime) SetLimits(limits object.Limits) {
+	r.limits = limits
+}
+
+// Set binds the global name to value, as if the program had run
+// `let name = value;`.
+func (r *Runtime) Set(name string, value object.Object) {
+	symbol, ok := r.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		symbol = r.symbolTable.Define(name)
+	}
+
+	r.globals[symbol.Index] = value
+}
+
+// Get returns the value of the global name.
+func (r *Runtime) Get(name string) (object.Object, bool) {
+	symbol, ok := r.symbolTable.Resolve(name)
+	if !ok || symbol.Scope != compiler.GlobalScope {
+		return nil, false
+	}
+
+	return r.globals[symbol.Index], true
+}
+
+// Run compiles and executes source and returns the value of its last
+// expression statement.
+func (r *Runtime) Run(source string) (object.Object, error) {
+	return r.RunContext(context.Background(), source)
+}
+
+// RunContext is like Run but stops the program once ctx is done. Errors
+// caused by ctx or by the limits wrap ctx.Err(), object.ErrInstructionLimit
+// or object.ErrAllocationLimit.
+func (r *Runtime) RunContext(ctx context.Context, source string) (object.Object, error) {
+	l := lexer.New(source)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parser errors: %s", strings.Join(p.Errors(), "; "))
+	}
+
+	comp := compiler.NewWithState(r.symbolTable, r.constants)
+	comp.SetLoader(r.loadModule)
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, fmt.Errorf("compilation failed: %s", err)
+	}
+
+	bytecode := comp.Bytecode()
+	r.constants = bytecode.Constants
+
+	machine := r.newVM(bytecode)
+	err = machine.RunContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("executing bytecode failed: %w", err)
+	}
+
+	result := machine.LastPoppedStackElem()
+	if result == nil {
+		return vm.Null, nil
+	}
+	return result, nil
+}
+
+// Call applies fn, typically a function fetched with Get, to args.
+func (r *Runtime) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	machine := r.newVM(&compiler.Bytecode{Constants: r.constants})
+
+	result, err := machine.Call(fn, args...)
+	if err != nil {
+		return nil, fmt.Errorf("calling %s failed: %w", fn.Inspect(), err)
+	}
+	return result, nil
+}
+
+func (r *Runtime) newVM(bytecode *compiler.Bytecode) *vm.VM {
+	machine := vm.NewWithBuiltins(bytecode, r.globals, r.builtins)
+	machine.SetHost(r.host)
+	machine.SetLimits(r.limits)
+	return machine
+}
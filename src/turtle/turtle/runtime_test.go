@@ -0,0 +1,186 @@
+package turtle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"turtle/object"
+)
+
+func TestRegister(t *testing.T) {
+	r := NewRuntime()
+
+	var calls []int64
+	err := r.Register("record", func(engine object.Engine, args ...object.Object) object.Object {
+		for _, arg := range args {
+			calls = append(calls, arg.(*object.Integer).Value)
+		}
+		return &object.Integer{Value: int64(len(args))}
+	})
+	if err != nil {
+		t.Fatalf("Register failed: %s", err)
+	}
+
+	result, err := r.Run(`let f = fn(x) { record(x, x * 2) }; f(3) + len("ab")`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	testInteger(t, result, 4)
+	if len(calls) != 2 || calls[0] != 3 || calls[1] != 6 {
+		t.Errorf("host function got wrong arguments: %v", calls)
+	}
+}
+
+func TestRegisterReplacesStandardBuiltin(t *testing.T) {
+	r := NewRuntime()
+	r.Register("len", func(engine object.Engine, args ...object.Object) object.Object {
+		return &object.Integer{Value: 42}
+	})
+
+	result, err := r.Run(`len([1, 2])`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	testInteger(t, result, 42)
+
+	result, err = NewRuntime().Run(`len([1, 2])`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	testInteger(t, result, 2)
+}
+
+func TestRuntimesAreIsolated(t *testing.T) {
+	a := NewRuntime()
+	a.Register("answer", func(engine object.Engine, args ...object.Object) object.Object {
+		return &object.Integer{Value: 42}
+	})
+	b := NewRuntime()
+
+	result, err := a.Run(`answer()`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	testInteger(t, result, 42)
+
+	_, err = b.Run(`answer()`)
+	if err == nil || !strings.Contains(err.Error(), "undefined variable answer") {
+		t.Errorf("expected undefined variable error, got %v", err)
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	r := NewRuntime()
+	r.Set("base", &object.Integer{Value: 10})
+
+	_, err := r.Run(`let total = base + 5;`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	total, ok := r.Get("total")
+	if !ok {
+		t.Fatalf("global total not found")
+	}
+	testInteger(t, total, 15)
+
+	r.Set("base", &object.Integer{Value: 20})
+	result, err := r.Run(`base + total`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+	testInteger(t, result, 35)
+
+	if _, ok := r.Get("missing"); ok {
+		t.Errorf("Get returned a value for an undefined global")
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let = 1;`, "parser errors: "},
+		{`nope`, "compilation failed: undefined variable nope"},
+		{`1 + "a"`, "executing bytecode failed: unsupported types for binary operation: INTEGER STRING"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewRuntime().Run(tt.input)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %q. want prefix %q, got %v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestRunLimits(t *testing.T) {
+	r := NewRuntime()
+	r.SetLimits(object.Limits{MaxInstructions: 1000})
+
+	_, err := r.Run(`let loop = fn() { loop() }; loop()`)
+	if !errors.Is(err, object.ErrInstructionLimit) {
+		t.Errorf("wrong error. want=%v, got=%v", object.ErrInstructionLimit, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = NewRuntime().RunContext(ctx, `let spin = fn() { spin() }; spin()`)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("wrong error. want=%v, got=%v", context.Canceled, err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	r := NewRuntime()
+	r.Register("twice", func(engine object.Engine, args ...object.Object) object.Object {
+		once, err := engine.Call(args[0], args[1])
+		if err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		twice, err := engine.Call(args[0], once)
+		if err != nil {
+			return &object.Error{Message: err.Error()}
+		}
+		return twice
+	})
+
+	_, err := r.Run(`let add = fn(a, b) { a + b }; let inc = fn(x) { twice(fn(y) { y + 1 }, x) };`)
+	if err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	add, _ := r.Get("add")
+	result, err := r.Call(add, &object.Integer{Value: 1}, &object.Integer{Value: 2})
+	if err != nil {
+		t.Fatalf("Call failed: %s", err)
+	}
+	testInteger(t, result, 3)
+
+	inc, _ := r.Get("inc")
+	result, err = r.Call(inc, &object.Integer{Value: 5})
+	if err != nil {
+		t.Fatalf("Call failed: %s", err)
+	}
+	testInteger(t, result, 7)
+
+	_, err = r.Call(add, &object.Integer{Value: 1})
+	if err == nil || !strings.Contains(err.Error(), "wrong number of arguments: want=2, got=1") {
+		t.Errorf("expected arity error, got %v", err)
+	}
+}
+
+func testInteger(t *testing.T, obj object.Object, expected int64) {
+	t.Helper()
+
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Fatalf("object is not Integer. got=%T (%+v)", obj, obj)
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+}
@@ -0,0 +1,114 @@
+package turtle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"turtle/evaluator"
+	"turtle/lexer"
+	"turtle/object"
+	"turtle/parser"
+)
+
+func TestSlices(t *testing.T) {
+	tests := []engineTest{
+		{`let arr = [1, 2, 3, 4, 5]; arr[1:3]`, "[2, 3]"},
+		{`let arr = [1, 2, 3, 4, 5]; arr[:-1]`, "[1, 2, 3, 4]"},
+		{`let arr = [1, 2, 3, 4, 5]; arr[-2:]`, "[4, 5]"},
+		{`let arr = [1, 2, 3]; arr[:]`, "[1, 2, 3]"},
+		{`[1, 2, 3][2:1]`, "[]"},
+		{`[1, 2, 3][-10:10]`, "[1, 2, 3]"},
+		{`let s = "turtle"; s[2:]`, "rtle"},
+		{`"turtle"[:3]`, "tur"},
+		{`"häh!"[1:3]`, "äh"},
+		{`"abc"[-1]`, "c"},
+		{`[1, 2, 3][-1]`, "3"},
+		{`[1, 2, 3][-4]`, "null"},
+		{`let xs = [1, 2, 3]; let ys = xs[:]; push(ys, 4); xs`, "[1, 2, 3]"},
+		{`let f = fn(xs) { if (len(xs) == 0) { 0 } else { xs[0] + f(xs[1:]) } }; f([1, 2, 3, 4])`, "10"},
+	}
+
+	testEngines(t, tests)
+}
+
+func TestRanges(t *testing.T) {
+	tests := []engineTest{
+		{`1..5`, "[1, 2, 3, 4]"},
+		{`1..=5`, "[1, 2, 3, 4, 5]"},
+		{`0..0`, "[]"},
+		{`0..=0`, "[0]"},
+		{`5..1`, "[]"},
+		{`-2..1`, "[-2, -1, 0]"},
+		{`let n = 3; 1..n + 1`, "[1, 2, 3]"},
+		{`map(1..=3, fn(x) { x * x })`, "[1, 4, 9]"},
+		{`reduce(1..=10, fn(acc, x) { acc + x }, 0)`, "55"},
+		{`len(0..100)`, "100"},
+		{`(1..10)[-1]`, "9"},
+		{`filter(1..10, fn(x) { x / 2 * 2 == x })`, "[2, 4, 6, 8]"},
+	}
+
+	testEngines(t, tests)
+}
+
+func TestSliceAndRangeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`5[1:]`, "slice operator not supported: INTEGER"},
+		{`[1, 2]["a":]`, "slice bounds must be INTEGER, got STRING"},
+		{`{"a": 1}[:1]`, "slice operator not supported: HASH"},
+		{`1.."a"`, "range bounds must be INTEGER, got STRING"},
+		{`[1]..2`, "range bounds must be INTEGER, got ARRAY"},
+		{`0..9223372036854775807`, "range 0..9223372036854775807 is too long"},
+	}
+
+	for _, tt := range tests {
+		_, err := NewRuntime().Run(tt.input)
+		if err == nil || !strings.HasSuffix(err.Error(), tt.expected) {
+			t.Errorf("%q: wrong vm error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+
+		result := evaluate(t, tt.input)
+		if result != "ERROR: "+tt.expected {
+			t.Errorf("%q: wrong evaluator result. want=%q, got=%q", tt.input, tt.expected, result)
+		}
+	}
+}
+
+func TestRangeLimits(t *testing.T) {
+	limits := object.Limits{MaxAllocations: 1000}
+
+	tests := []struct {
+		input    string
+		expected error
+	}{
+		{`len(0..500)`, nil},
+		{`len(0..20000000)`, object.ErrAllocationLimit},
+		{`len(0..=20000000)`, object.ErrAllocationLimit},
+		{`try { len(0..20000000) } catch (e) { 0 }`, object.ErrAllocationLimit},
+	}
+
+	for _, tt := range tests {
+		runtime := NewRuntime()
+		runtime.SetLimits(limits)
+		_, err := runtime.Run(tt.input)
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%q: wrong vm error. want=%v, got=%v", tt.input, tt.expected, err)
+		}
+
+		p := parser.New(lexer.New(tt.input))
+		evaluated := evaluator.EvalContext(context.Background(), p.ParseProgram(), object.NewEnvironment(), limits)
+		err = nil
+		if errObj, ok := evaluated.(*object.Error); ok {
+			err = errObj.Err
+			if err == nil {
+				err = errors.New(errObj.Message)
+			}
+		}
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%q: wrong evaluator error. want=%v, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
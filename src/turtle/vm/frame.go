@@ -9,6 +9,9 @@ type Frame struct {
 	cl          *object.Closure
 	ip          int
 	basePointer int
+
+	// generator is the generator this is the frame of, if any.
+	generator *Generator
 }
 
 func NewFrame(cl *object.Closure, basePointer int) *Frame {
@@ -0,0 +1,228 @@
+package vm
+
+import (
+	"context"
+	"fmt"
+	"turtle/code"
+	"turtle/object"
+)
+
+// Generator is what calling a generator function returns. It holds the
+// frame of the call while it is suspended, together with the part of the
+// stack the frame owns, and each call to Next pushes the frame back onto
+// the frame stack of the VM until the function yields or returns. It can
+// only be resumed while that VM is around: once the Instance it belongs to
+// is released, Next fails.
+type Generator struct {
+	vm    *VM
+	frame *Frame
+	// stack holds the locals and operands of frame while it's suspended.
+	stack []object.Object
+	// handlers are the try blocks frame is in, with sp relative to its
+	// base pointer.
+	handlers []handler
+
+	// delegate is the iterator a yield ...x is taking values from. If frame
+	// is nil, the generator ended by handing itself over to it.
+	delegate object.Iterator
+
+	running bool
+	yielded bool
+	done    bool
+}
+
+func (g *Generator) Type() object.ObjectType { return object.ITERATOR_OBJ }
+func (g *Generator) Inspect() string         { return "generator" }
+
+// Next resumes the generator until it yields a value. Values of delegates
+// are passed on without resuming it.
+func (g *Generator) Next(engine object.Engine) (object.Object, bool, error) {
+	for {
+		if g.done {
+			return nil, true, nil
+		}
+		if g.running {
+			return nil, true, fmt.Errorf("generator is already running")
+		}
+
+		if g.delegate != nil {
+			g.running = true
+			value, done, err := g.delegate.Next(engine)
+			g.running = false
+			if err != nil {
+				g.finish()
+				return nil, true, err
+			}
+			if !done {
+				return value, false, nil
+			}
+
+			g.delegate = nil
+			if g.frame == nil {
+				g.finish()
+			}
+			continue
+		}
+
+		value, err := g.vm.resume(g)
+		if err != nil {
+			return nil, true, err
+		}
+		if g.yielded {
+			g.yielded = false
+			return value, false, nil
+		}
+		// the frame returned or handed over to a delegate
+	}
+}
+
+// handOver makes g produce what it produces from now on, as a generator
+// does once it reaches a yield ...it with nothing left to do after. If it
+// is another generator, g takes over its frame instead of asking it for
+// each value, so generators that recurse that way run in constant space.
+func (g *Generator) handOver(it object.Iterator) {
+	g.frame, g.stack, g.handlers = nil, nil, nil
+	g.delegate = it
+
+	other, ok := it.(*Generator)
+	if !ok || other.vm != g.vm {
+		return
+	}
+
+	g.frame, g.stack, g.handlers = other.frame, other.stack, other.handlers
+	g.delegate, g.done = other.delegate, other.done
+	if g.frame != nil {
+		g.frame.generator = g
+	}
+
+	// whoever else holds other now gets its values from g
+	other.frame, other.stack, other.handlers = nil, nil, nil
+	other.delegate = g
+}
+
+func (g *Generator) finish() {
+	g.frame, g.stack, g.handlers, g.delegate = nil, nil, nil, nil
+	g.done = true
+}
+
+// newGenerator pops the generator function cl and its numArgs bound
+// arguments off the stack and pushes a generator for the call instead.
+func (vm *VM) newGenerator(cl *object.Closure, numArgs int) error {
+	err := vm.budget.Allocate()
+	if err != nil {
+		return err
+	}
+
+	base := vm.sp - numArgs
+	g := &Generator{vm: vm, stack: make([]object.Object, cl.Fn.NumLocals)}
+	copy(g.stack, vm.stack[base:vm.sp])
+	g.frame = NewFrame(cl, 0)
+	g.frame.generator = g
+
+	vm.sp = base - 1
+	return vm.push(g)
+}
+
+// resume runs the frame of g until it yields or returns, and returns the
+// value it yielded, if any. Like Call, it can be called by the host once
+// Run has returned and by builtins while the program is running.
+func (vm *VM) resume(g *Generator) (object.Object, error) {
+	if vm.released {
+		g.finish()
+		return nil, fmt.Errorf("generator outlived the instance that created it")
+	}
+	if vm.calls == 0 {
+		vm.budget = object.NewBudget(context.Background(), vm.limits)
+	}
+
+	sp, depth := vm.sp, vm.framesIndex
+	if depth >= MaxFrames || sp+1+len(g.stack) >= StackSize {
+		g.finish()
+		return nil, fmt.Errorf("stack overflow")
+	}
+
+	// the generator sits where the callee of a call would, which is where
+	// a return leaves its value
+	vm.stack[sp] = g
+	base := sp + 1
+	copy(vm.stack[base:], g.stack)
+	vm.sp = base + len(g.stack)
+
+	g.frame.basePointer = base
+	vm.pushFrame(g.frame)
+	for _, h := range g.handlers {
+		vm.handlers = append(vm.handlers, handler{frame: vm.framesIndex, sp: base + h.sp, ip: h.ip})
+	}
+	g.handlers = nil
+
+	g.running = true
+	err := vm.execute(depth)
+	if err != nil {
+		vm.sp, vm.framesIndex = sp, depth
+		g.running = false
+		g.finish()
+		if vm.calls > 0 && vm.callErr == nil {
+			vm.callErr = err
+		}
+		return nil, err
+	}
+
+	value := vm.pop()
+	if g.running {
+		// the frame returned rather than yielded
+		g.running = false
+		g.finish()
+	}
+	return value, nil
+}
+
+// suspend takes the frame of g, the current one, off the frame stack and
+// keeps what it owns of the stack and the try blocks in g until it is
+// resumed. The yield suspending it then evaluates to null.
+func (vm *VM) suspend(g *Generator) {
+	frame := vm.popFrame()
+	bp := frame.basePointer
+
+	g.stack = append(append(g.stack[:0], vm.stack[bp:vm.sp]...), Null)
+
+	n := len(vm.handlers)
+	for n > 0 && vm.handlers[n-1].frame > vm.framesIndex {
+		n--
+	}
+	for _, h := range vm.handlers[n:] {
+		g.handlers = append(g.handlers, handler{sp: h.sp - bp, ip: h.ip})
+	}
+	vm.handlers = vm.handlers[:n]
+
+	vm.sp = bp - 1
+	g.running = false
+}
+
+// executeYield suspends the generator running in the current frame. How
+// depends on mode, one of the code.Yield operands of OpYield.
+func (vm *VM) executeYield(mode int) error {
+	value := vm.pop()
+	g := vm.currentFrame().generator
+
+	if mode == code.YieldValue {
+		vm.suspend(g)
+		g.yielded = true
+		return vm.push(value)
+	}
+
+	it, err := object.Iter(value)
+	if err != nil {
+		return fmt.Errorf("can't yield from %s", value.Type())
+	}
+	if other, ok := it.(*Generator); ok && other.running {
+		return fmt.Errorf("generator is already running")
+	}
+
+	vm.suspend(g)
+	if mode == code.YieldTail {
+		g.handOver(it)
+	} else {
+		g.delegate = it
+	}
+	return vm.push(Null)
+}
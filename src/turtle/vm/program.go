@@ -0,0 +1,129 @@
+package vm
+
+import (
+	"sync"
+	"turtle/code"
+	"turtle/compiler"
+	"turtle/object"
+)
+
+// Program is compiled bytecode that can be run any number of times, from
+// any number of goroutines at once. Running a program never modifies it:
+// every run gets its own Instance with its own stack, frames and globals.
+type Program struct {
+	instructions code.Instructions
+	constants    []object.Object
+	builtins     []*object.Builtin
+	numGlobals   int
+}
+
+// NewProgram takes a copy of bytecode, so later changes to the compiler's
+// constant pool don't affect the program.
+func NewProgram(bytecode *compiler.Bytecode) *Program {
+	return NewProgramWithBuiltins(bytecode, defaultBuiltins)
+}
+
+// NewProgramWithBuiltins is like NewProgram but resolves OpGetBuiltin
+// against builtins, as NewWithBuiltins does.
+func NewProgramWithBuiltins(bytecode *compiler.Bytecode, builtins []*object.Builtin) *Program {
+	instructions := make(code.Instructions, len(bytecode.Instructions))
+	copy(instructions, bytecode.Instructions)
+
+	constants := make([]object.Object, len(bytecode.Constants))
+	copy(constants, bytecode.Constants)
+
+	p := &Program{
+		instructions: instructions,
+		constants:    constants,
+		builtins:     builtins,
+	}
+
+	p.numGlobals = countGlobals(instructions)
+	for _, constant := range constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			if n := countGlobals(fn.Instructions); n > p.numGlobals {
+				p.numGlobals = n
+			}
+		}
+	}
+
+	return p
+}
+
+// countGlobals returns one more than the highest global index used by ins.
+func countGlobals(ins code.Instructions) int {
+	count := 0
+
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return count
+		}
+
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		switch code.Opcode(ins[i]) {
+		case code.OpGetGlobal, code.OpSetGlobal, code.OpCallGlobal:
+			if operands[0]+1 > count {
+				count = operands[0] + 1
+			}
+		}
+
+		i += 1 + read
+	}
+
+	return count
+}
+
+// Instance is a single run of a Program. It is cheap to create: its stack
+// and frames come from a pool and go back to it on Release, and its globals
+// are sized to what the program uses. An Instance must not be shared
+// between goroutines.
+type Instance struct {
+	*VM
+
+	space *stackSpace
+}
+
+type stackSpace struct {
+	stack  []object.Object
+	frames []*Frame
+}
+
+var stackPool = sync.Pool{
+	New: func() interface{} {
+		return &stackSpace{
+			stack:  make([]object.Object, StackSize),
+			frames: make([]*Frame, MaxFrames),
+		}
+	},
+}
+
+func (p *Program) NewInstance() *Instance {
+	space := stackPool.Get().(*stackSpace)
+
+	vm := newVM(p.instructions, p.constants, space.stack,
+		make([]object.Object, p.numGlobals), space.frames)
+	vm.builtins = p.builtins
+
+	return &Instance{VM: vm, space: space}
+}
+
+// Release returns the instance's stack to the pool. The instance, and the
+// value of LastPoppedStackElem, must not be used afterwards. Generators the
+// instance created stop working: their frames ran on the stack that is
+// given back, so advancing one fails with an error instead.
+func (i *Instance) Release() {
+	if i.space == nil {
+		return
+	}
+
+	i.VM.stack, i.VM.frames = nil, nil
+	i.VM.released = true
+
+	clear(i.space.stack)
+	clear(i.space.frames)
+	stackPool.Put(i.space)
+
+	i.space = nil
+	i.VM = nil
+}
@@ -0,0 +1,138 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"turtle/compiler"
+	"turtle/object"
+)
+
+func TestProgramConcurrentInstances(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`
+	let fibonacci = fn(x) {
+		if (x < 2) { x } else { fibonacci(x - 1) + fibonacci(x - 2) }
+	};
+	let counter = 0;
+	let result = fibonacci(15);
+	puts(result);
+	[counter, result]
+	`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	program := NewProgram(comp.Bytecode())
+
+	const runs = 32
+	var wg sync.WaitGroup
+	outputs := make([]bytes.Buffer, runs)
+	errs := make([]error, runs)
+
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			instance := program.NewInstance()
+			defer instance.Release()
+
+			instance.SetHost(object.NewHost(strings.NewReader(""), &outputs[i], &outputs[i]))
+			err := instance.Run()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			result := instance.LastPoppedStackElem().Inspect()
+			if result != "[0, 610]" {
+				errs[i] = fmt.Errorf("wrong result %s", result)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < runs; i++ {
+		if errs[i] != nil {
+			t.Errorf("run %d failed: %s", i, errs[i])
+		}
+		if outputs[i].String() != "610\n" {
+			t.Errorf("run %d printed %q", i, outputs[i].String())
+		}
+	}
+}
+
+func TestProgramInstancesDoNotShareState(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`let a = 1; let b = a + 1; b`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+	program := NewProgram(bytecode)
+
+	// changing the compiler's output afterwards must not affect the program
+	bytecode.Constants[0] = &object.Integer{Value: 100}
+
+	for i := 0; i < 3; i++ {
+		instance := program.NewInstance()
+		if len(instance.globals) != 2 {
+			t.Fatalf("wrong number of globals. want=2, got=%d", len(instance.globals))
+		}
+
+		err := instance.Run()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		err = testIntegerObject(2, instance.LastPoppedStackElem())
+		if err != nil {
+			t.Errorf("run %d: %s", i, err)
+		}
+		instance.Release()
+	}
+}
+
+func TestGeneratorAfterRelease(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`let g = fn() { yield 1; yield 2 }; g()`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	program := NewProgram(comp.Bytecode())
+
+	instance := program.NewInstance()
+	err = instance.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	g, ok := instance.LastPoppedStackElem().(*Generator)
+	if !ok {
+		t.Fatalf("object is not Generator. got=%T", instance.LastPoppedStackElem())
+	}
+
+	value, done, err := g.Next(instance.VM)
+	if err != nil || done {
+		t.Fatalf("wrong first step. got=%v, %t, %v", value, done, err)
+	}
+	if err := testIntegerObject(1, value); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := instance.VM
+	instance.Release()
+
+	// another instance may have taken the stack the generator ran on
+	other := program.NewInstance()
+	defer other.Release()
+
+	_, done, err = g.Next(engine)
+	if err == nil || err.Error() != "generator outlived the instance that created it" || !done {
+		t.Fatalf("expected the generator to fail once released, got done=%t, err=%v", done, err)
+	}
+	_, done, err = g.Next(engine)
+	if err != nil || !done {
+		t.Fatalf("expected the generator to stay done, got done=%t, err=%v", done, err)
+	}
+}
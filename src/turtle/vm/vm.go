@@ -1,7 +1,9 @@
 package vm
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"turtle/code"
 	"turtle/compiler"
 	"turtle/object"
@@ -9,11 +11,11 @@ import (
 
 const StackSize = 2048
 const GlobalSize = 65536
-const MaxFrames = 1024
+const MaxFrames = object.MaxCallDepth
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
-var Null = &object.Null{}
+var True = object.True
+var False = object.False
+var Null = object.NULL
 
 type VM struct {
 	constants []object.Object
@@ -23,22 +25,62 @@ type VM struct {
 
 	globals []object.Object
 
+	// builtins is indexed by the operand of OpGetBuiltin.
+	builtins []*object.Builtin
+	host     *object.Host
+
+	limits object.Limits
+	budget *object.Budget
+
+	// calls counts the nested executions of the instruction loop, which
+	// is more than one while a builtin calls back into a closure.
+	calls int
+	// callErr is the error of a callback that failed inside a builtin.
+	callErr error
+
 	frames      []*Frame
 	framesIndex int
+
+	// handlers are the try blocks being run, innermost last.
+	handlers []handler
+
+	// released is set once the Instance the VM runs has given its stack
+	// and frames back to the pool.
+	released bool
+}
+
+// handler is where to carry on when a try block throws: the frame of the
+// block, the height its stack had when the block started, and the start of
+// the code that handles the exception.
+type handler struct {
+	frame int
+	sp    int
+	ip    int
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	return newVM(
+		bytecode.Instructions,
+		bytecode.Constants,
+		make([]object.Object, StackSize),
+		make([]object.Object, GlobalSize),
+		make([]*Frame, MaxFrames),
+	)
+}
+
+func newVM(instructions code.Instructions, constants []object.Object,
+	stack, globals []object.Object, frames []*Frame) *VM {
+	mainFn := &object.CompiledFunction{Instructions: instructions}
 	mainClosure := &object.Closure{Fn: mainFn}
-	mainFrame := NewFrame(mainClosure, 0)
+	frames[0] = NewFrame(mainClosure, 0)
 
-	frames := make([]*Frame, MaxFrames)
-	frames[0] = mainFrame
 	return &VM{
-		constants:   bytecode.Constants,
-		stack:       make([]object.Object, StackSize),
+		constants:   constants,
+		stack:       stack,
 		sp:          0,
-		globals:     make([]object.Object, GlobalSize),
+		globals:     globals,
+		builtins:    defaultBuiltins,
+		host:        object.DefaultHost(),
 		frames:      frames,
 		framesIndex: 1,
 	}
@@ -50,6 +92,39 @@ func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
 	return vm
 }
 
+// NewWithBuiltins is like NewWithGlobalsStore but resolves OpGetBuiltin
+// against builtins instead of object.Builtins. The compiler must have been
+// given a symbol table defining the same builtins at the same indexes.
+func NewWithBuiltins(bytecode *compiler.Bytecode, s []object.Object, builtins []*object.Builtin) *VM {
+	vm := NewWithGlobalsStore(bytecode, s)
+	vm.builtins = builtins
+	return vm
+}
+
+var defaultBuiltins = func() []*object.Builtin {
+	builtins := make([]*object.Builtin, len(object.Builtins))
+	for i, def := range object.Builtins {
+		builtins[i] = def.Builtin
+	}
+	return builtins
+}()
+
+// SetHost sets the host builtins run by vm read from and write to.
+func (vm *VM) SetHost(host *object.Host) {
+	vm.host = host
+}
+
+// SetLimits bounds the instructions and allocations of the next run.
+func (vm *VM) SetLimits(limits object.Limits) {
+	vm.limits = limits
+}
+
+// Budget reports what the last run used, or what the running program has
+// used so far when a builtin asks.
+func (vm *VM) Budget() *object.Budget {
+	return vm.budget
+}
+
 func (vm *VM) StackTop() object.Object {
 	if vm.sp == 0 {
 		return nil
@@ -58,11 +133,134 @@ func (vm *VM) StackTop() object.Object {
 }
 
 func (vm *VM) Run() error {
+	return vm.RunContext(context.Background())
+}
+
+// RunContext runs the program until it finishes, ctx is done or a limit set
+// with SetLimits is exceeded. The errors for the last two wrap ctx.Err(),
+// object.ErrInstructionLimit or object.ErrAllocationLimit.
+func (vm *VM) RunContext(ctx context.Context) error {
+	vm.budget = object.NewBudget(ctx, vm.limits)
+	vm.handlers = vm.handlers[:0]
+	return vm.execute(0)
+}
+
+// Host returns the host builtins run by vm read from and write to.
+func (vm *VM) Host() *object.Host {
+	return vm.host
+}
+
+// Call applies fn, a closure or builtin, to args and runs it to completion.
+// It can be called by the host once Run has returned, and by builtins while
+// the program is running, in which case the call counts against the limits
+// of the run and a runtime error inside fn stops the whole program even if
+// the builtin ignores it.
+func (vm *VM) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	if vm.calls == 0 {
+		vm.budget = object.NewBudget(context.Background(), vm.limits)
+	}
+
+	sp, depth := vm.sp, vm.framesIndex
+
+	result, err := vm.call(fn, args)
+	if err != nil {
+		vm.sp, vm.framesIndex = sp, depth
+		if vm.calls > 0 && vm.callErr == nil {
+			vm.callErr = err
+		}
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (vm *VM) call(fn object.Object, args []object.Object) (object.Object, error) {
+	depth := vm.framesIndex
+
+	err := vm.push(fn)
+	if err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		err := vm.push(arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = vm.executeClosure(len(args), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if vm.framesIndex > depth {
+		err = vm.execute(depth)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return vm.pop(), nil
+}
+
+// execute runs instructions until the frame stack shrinks to stopDepth
+// frames or the outermost frame runs out of instructions. An error raised
+// above stopDepth goes to the innermost handler there, if any.
+func (vm *VM) execute(stopDepth int) error {
+	vm.calls++
+	defer func() { vm.calls-- }()
+
+	for {
+		err := vm.run(stopDepth)
+		if err == nil || !vm.handle(err, stopDepth) {
+			return err
+		}
+	}
+}
+
+// handle unwinds the frames and the stack to the innermost handler above
+// stopDepth and pushes err as an error object, which OpThrow raises again
+// unchanged and OpCatch turns into what a catch binds. It reports false if
+// there is no such handler or err can't be caught, in which case the
+// handlers above stopDepth are dropped with the frames the error leaves.
+func (vm *VM) handle(err error, stopDepth int) bool {
+	n := len(vm.handlers)
+	if n == 0 || vm.handlers[n-1].frame <= stopDepth || !object.Catchable(err) {
+		vm.dropHandlers(stopDepth)
+		return false
+	}
+
+	h := vm.handlers[n-1]
+	vm.handlers = vm.handlers[:n-1]
+
+	vm.framesIndex = h.frame
+	vm.sp = h.sp
+	vm.currentFrame().ip = h.ip - 1
+
+	return vm.push(&object.Error{Message: err.Error(), Err: err}) == nil
+}
+
+// dropHandlers forgets the handlers of the frames above depth.
+func (vm *VM) dropHandlers(depth int) {
+	n := len(vm.handlers)
+	for n > 0 && vm.handlers[n-1].frame > depth {
+		n--
+	}
+	vm.handlers = vm.handlers[:n]
+}
+
+// run is the instruction loop of execute.
+func (vm *VM) run(stopDepth int) error {
 	var ip int
 	var ins code.Instructions
 	var op code.Opcode
 
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+	for vm.framesIndex > stopDepth && vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		err := vm.budget.Step()
+		if err != nil {
+			return err
+		}
+
 		// fetch
 		vm.currentFrame().ip++
 
@@ -88,7 +286,7 @@ func (vm *VM) Run() error {
 				return err
 			}
 
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
 			err := vm.executeComparison(op)
 			if err != nil {
 				return err
@@ -126,6 +324,12 @@ func (vm *VM) Run() error {
 		case code.OpPop:
 			vm.pop()
 
+		case code.OpDup:
+			err := vm.push(vm.StackTop())
+			if err != nil {
+				return err
+			}
+
 		case code.OpJumpNotTruthy:
 			pos := int(code.ReadUint16(ins[ip+1:]))
 
@@ -173,14 +377,44 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpGetLocal0:
+			err := vm.push(vm.stack[vm.currentFrame().basePointer])
+			if err != nil {
+				return err
+			}
+
+		case code.OpAddConst, code.OpSubConst:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.executeConstOperation(op, vm.constants[constIndex])
+			if err != nil {
+				return err
+			}
+
+		case code.OpEqualJump, code.OpNotEqualJump, code.OpGreaterThanJump, code.OpLessThanJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			holds, err := vm.executeCompareJump(op)
+			if err != nil {
+				return err
+			}
+			if !holds {
+				vm.currentFrame().ip = pos - 1
+			}
+
 		case code.OpArray:
 			noElements := int(code.ReadUint16(ins[ip+1:]))
 			vm.currentFrame().ip += 2
 
-			array := vm.buildArray(vm.sp-noElements, vm.sp)
+			array, err := vm.buildArray(vm.sp-noElements, vm.sp)
 			vm.sp = vm.sp - noElements
+			if err != nil {
+				return err
+			}
 
-			err := vm.push(array)
+			err = vm.push(array)
 			if err != nil {
 				return err
 			}
@@ -213,7 +447,51 @@ func (vm *VM) Run() error {
 			numArgs := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 
-			err := vm.executeClosure(int(numArgs))
+			err := vm.executeClosure(int(numArgs), nil)
+			if err != nil {
+				return err
+			}
+
+		case code.OpCallKeywords:
+			numArgs := int(code.ReadUint8(ins[ip+1:]))
+			namesIndex := code.ReadUint16(ins[ip+2:])
+			vm.currentFrame().ip += 3
+
+			keywords := []string{}
+			for _, name := range vm.constants[namesIndex].(*object.Array).Elements {
+				keywords = append(keywords, name.(*object.String).Value)
+			}
+
+			err := vm.executeClosure(numArgs, keywords)
+			if err != nil {
+				return err
+			}
+
+		case code.OpJumpPassed:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			localIndex := int(code.ReadUint8(ins[ip+3:]))
+			vm.currentFrame().ip += 3
+
+			frame := vm.currentFrame()
+			if vm.stack[frame.basePointer+localIndex] != nil {
+				frame.ip = pos - 1
+			}
+
+		case code.OpCallGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			numArgs := int(code.ReadUint8(ins[ip+3:]))
+			vm.currentFrame().ip += 3
+
+			// the arguments are already on the stack; slide them up to make
+			// room for the callee below them, where OpCall expects it
+			if vm.sp >= StackSize {
+				return fmt.Errorf("stack overflow")
+			}
+			copy(vm.stack[vm.sp-numArgs+1:vm.sp+1], vm.stack[vm.sp-numArgs:vm.sp])
+			vm.stack[vm.sp-numArgs] = vm.globals[globalIndex]
+			vm.sp++
+
+			err := vm.executeClosure(numArgs, nil)
 			if err != nil {
 				return err
 			}
@@ -223,6 +501,9 @@ func (vm *VM) Run() error {
 
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1
+			if len(vm.handlers) > 0 {
+				vm.dropHandlers(vm.framesIndex)
+			}
 
 			err := vm.push(returnValue)
 			if err != nil {
@@ -232,18 +513,138 @@ func (vm *VM) Run() error {
 		case code.OpReturn:
 			frame := vm.popFrame()
 			vm.sp = frame.basePointer - 1
+			if len(vm.handlers) > 0 {
+				vm.dropHandlers(vm.framesIndex)
+			}
 
 			err := vm.push(Null)
 			if err != nil {
 				return err
 			}
+		case code.OpTry:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			vm.handlers = append(vm.handlers, handler{frame: vm.framesIndex, sp: vm.sp, ip: pos})
+
+		case code.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		case code.OpThrow:
+			return object.Throw(vm.pop())
+
+		case code.OpCatch:
+			exception := vm.pop().(*object.Error)
+			err := vm.push(object.Caught(exception.Err))
+			if err != nil {
+				return err
+			}
+
+		case code.OpMatchValue:
+			literal := vm.pop()
+			value := vm.pop()
+
+			err := vm.push(nativeBoolToBooleanObject(object.MatchesLiteral(value, literal)))
+			if err != nil {
+				return err
+			}
+
+		case code.OpMatchArray:
+			length := int(code.ReadUint16(ins[ip+1:]))
+			rest := code.ReadUint8(ins[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			err := vm.push(nativeBoolToBooleanObject(object.MatchesArray(vm.pop(), length, rest)))
+			if err != nil {
+				return err
+			}
+
+		case code.OpMatchHash:
+			numKeys := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			keys := vm.stack[vm.sp-numKeys : vm.sp]
+			matched := object.MatchesHash(vm.stack[vm.sp-numKeys-1], keys)
+			vm.sp -= numKeys + 1
+
+			err := vm.push(nativeBoolToBooleanObject(matched))
+			if err != nil {
+				return err
+			}
+
+		case code.OpSlice:
+			high := vm.pop()
+			low := vm.pop()
+			left := vm.pop()
+
+			err := vm.executeSliceExpression(left, low, high)
+			if err != nil {
+				return err
+			}
+
+		case code.OpRange:
+			inclusive := code.ReadUint8(ins[ip+1:]) == 1
+			vm.currentFrame().ip += 1
+
+			end := vm.pop()
+			start := vm.pop()
+
+			array, err := object.RangeOf(start, end, inclusive, vm.budget)
+			if err != nil {
+				return err
+			}
+
+			err = vm.budget.Allocate()
+			if err != nil {
+				return err
+			}
+
+			err = vm.push(array)
+			if err != nil {
+				return err
+			}
+
+		case code.OpConcat:
+			numParts := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			err := vm.budget.Allocate()
+			if err != nil {
+				return err
+			}
+
+			var out strings.Builder
+			for _, part := range vm.stack[vm.sp-numParts : vm.sp] {
+				out.WriteString(part.Inspect())
+			}
+			vm.sp -= numParts
+
+			err = vm.push(&object.String{Value: out.String()})
+			if err != nil {
+				return err
+			}
+
+		case code.OpYield:
+			mode := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			err := vm.executeYield(mode)
+			if err != nil {
+				return err
+			}
+
+		case code.OpMismatch:
+			patternIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			pattern := vm.constants[patternIndex].(*object.String)
+			return fmt.Errorf("can't destructure %s into %s", vm.pop().Inspect(), pattern.Value)
+
 		case code.OpGetBuiltin:
 			builtinIndex := code.ReadUint8(ins[ip+1:])
 			vm.currentFrame().ip += 1
 
-			definition := object.Builtins[builtinIndex]
-
-			err := vm.push(definition.Builtin)
+			err := vm.push(vm.builtins[builtinIndex])
 			if err != nil {
 				return err
 			}
@@ -279,6 +680,11 @@ func (vm *VM) Run() error {
 }
 
 func (vm *VM) pushClosure(constIndex int, numFree int) error {
+	err := vm.budget.Allocate()
+	if err != nil {
+		return err
+	}
+
 	constant := vm.constants[constIndex]
 	function, ok := constant.(*object.CompiledFunction)
 	if !ok {
@@ -295,12 +701,18 @@ func (vm *VM) pushClosure(constIndex int, numFree int) error {
 	return vm.push(closure)
 }
 
-func (vm *VM) executeClosure(numArgs int) error {
+// executeClosure calls the function below the numArgs arguments on top of
+// the stack, the last len(keywords) of which are keyword arguments with
+// those names.
+func (vm *VM) executeClosure(numArgs int, keywords []string) error {
 	callee := vm.stack[vm.sp-1-numArgs]
 	switch callee := callee.(type) {
 	case *object.Closure:
-		return vm.callClosure(callee, numArgs)
+		return vm.callClosure(callee, numArgs, keywords)
 	case *object.Builtin:
+		if len(keywords) > 0 {
+			return fmt.Errorf("builtin functions don't take keyword arguments")
+		}
 		return vm.callBuiltin(callee, numArgs)
 	default:
 		return fmt.Errorf("calling non-function and non-built-in")
@@ -308,10 +720,38 @@ func (vm *VM) executeClosure(numArgs int) error {
 }
 
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	err := vm.budget.Allocate()
+	if err != nil {
+		return err
+	}
+
 	args := vm.stack[vm.sp-numArgs : vm.sp]
-	result := builtin.Fn(args...)
+	result := builtin.Fn(vm, args...)
 	vm.sp = vm.sp - numArgs - 1
 
+	// a closure the builtin called back into failed
+	if vm.callErr != nil {
+		err, vm.callErr = vm.callErr, nil
+		return err
+	}
+
+	if exit, ok := object.AsExit(result); ok {
+		return exit
+	}
+
+	if errObj, ok := result.(*object.Error); ok {
+		// running out of budget stops the program wherever it happens
+		if !object.Catchable(errObj.Err) {
+			return errObj.Err
+		}
+		// error values only become exceptions inside a try of the function
+		// calling the builtin, so programs that look at what builtins
+		// return keep working, whoever calls them
+		if vm.inTry() {
+			return object.Throw(errObj)
+		}
+	}
+
 	if result != nil {
 		vm.push(result)
 	} else {
@@ -321,9 +761,38 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	return nil
 }
 
-func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
-	if numArgs != cl.Fn.NumParameters {
-		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+// inTry reports whether the current frame is running a try block.
+func (vm *VM) inTry() bool {
+	n := len(vm.handlers)
+	return n > 0 && vm.handlers[n-1].frame == vm.framesIndex
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int, keywords []string) error {
+	fn := cl.Fn
+	if numArgs != fn.NumParameters || fn.Rest || len(keywords) > 0 {
+		if fn.NumDefaults == 0 && !fn.Rest && len(keywords) == 0 {
+			return fmt.Errorf("wrong number of arguments: want=%d, got=%d", fn.NumParameters, numArgs)
+		}
+
+		err := vm.bindArguments(fn, numArgs, keywords)
+		if err != nil {
+			return err
+		}
+		numArgs = fn.NumParameters
+		if fn.Rest {
+			numArgs++
+		}
+	}
+	if fn.Generator {
+		return vm.newGenerator(cl, numArgs)
+	}
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+
+	err := vm.budget.Allocate()
+	if err != nil {
+		return err
 	}
 
 	frame := NewFrame(cl, vm.sp-numArgs)
@@ -334,10 +803,30 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 	return nil
 }
 
+// bindArguments replaces the numArgs arguments on top of the stack with the
+// values of the parameters of fn, leaving nil in the slot of each parameter
+// that gets its default.
+func (vm *VM) bindArguments(fn *object.CompiledFunction, numArgs int, keywords []string) error {
+	base := vm.sp - numArgs
+	bound, err := object.BindArguments(fn.ParameterNames, fn.NumDefaults, fn.Rest, vm.stack[base:vm.sp], keywords)
+	if err != nil {
+		return err
+	}
+
+	if base+len(bound) >= StackSize {
+		return fmt.Errorf("stack overflow")
+	}
+	copy(vm.stack[base:], bound)
+	vm.sp = base + len(bound)
+	return nil
+}
+
 func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return vm.executeHashIndex(left, index)
 	default:
@@ -345,6 +834,22 @@ func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	}
 }
 
+// executeSliceExpression pushes the part of an array or string between low
+// and high, either of which may be null to leave that end open.
+func (vm *VM) executeSliceExpression(left, low, high object.Object) error {
+	slice, err := object.SliceOf(left, low, high)
+	if err != nil {
+		return err
+	}
+
+	err = vm.budget.Allocate()
+	if err != nil {
+		return err
+	}
+
+	return vm.push(slice)
+}
+
 func (vm *VM) executeHashIndex(left, index object.Object) error {
 	hashObj := left.(*object.Hash)
 	key, ok := index.(object.Hashable)
@@ -361,43 +866,64 @@ func (vm *VM) executeHashIndex(left, index object.Object) error {
 }
 
 func (vm *VM) executeArrayIndex(array, index object.Object) error {
-	arrayObject := array.(*object.Array)
-	i := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements) - 1)
+	element, ok := array.(*object.Array).At(index.(*object.Integer).Value)
+	if !ok {
+		return vm.push(Null)
+	}
+
+	return vm.push(element)
+}
 
-	if i < 0 || i > max {
+func (vm *VM) executeStringIndex(str, index object.Object) error {
+	char, ok := str.(*object.String).CharAt(index.(*object.Integer).Value)
+	if !ok {
 		return vm.push(Null)
 	}
 
-	return vm.push(arrayObject.Elements[i])
+	err := vm.budget.Allocate()
+	if err != nil {
+		return err
+	}
+
+	return vm.push(char)
 }
 
 func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
-	hashPairs := make(map[object.HashKey]object.HashPair)
+	err := vm.budget.Allocate()
+	if err != nil {
+		return nil, err
+	}
+
+	hash := object.NewHash()
 
 	for i := startIndex; i < endIndex; i += 2 {
 		key := vm.stack[i]
 		value := vm.stack[i+1]
 
-		pair := object.HashPair{Key: key, Value: value}
 		hashKey, ok := key.(object.Hashable)
 		if !ok {
 			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
 		}
-		hashPairs[hashKey.HashKey()] = pair
+		hash.Set(hashKey, value)
 	}
 
-	return &object.Hash{Pairs: hashPairs}, nil
+	return hash, nil
 }
 
-func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+func (vm *VM) buildArray(startIndex, endIndex int) (object.Object, error) {
+	err := vm.budget.Allocate()
+	if err != nil {
+		return nil, err
+	}
+
 	elements := make([]object.Object, endIndex-startIndex)
 	for i := startIndex; i < endIndex; i++ {
 		elements[i-startIndex] = vm.stack[i]
 	}
 
-	return &object.Array{Elements: elements}
+	return &object.Array{Elements: elements}, nil
 }
+
 func isTruthy(condition object.Object) bool {
 	switch obj := condition.(type) {
 	case *object.Boolean:
@@ -411,6 +937,13 @@ func isTruthy(condition object.Object) bool {
 
 func (vm *VM) executeMinusOperator() error {
 	right := vm.pop()
+	if float, ok := right.(*object.Float); ok {
+		err := vm.budget.Allocate()
+		if err != nil {
+			return err
+		}
+		return vm.push(&object.Float{Value: -float.Value})
+	}
 	if right.Type() != object.INTEGER_OBJ {
 		return fmt.Errorf("unsupported type for negatiion: %s", right.Type())
 	}
@@ -419,6 +952,10 @@ func (vm *VM) executeMinusOperator() error {
 	if rightValue == 0 {
 		return vm.push(right)
 	}
+	err := vm.budget.Allocate()
+	if err != nil {
+		return err
+	}
 	return vm.push(&object.Integer{Value: -rightValue})
 }
 
@@ -448,6 +985,13 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 		return vm.executeIntegerComparison(op, left, right)
 	}
 
+	// compare mixed numbers as floats
+	if leftValue, ok := object.FloatValue(left); ok {
+		if rightValue, ok := object.FloatValue(right); ok {
+			return vm.executeFloatComparison(op, leftValue, rightValue)
+		}
+	}
+
 	// compare boolean values
 	switch op {
 	case code.OpEqual:
@@ -477,11 +1021,92 @@ func (vm *VM) executeIntegerComparison(op code.Opcode, left object.Object, right
 		return vm.push(nativeBoolToBooleanObject(leftValue != rightValue))
 	case code.OpGreaterThan:
 		return vm.push(nativeBoolToBooleanObject(leftValue > rightValue))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(leftValue < rightValue))
 	default:
 		return fmt.Errorf("unknow operator : %d (%s %s)", op, left.Type(), right.Type())
 	}
 }
 
+func (vm *VM) executeFloatComparison(op code.Opcode, left, right float64) error {
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBoolToBooleanObject(left == right))
+	case code.OpNotEqual:
+		return vm.push(nativeBoolToBooleanObject(left != right))
+	case code.OpGreaterThan:
+		return vm.push(nativeBoolToBooleanObject(left > right))
+	case code.OpLessThan:
+		return vm.push(nativeBoolToBooleanObject(left < right))
+	default:
+		return fmt.Errorf("unknow operator : %d (%s %s)", op, object.FLOAT_OBJ, object.FLOAT_OBJ)
+	}
+}
+
+// compareJumpOps maps each compare-and-jump superinstruction back to the
+// comparison it performs.
+var compareJumpOps = map[code.Opcode]code.Opcode{
+	code.OpEqualJump:       code.OpEqual,
+	code.OpNotEqualJump:    code.OpNotEqual,
+	code.OpGreaterThanJump: code.OpGreaterThan,
+	code.OpLessThanJump:    code.OpLessThan,
+}
+
+// executeCompareJump pops two operands and reports whether the comparison
+// of a compare-and-jump instruction holds. Integers are compared in place;
+// anything else goes through executeComparison.
+func (vm *VM) executeCompareJump(op code.Opcode) (bool, error) {
+	right, rightOk := vm.stack[vm.sp-1].(*object.Integer)
+	left, leftOk := vm.stack[vm.sp-2].(*object.Integer)
+	if leftOk && rightOk {
+		vm.sp -= 2
+		switch op {
+		case code.OpEqualJump:
+			return left.Value == right.Value, nil
+		case code.OpNotEqualJump:
+			return left.Value != right.Value, nil
+		case code.OpGreaterThanJump:
+			return left.Value > right.Value, nil
+		case code.OpLessThanJump:
+			return left.Value < right.Value, nil
+		}
+	}
+
+	err := vm.executeComparison(compareJumpOps[op])
+	if err != nil {
+		return false, err
+	}
+	return isTruthy(vm.pop()), nil
+}
+
+// executeConstOperation applies OpAddConst or OpSubConst to the top of the
+// stack and a constant.
+func (vm *VM) executeConstOperation(op code.Opcode, constant object.Object) error {
+	left, leftOk := vm.stack[vm.sp-1].(*object.Integer)
+	right, rightOk := constant.(*object.Integer)
+	if leftOk && rightOk {
+		err := vm.budget.Allocate()
+		if err != nil {
+			return err
+		}
+		if op == code.OpAddConst {
+			vm.stack[vm.sp-1] = &object.Integer{Value: left.Value + right.Value}
+		} else {
+			vm.stack[vm.sp-1] = &object.Integer{Value: left.Value - right.Value}
+		}
+		return nil
+	}
+
+	err := vm.push(constant)
+	if err != nil {
+		return err
+	}
+	if op == code.OpAddConst {
+		return vm.executeBinaryOperation(code.OpAdd)
+	}
+	return vm.executeBinaryOperation(code.OpSub)
+}
+
 func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
@@ -493,6 +1118,8 @@ func (vm *VM) executeBinaryOperation(op code.Opcode) error {
 		return vm.executeBinaryIntegerOperation(op, left, right)
 	case leftType == object.STRING_OBJ && rightType == object.STRING_OBJ:
 		return vm.executeBinaryStringOperation(op, left, right)
+	case isNumber(left) && isNumber(right):
+		return vm.executeBinaryFloatOperation(op, left, right)
 	default:
 		return fmt.Errorf("unsupported types for binary operation: %s %s", leftType, rightType)
 	}
@@ -503,6 +1130,11 @@ func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Ob
 		return fmt.Errorf("unknown string operator: %d", op)
 	}
 
+	err := vm.budget.Allocate()
+	if err != nil {
+		return err
+	}
+
 	leftValue := left.(*object.String).Value
 	rightValue := right.(*object.String).Value
 
@@ -523,16 +1155,55 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 		result = leftValue * rightValue
 	case code.OpDiv:
 		if rightValue == 0 {
-			return fmt.Errorf("can't divide by 0\n")
+			return fmt.Errorf("can't divide by 0")
 		}
 		result = leftValue / rightValue
 	default:
 		return fmt.Errorf("unknow integer operation: %d", op)
 	}
 
+	err := vm.budget.Allocate()
+	if err != nil {
+		return err
+	}
 	return vm.push(&object.Integer{Value: result})
 }
 
+func isNumber(obj object.Object) bool {
+	_, ok := object.FloatValue(obj)
+	return ok
+}
+
+// executeBinaryFloatOperation handles floats, and integers mixed with
+// floats, which are converted to floats first.
+func (vm *VM) executeBinaryFloatOperation(op code.Opcode, left, right object.Object) error {
+	leftValue, _ := object.FloatValue(left)
+	rightValue, _ := object.FloatValue(right)
+	var result float64
+
+	switch op {
+	case code.OpAdd:
+		result = leftValue + rightValue
+	case code.OpSub:
+		result = leftValue - rightValue
+	case code.OpMul:
+		result = leftValue * rightValue
+	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("can't divide by 0")
+		}
+		result = leftValue / rightValue
+	default:
+		return fmt.Errorf("unknow float operation: %d", op)
+	}
+
+	err := vm.budget.Allocate()
+	if err != nil {
+		return err
+	}
+	return vm.push(&object.Float{Value: result})
+}
+
 func (vm *VM) push(obj object.Object) error {
 	if vm.sp >= StackSize {
 		return fmt.Errorf("stack overflow")
@@ -1,8 +1,11 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"testing"
+	"time"
 	"turtle/ast"
 	"turtle/compiler"
 	"turtle/lexer"
@@ -143,11 +146,17 @@ func TestIndexExpressions(t *testing.T) {
 		{"[[1, 1, 1]][0][0]", 1},
 		{"[][0]", Null},
 		{"[1, 2, 3][99]", Null},
-		{"[1][-1]", Null},
+		{"[1][-1]", 1},
+		{"[1, 2, 3][-2]", 2},
+		{"[1][-2]", Null},
 		{"{1: 1, 2: 2}[1]", 1},
 		{"{1: 1, 2: 2}[2]", 2},
 		{"{1: 1}[0]", Null},
 		{"{}[0]", Null},
+		{`"abc"[1]`, "b"},
+		{`"abc"[3]`, Null},
+		{`"abc"[-1]`, "c"},
+		{`"abc"[-4]`, Null},
 	}
 	runVmTests(t, tests)
 }
@@ -531,6 +540,395 @@ func TestRecursiveFunctions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestOptimizedPrograms(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 5; x + 1", 6},
+		{"let x = 5; x; let y = x * 2; y", 10},
+		{"if (true) { 1 } else { 2 }", 1},
+		{"if (false) { 1 } else { 2 }", 2},
+		{"if (false) { 1 }", Null},
+		{"1; 2; 3", 3},
+		{"fn() { return 1; 2; }()", 1},
+		{"fn(x) { let y = x; y }(7)", 7},
+		{"fn(x) { let y = x; y; x + y }(7)", 14},
+		{
+			input: `
+			let sign = fn(x) {
+				if (x > 0) { return 1; } else { if (x < 0) { return -1; } }
+				0
+			};
+			[sign(5), sign(-5), sign(0)]
+			`,
+			expected: []int{1, -1, 0},
+		},
+		{
+			input: `
+			let f = fn(a) {
+				let b = a;
+				let c = fn() { b };
+				if (true) { c() } else { 0 }
+			};
+			f(42)
+			`,
+			expected: 42,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSpecializedPrograms(t *testing.T) {
+	tests := []vmTestCase{
+		{"let x = 5; x + 1", 6},
+		{"let x = 5; x - 1", 4},
+		{`"a" + "b"`, "ab"},
+		{"1 < 2", true},
+		{"2 < 1", false},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (2 < 1) { 10 } else { 20 }", 20},
+		{"if (1 == 1) { 10 } else { 20 }", 10},
+		{"if (1 != 1) { 10 } else { 20 }", 20},
+		{"if (2 > 1) { 10 } else { 20 }", 10},
+		{"if (true == true) { 10 } else { 20 }", 10},
+		{"if (true != true) { 10 }", Null},
+		{"1 == if (true) { 1 } else { 2 }", true},
+		{"fn(a, b) { a - 1 + b }(5, 2)", 6},
+		{"let add = fn(a, b) { a + b }; add(1, add(2, 3))", 6},
+		{"let one = fn() { 1 }; one() + one()", 2},
+		{"let f = fn(x) { if (x < 1) { 0 } else { x + f(x - 1) } }; f(10)", 55},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLimits(t *testing.T) {
+	loop := `let loop = fn(n) { loop(n + 1) }; loop(0)`
+
+	tests := []struct {
+		input    string
+		limits   object.Limits
+		expected error
+	}{
+		{"let f = fn(x) { x }; f(1) + f(2)", object.Limits{MaxInstructions: 100, MaxAllocations: 100}, nil},
+		{"1 + 2 + 3", object.Limits{MaxInstructions: 5}, object.ErrInstructionLimit},
+		{"1 + 2 + 3", object.Limits{MaxAllocations: 1}, object.ErrAllocationLimit},
+		{"[1, 2, [3]]", object.Limits{MaxAllocations: 1}, object.ErrAllocationLimit},
+		{loop, object.Limits{MaxInstructions: 1000}, object.ErrInstructionLimit},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		vm.SetLimits(tt.limits)
+
+		err = vm.Run()
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%q: wrong error. want=%v, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`let spin = fn() { spin() }; spin()`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	vm := New(comp.Bytecode())
+	err = vm.RunContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("wrong error. want=%v, got=%v", context.Canceled, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	comp = compiler.New()
+	err = comp.Compile(parse(`let count = fn(n) { if (n > 0) { count(n - 1); count(n - 1) } }; count(100)`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm = New(comp.Bytecode())
+	err = vm.RunContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("wrong error. want=%v, got=%v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestFrameOverflow(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`let f = fn() { f() }; f()`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err = New(comp.Bytecode()).Run()
+	if err == nil || err.Error() != "stack overflow" {
+		t.Fatalf("expected stack overflow, got %v", err)
+	}
+}
+
+func TestExceptions(t *testing.T) {
+	tests := []vmTestCase{
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`try { throw 5 } catch (e) { e + 1 }`, 6},
+		{`try { 1 / 0 } catch (e) { e }`, "can't divide by 0"},
+		{`let f = fn() { throw 3 }; try { f() + 1 } catch (e) { e }`, 3},
+		{`let f = fn() { f() }; try { f() } catch (e) { e }`, "stack overflow"},
+		{`let f = fn(x) { try { x / 0 } catch (e) { x } }; f(1) + f(2)`, 3},
+		{`let f = fn() { try { return 1; } finally { 2 } }; f() + 10`, 11},
+		{`let x = 1; try { try { throw 1 } finally { let x = 5; } } catch (e) { x + e }`, 6},
+		{`let f = fn() { try { 1 } catch (e) { 2 } }; try { f(); throw 4 } catch (e) { e }`, 4},
+		{`let g = fn() { try { return 1; } catch (e) { 0 } }; g(); try { 1 / 0 } catch (e) { 7 }`, 7},
+		{`try { len(1) } catch (e) { "caught" }`, "caught"},
+		{`let f = fn(x) { try { len(x) } catch (e) { "inner" } }; try { f(1) } catch (e) { "outer" }`, "inner"},
+		{`let f = fn(x) { len(x) }; let a = f(1); let b = try { f(1) } catch (e) { "caught" }; join([type(a), type(b)], ",")`, "ERROR,ERROR"},
+		{`let f = fn(x) { let n = len(x); "after" }; try { f(1) } catch (e) { "caught" }`, "after"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMatch(t *testing.T) {
+	tests := []vmTestCase{
+		{`match 2 { 1 => 10, 2 => 20, _ => 30 }`, 20},
+		{`match 3 { 1 => 10, 2 => 20 }`, Null},
+		{`match [1, 2, 3] { [a, ...rest] => rest }`, []int{2, 3}},
+		{`match [1, 2] { [a, b, c] => 0, [a, b] => a + b }`, 3},
+		{`match {"a": 1, "b": 2} { {"a": a, "b": b} => a * 10 + b }`, 12},
+		{`match 5 { n if n < 3 => 0, n => n }`, 5},
+		{`let f = fn(x) { match x { [h, ...t] => h + f(t), _ => 0 } }; f([1, 2, 3])`, 6},
+		{`let f = fn(x) { let y = 1; match x { [y] => y, _ => y } }; f([3]) + f("s")`, 4},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []vmTestCase{
+		{`let [a, b] = [1, 2]; a + b`, 3},
+		{`let [a, ...rest] = [1, 2, 3]; rest`, []int{2, 3}},
+		{`let {"x": x, "y": y} = {"x": 1, "y": 2}; x * 10 + y`, 12},
+		{`let f = fn(p) { let [a, [b, c]] = p; a + b + c }; f([1, [2, 3]])`, 6},
+		{`let f = fn(p) { let [a] = p; a }; try { f([1, 2]) } catch (e) { e }`, "can't destructure [1, 2] into [a]"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestParameters(t *testing.T) {
+	tests := []vmTestCase{
+		{`let f = fn(a, b = 2) { a * b }; f(3)`, 6},
+		{`let f = fn(a, b = 2) { a * b }; f(3, 3)`, 9},
+		{`let f = fn(a = 1, b = a + 1) { b }; f()`, 2},
+		{`let f = fn(a, ...rest) { rest }; f(1, 2, 3)`, []int{2, 3}},
+		{`let f = fn(a, b) { a - b }; f(b = 1, a = 3)`, 2},
+		{`let g = fn(x) { let f = fn(a, b = x) { a + b }; f(1) + f(1, b = 10) }; g(5)`, 17},
+		{`let f = fn(n, acc = 1) { if (n < 2) { acc } else { f(n - 1, acc * n) } }; f(5)`, 120},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringInterpolation(t *testing.T) {
+	tests := []vmTestCase{
+		{`let name = "turtle"; "Hello ${name}!"`, "Hello turtle!"},
+		{`"${1 + 2} and ${[1, true]}"`, "3 and [1, true]"},
+		{`let f = fn(x) { "<${x}>" }; f(f(1))`, "<<1>>"},
+		{`"${"a"}${"b"}"`, "ab"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSlicesAndRanges(t *testing.T) {
+	tests := []vmTestCase{
+		{`[1, 2, 3, 4][1:3]`, []int{2, 3}},
+		{`[1, 2, 3, 4][:-1]`, []int{1, 2, 3}},
+		{`[1, 2, 3, 4][2:]`, []int{3, 4}},
+		{`[1, 2][5:]`, []int{}},
+		{`"turtle"[2:]`, "rtle"},
+		{`"turtle"[-3:]`, "tle"},
+		{`1..4`, []int{1, 2, 3}},
+		{`1..=4`, []int{1, 2, 3, 4}},
+		{`3..1`, []int{}},
+		{`let n = 3; -n..n`, []int{-3, -2, -1, 0, 1, 2}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []vmTestCase{
+		{`let g = fn() { yield 1; yield 2 }; collect(g())`, []int{1, 2}},
+		{`let g = fn(n) { yield n; yield ...[n + 1, n + 2] }; collect(g(1))`, []int{1, 2, 3}},
+		{`let g = fn() { let a = 1; yield a; let b = a + 1; yield b; yield a + b }; collect(g())`, []int{1, 2, 3}},
+		{`let g = fn() { yield 1 }; let it = g(); next(it); next(it)["done"]`, true},
+		{`let g = fn() { try { yield 1; 1 / 0 } catch (e) { yield 2 } }; collect(g())`, []int{1, 2}},
+		{`let g = fn() { yield 1; throw 5 }; let it = g(); try { collect(it) } catch (e) { e }`, 5},
+		{`let inner = fn() { yield 2 }; let g = fn() { yield 1; yield ...inner(); yield 3 }; collect(g())`, []int{1, 2, 3}},
+		// each level of the recursion takes over the generator of the last
+		// one, so this goes deeper than MaxFrames
+		{`let count = fn(n) { yield n; yield ...count(n + 1) }; len(collect(take(count(0), 3000)))`, 3000},
+		{`let b = fn() { yield 2 }; let a = fn() { yield 1; yield ...b() }; let it = a(); concat(collect(it), collect(it))`, []int{1, 2}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGeneratorFromHost(t *testing.T) {
+	vm := runToCompletion(t, `let g = fn(x) { yield x; yield x * 2 }; g(21)`, nil)
+	gen, ok := vm.LastPoppedStackElem().(object.Iterator)
+	if !ok {
+		t.Fatalf("result is not an iterator. got=%T", vm.LastPoppedStackElem())
+	}
+
+	for _, expected := range []int{21, 42} {
+		value, done, err := gen.Next(vm)
+		if err != nil || done {
+			t.Fatalf("Next failed: done=%t, err=%v", done, err)
+		}
+		testExpectedObject(t, expected, value)
+	}
+
+	_, done, err := gen.Next(vm)
+	if err != nil || !done {
+		t.Fatalf("generator not done: done=%t, err=%v", done, err)
+	}
+}
+
+func TestUncaughtException(t *testing.T) {
+	comp := compiler.New()
+	err := comp.Compile(parse(`let f = fn() { throw "boom" }; try { 1 } catch (e) { 2 }; f()`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err = New(comp.Bytecode()).Run()
+	var thrown *object.Thrown
+	if !errors.As(err, &thrown) || thrown.Value.Inspect() != "boom" {
+		t.Fatalf("expected uncaught boom, got %v", err)
+	}
+}
+
+func TestCall(t *testing.T) {
+	vm := runToCompletion(t, `fn(a, b) { a + b }`, nil)
+	add := vm.LastPoppedStackElem()
+
+	result, err := vm.Call(add, &object.Integer{Value: 1}, &object.Integer{Value: 2})
+	if err != nil {
+		t.Fatalf("Call failed: %s", err)
+	}
+	testExpectedObject(t, 3, result)
+
+	_, err = vm.Call(add, &object.Integer{Value: 1}, &object.String{Value: "a"})
+	if err == nil || err.Error() != "unsupported types for binary operation: INTEGER STRING" {
+		t.Fatalf("wrong error: %v", err)
+	}
+
+	// the VM is still usable after a failed call
+	result, err = vm.Call(add, &object.Integer{Value: 2}, &object.Integer{Value: 2})
+	if err != nil {
+		t.Fatalf("Call failed: %s", err)
+	}
+	testExpectedObject(t, 4, result)
+
+	result, err = vm.Call(object.GetBuiltinByName("len"), &object.String{Value: "abc"})
+	if err != nil {
+		t.Fatalf("Call failed: %s", err)
+	}
+	testExpectedObject(t, 3, result)
+}
+
+func TestCallFromBuiltin(t *testing.T) {
+	// apply(f, x) calls f(x) but ignores any error, which the VM must
+	// report anyway.
+	apply := &object.Builtin{Fn: func(engine object.Engine, args ...object.Object) object.Object {
+		result, _ := engine.Call(args[0], args[1:]...)
+		return result
+	}}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`apply(fn(x) { x * 2 }, 21)`, 42},
+		{`apply(fn(x) { apply(fn(y) { y + 1 }, x) + 1 }, 1)`, 3},
+		{`let f = fn(n) { if (n == 0) { 0 } else { apply(f, n - 1) + 1 } }; f(50)`, 50},
+		{`apply(len, [1, 2, 3])`, 3},
+		{`[1, apply(fn() { 2 }), 3]`, []int{1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		vm := runToCompletion(t, tt.input, map[string]*object.Builtin{"apply": apply})
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`apply(fn(x) { x + "a" }, 1)`, "unsupported types for binary operation: INTEGER STRING"},
+		{`apply(fn(x) { apply(fn(y) { -y }, "a") }, 1)`, "unsupported type for negatiion: STRING"},
+		{`apply(fn(x, y) { x }, 1)`, "wrong number of arguments: want=2, got=1"},
+	}
+
+	for _, tt := range errors {
+		comp, builtins := compileWithBuiltins(t, tt.input, map[string]*object.Builtin{"apply": apply})
+		vm := NewWithBuiltins(comp.Bytecode(), make([]object.Object, GlobalSize), builtins)
+		err := vm.Run()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func runToCompletion(t *testing.T, input string, extra map[string]*object.Builtin) *VM {
+	t.Helper()
+
+	comp, builtins := compileWithBuiltins(t, input, extra)
+	vm := NewWithBuiltins(comp.Bytecode(), make([]object.Object, GlobalSize), builtins)
+	err := vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	return vm
+}
+
+// compileWithBuiltins compiles input with the standard builtins followed
+// by extra.
+func compileWithBuiltins(t *testing.T, input string, extra map[string]*object.Builtin) (*compiler.Compiler, []*object.Builtin) {
+	t.Helper()
+
+	symbolTable := compiler.NewSymbolTable()
+	builtins := []*object.Builtin{}
+	for _, b := range object.Builtins {
+		symbolTable.DefineBuiltin(len(builtins), b.Name)
+		builtins = append(builtins, b.Builtin)
+	}
+	for name, b := range extra {
+		symbolTable.DefineBuiltin(len(builtins), name)
+		builtins = append(builtins, b)
+	}
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp, builtins
+}
+
 func runVmTests(t *testing.T, tests []vmTestCase) {
 	t.Helper()
 
@@ -566,6 +964,45 @@ func runVmTests(t *testing.T, tests []vmTestCase) {
 
 		stackElem := vm.LastPoppedStackElem()
 		testExpectedObject(t, tt.expected, stackElem)
+
+		testCompilerVariants(t, program, tt.expected)
+	}
+}
+
+// testCompilerVariants runs program again with the peephole optimizer and
+// superinstructions enabled, alone and together, to make sure the
+// transformed bytecode computes the same result.
+func testCompilerVariants(t *testing.T, program *ast.Program, expected interface{}) {
+	t.Helper()
+
+	variants := []struct {
+		name       string
+		optimize   bool
+		specialize bool
+	}{
+		{"optimized", true, false},
+		{"specialized", false, true},
+		{"optimized and specialized", true, true},
+	}
+
+	for _, variant := range variants {
+		comp := compiler.New()
+		comp.SetOptimize(variant.optimize)
+		comp.SetSpecialize(variant.specialize)
+
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler err (%s): %s", variant.name, err)
+		}
+
+		vm := New(comp.Bytecode())
+
+		err = vm.Run()
+		if err != nil {
+			t.Fatalf("vm err (%s): %s", variant.name, err)
+		}
+
+		testExpectedObject(t, expected, vm.LastPoppedStackElem())
 	}
 }
 